@@ -1,14 +1,23 @@
 package config
 
-import (
-	"os"
-	"strconv"
-	"time"
-)
+import "time"
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
+	Server    ServerConfig
+	Database  DatabaseConfig
+	Auth      AuthConfig
+	Admin     AdminConfig
+	Password  PasswordConfig
+	Users     UsersConfig
+	Log       LogConfig
+	Tracing   TracingConfig
+	RateLimit RateLimitConfig
+	CORS      CORSConfig
+	Health    HealthConfig
+
+	// PrintConfig is set by --print-config, which prints the effective
+	// config instead of starting the server
+	PrintConfig bool
 }
 
 type ServerConfig struct {
@@ -17,48 +26,175 @@ type ServerConfig struct {
 	WriteTimeout    time.Duration
 	IdleTimeout     time.Duration
 	ShutdownTimeout time.Duration
+	// ShutdownDelay is how long readiness fails before the server stops
+	// accepting connections, so load balancers can drain it first
+	ShutdownDelay time.Duration
+	// RequestTimeout bounds the work done for one request; 0 disables it
+	RequestTimeout time.Duration
+	// TrustedProxies lists the addresses and CIDR ranges of reverse proxies
+	// whose X-Forwarded-For header names the client
+	TrustedProxies []string
 }
 
 type DatabaseConfig struct {
 	MaxConnections int
+	// Driver and DSN select the SQL repository when Driver is set
+	Driver string
+	DSN    string
+	// DataDir enables the file-backed repository when set
+	DataDir          string
+	SnapshotInterval int
 }
 
-func LoadConfig() *Config {
-	return &Config{
-		Server: ServerConfig{
-			Port:            getEnv("SERVER_PORT", "8080"),
-			ReadTimeout:     getDurationEnv("SERVER_READ_TIMEOUT", 15*time.Second),
-			WriteTimeout:    getDurationEnv("SERVER_WRITE_TIMEOUT", 15*time.Second),
-			IdleTimeout:     getDurationEnv("SERVER_IDLE_TIMEOUT", 60*time.Second),
-			ShutdownTimeout: getDurationEnv("SERVER_SHUTDOWN_TIMEOUT", 15*time.Second),
-		},
-		Database: DatabaseConfig{
-			MaxConnections: getIntEnv("DB_MAX_CONNECTIONS", 10),
-		},
-	}
+type AuthConfig struct {
+	// JWTSecret signs access tokens; a random one is generated when empty
+	JWTSecret       string
+	Issuer          string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
 }
 
-func getEnv(key, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
-	}
-	return defaultValue
+// AdminConfig bootstraps an admin account on startup when Username is set
+type AdminConfig struct {
+	Username string
+	Email    string
+	Password string
 }
 
-func getIntEnv(key string, defaultValue int) int {
-	if value, exists := os.LookupEnv(key); exists {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
-		}
-	}
-	return defaultValue
+// PasswordConfig selects the hashing algorithm for new passwords and its cost.
+// Hashes made with other algorithms or costs are upgraded on login.
+type PasswordConfig struct {
+	// Algorithm is "argon2id" or "bcrypt"
+	Algorithm     string
+	Argon2Time    int
+	Argon2Memory  int // KiB
+	Argon2Threads int
+	BcryptCost    int
+
+	// Policy enforced on new passwords
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+}
+
+// UsersConfig controls how long soft-deleted users can be restored
+type UsersConfig struct {
+	// DeletedRetention is how long a deleted user is kept before it is purged;
+	// 0 keeps deleted users forever
+	DeletedRetention time.Duration
+	// PurgeInterval is how often deleted users are checked for purging
+	PurgeInterval time.Duration
+}
+
+// LogConfig selects what the application logs and how
+type LogConfig struct {
+	// Level is debug, info, warn or error
+	Level string
+	// Format is json or text
+	Format string
+}
+
+// TracingConfig selects where trace spans are exported
+type TracingConfig struct {
+	// Exporter is "none", which still gives logs and errors trace IDs, or
+	// "stdout" to write spans as JSON lines
+	Exporter string
+}
+
+// RateLimitConfig sets token-bucket limits written as "<requests>/<period>",
+// e.g. "100/1m" for bursts of up to 100 requests refilled over a minute. An
+// empty limit is not enforced.
+type RateLimitConfig struct {
+	// PerIP limits every request by client IP
+	PerIP string
+	// PerUser limits authenticated requests by user
+	PerUser string
+	// Routes limits single routes by client IP, as a comma-separated list of
+	// "<METHOD> <route>=<limit>"
+	Routes string
+	// EvictInterval is how often idle buckets are dropped
+	EvictInterval time.Duration
 }
 
-func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
-	if value, exists := os.LookupEnv(key); exists {
-		if duration, err := time.ParseDuration(value); err == nil {
-			return duration
-		}
+// CORSConfig controls which browser origins may call the API
+type CORSConfig struct {
+	// AllowedOrigins may contain "*" or wildcard subdomains such as
+	// "https://*.example.com"; CORS is disabled when it is empty
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache preflight responses
+	MaxAge time.Duration
+}
+
+// HealthConfig tunes the readiness checks
+type HealthConfig struct {
+	// CheckTimeout bounds each check of a readiness probe
+	CheckTimeout time.Duration
+	// MinFreeDiskMB is the free space file storage needs to be ready
+	MinFreeDiskMB int
+}
+
+// Default returns the configuration used for every setting that is not set
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:            "8080",
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    15 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			ShutdownTimeout: 15 * time.Second,
+			RequestTimeout:  10 * time.Second,
+		},
+		Database: DatabaseConfig{
+			MaxConnections:   10,
+			SnapshotInterval: 1000,
+		},
+		Auth: AuthConfig{
+			Issuer:          "go-rest",
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+		},
+		Password: PasswordConfig{
+			Algorithm:     "argon2id",
+			Argon2Time:    3,
+			Argon2Memory:  64 * 1024,
+			Argon2Threads: 2,
+			BcryptCost:    12,
+			MinLength:     8,
+			MaxLength:     128,
+		},
+		Users: UsersConfig{
+			DeletedRetention: 30 * 24 * time.Hour,
+			PurgeInterval:    time.Hour,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Tracing: TracingConfig{
+			Exporter: "none",
+		},
+		RateLimit: RateLimitConfig{
+			PerIP:         "300/1m",
+			PerUser:       "600/1m",
+			Routes:        "POST /api/v1/users=10/1h,POST /api/v1/auth/login=10/1m",
+			EvictInterval: time.Minute,
+		},
+		CORS: CORSConfig{
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			AllowedHeaders: []string{"Authorization", "Content-Type", "If-Match", "X-Request-ID", "traceparent"},
+			ExposedHeaders: []string{"ETag", "X-Request-ID", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
+			MaxAge:         10 * time.Minute,
+		},
+		Health: HealthConfig{
+			CheckTimeout:  2 * time.Second,
+			MinFreeDiskMB: 100,
+		},
 	}
-	return defaultValue
 }
\ No newline at end of file
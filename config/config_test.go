@@ -0,0 +1,320 @@
+package config_test
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rizqishq/Go-REST/config"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDefaults(t *testing.T) {
+	cfg, err := config.LoadConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg, config.Default()) {
+		t.Errorf("LoadConfig without settings = %+v, want the defaults", cfg)
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+server:
+  port: 1000
+  read_timeout: 20s
+log:
+  level: debug
+cors:
+  allowed_origins:
+    - https://a.example.com
+    - https://*.b.example.com
+rate_limit:
+  ip: ""
+`)
+	t.Setenv("CONFIG_FILE", file)
+	t.Setenv("SERVER_PORT", "2000")
+	t.Setenv("LOG_FORMAT", "text")
+
+	cfg, err := config.LoadConfig([]string{"--server-port", "3000", "--password-require-digit"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != "3000" {
+		t.Errorf("port = %q, want the flag's 3000", cfg.Server.Port)
+	}
+	if cfg.Server.ReadTimeout != 20*time.Second || cfg.Log.Level != "debug" {
+		t.Errorf("read timeout %v, log level %q; want the file's 20s and debug", cfg.Server.ReadTimeout, cfg.Log.Level)
+	}
+	if cfg.Log.Format != "text" || !cfg.Password.RequireDigit {
+		t.Errorf("log format %q, require digit %v; want text from env and true from the flag", cfg.Log.Format, cfg.Password.RequireDigit)
+	}
+	if want := []string{"https://a.example.com", "https://*.b.example.com"}; !reflect.DeepEqual(cfg.CORS.AllowedOrigins, want) {
+		t.Errorf("allowed origins = %q, want %q", cfg.CORS.AllowedOrigins, want)
+	}
+	if cfg.RateLimit.PerIP != "" {
+		t.Errorf("rate_limit.ip = %q, want it disabled by the file", cfg.RateLimit.PerIP)
+	}
+
+	// --config wins over CONFIG_FILE
+	other := writeFile(t, "other.json", `{"server": {"port": 4000, "idle_timeout": "2m"}, "health": {"min_free_disk_mb": 5}}`)
+	t.Setenv("SERVER_PORT", "")
+	os.Unsetenv("SERVER_PORT")
+	cfg, err = config.LoadConfig([]string{"--config", other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != "4000" || cfg.Server.IdleTimeout != 2*time.Minute || cfg.Health.MinFreeDiskMB != 5 || cfg.Log.Level != "info" {
+		t.Errorf("config from JSON = %+v", cfg)
+	}
+}
+
+func TestInvalidValues(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+server:
+  prot: 8080
+password:
+  bcrypt_cost: 40
+`)
+	t.Setenv("SERVER_READ_TIMEOUT", "15")
+	t.Setenv("DB_MAX_CONNECTIONS", "ten")
+
+	_, err := config.LoadConfig([]string{"--config", file})
+	if err == nil {
+		t.Fatal("LoadConfig succeeded")
+	}
+	for _, want := range []string{"unknown setting server.prot"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+
+	// Parse errors are reported together, naming where each value came from
+	_, err = config.LoadConfig(nil)
+	for _, want := range []string{`SERVER_READ_TIMEOUT="15": not a duration`, `DB_MAX_CONNECTIONS="ten": not an integer`} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+
+	os.Unsetenv("SERVER_READ_TIMEOUT")
+	os.Unsetenv("DB_MAX_CONNECTIONS")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "*")
+	_, err = config.LoadConfig([]string{"--password-bcrypt-cost", "40", "--cors-allow-credentials", "--server-port", "0", "--rate-limit-ip", "fast"})
+	for _, want := range []string{"password.bcrypt_cost", "cors.allow_credentials", "server.port", "rate_limit.ip"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+
+	// bcrypt cannot hash the admin password
+	t.Setenv("ADMIN_USERNAME", "admin")
+	t.Setenv("ADMIN_EMAIL", "admin@example.com")
+	t.Setenv("ADMIN_PASSWORD", strings.Repeat("p", 73))
+	if _, err := config.LoadConfig([]string{"--password-algorithm", "bcrypt"}); err == nil || !strings.Contains(err.Error(), "admin.password must be at most 72 bytes") {
+		t.Errorf("error %q does not mention the admin password", err)
+	}
+
+	if _, err := config.LoadConfig([]string{"-h"}); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("LoadConfig(-h) error = %v, want flag.ErrHelp", err)
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want config.RateLimit
+		ok   bool
+	}{
+		{"100/1m", config.RateLimit{Requests: 100, Period: time.Minute}, true},
+		{" 5 / 1h ", config.RateLimit{Requests: 5, Period: time.Hour}, true},
+		{"100", config.RateLimit{}, false},
+		{"0/1m", config.RateLimit{}, false},
+		{"x/1m", config.RateLimit{}, false},
+		{"10/0s", config.RateLimit{}, false},
+		{"10/minute", config.RateLimit{}, false},
+	}
+	for _, tt := range tests {
+		got, err := config.ParseRateLimit(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseRateLimit(%q) = %v, %v; want %v, ok = %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseRouteRateLimits(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []config.RouteRateLimit
+		ok   bool
+	}{
+		{"", nil, true},
+		{" , ", nil, true},
+		{"POST /api/v1/users=10/1h", []config.RouteRateLimit{{"POST /api/v1/users", config.RateLimit{Requests: 10, Period: time.Hour}}}, true},
+		{" POST  /api/v1/auth/login = 5/1m ,GET /api/v1/users=100/1s", []config.RouteRateLimit{
+			{"POST /api/v1/auth/login", config.RateLimit{Requests: 5, Period: time.Minute}},
+			{"GET /api/v1/users", config.RateLimit{Requests: 100, Period: time.Second}},
+		}, true},
+		{"/api/v1/users=10/1h", nil, false},
+		{"post /api/v1/users=10/1h", nil, false},
+		{"POST api/v1/users=10/1h", nil, false},
+		{"POST /api/v1/users", nil, false},
+		{"POST /api/v1/users extra=10/1h", nil, false},
+		{"POST /api/v1/users=10/1h,GET /api/v1/users=ten/1m", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := config.ParseRouteRateLimits(tt.in)
+		if (err == nil) != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseRouteRateLimits(%q) = %v, %v; want %v, ok = %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestValidateRateLimitsAndOrigins(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*config.Config)
+		want   string
+	}{
+		{"default limits", func(c *config.Config) {}, ""},
+		{"limits disabled", func(c *config.Config) { c.RateLimit = config.RateLimitConfig{} }, ""},
+		{"spaces in limits", func(c *config.Config) { c.RateLimit.PerIP = " 10 / 1s " }, ""},
+		{"ip without period", func(c *config.Config) { c.RateLimit.PerIP = "100" }, `rate_limit.ip: rate limit "100" is not <requests>/<period>`},
+		{"ip with zero requests", func(c *config.Config) { c.RateLimit.PerIP = "0/1m" }, "rate_limit.ip"},
+		{"user with bad period", func(c *config.Config) { c.RateLimit.PerUser = "100/minute" }, "rate_limit.user"},
+		{"user with negative period", func(c *config.Config) { c.RateLimit.PerUser = "100/-1m" }, "rate_limit.user"},
+		{"empty route entries", func(c *config.Config) { c.RateLimit.Routes = ",POST /api/v1/users=10/1h, ," }, ""},
+		{"route without method", func(c *config.Config) { c.RateLimit.Routes = "/api/v1/users=10/1h" }, `rate_limit.routes: route rate limit "/api/v1/users=10/1h" is not`},
+		{"route without limit", func(c *config.Config) { c.RateLimit.Routes = "POST /api/v1/users" }, "rate_limit.routes"},
+		{"route with bad limit", func(c *config.Config) { c.RateLimit.Routes = "POST /api/v1/users=10/1h,GET /api/v1/users=ten/1m" }, `"GET /api/v1/users=ten/1m"`},
+		{"route with lower case method", func(c *config.Config) { c.RateLimit.Routes = "post /api/v1/users=10/1h" }, "rate_limit.routes"},
+
+		{"origins", func(c *config.Config) {
+			c.CORS.AllowedOrigins = []string{"https://app.example.com", "http://localhost:3000", "https://*.example.com", "http://[::1]:8080"}
+		}, ""},
+		{"any origin", func(c *config.Config) { c.CORS.AllowedOrigins = []string{"*"} }, ""},
+		{"origin with path", func(c *config.Config) { c.CORS.AllowedOrigins = []string{"https://app.example.com/"} }, `cors.allowed_origins: "https://app.example.com/" is not`},
+		{"origin without scheme", func(c *config.Config) { c.CORS.AllowedOrigins = []string{"app.example.com"} }, "cors.allowed_origins"},
+		{"origin with user", func(c *config.Config) { c.CORS.AllowedOrigins = []string{"https://me@app.example.com"} }, "cors.allowed_origins"},
+		{"origin with query", func(c *config.Config) { c.CORS.AllowedOrigins = []string{"https://app.example.com?"} }, "cors.allowed_origins"},
+		{"origin with bad port", func(c *config.Config) { c.CORS.AllowedOrigins = []string{"https://app.example.com:https"} }, "cors.allowed_origins"},
+		{"wildcard inside host", func(c *config.Config) { c.CORS.AllowedOrigins = []string{"https://app.*.example.com"} }, "cors.allowed_origins"},
+		{"wildcard without scheme", func(c *config.Config) { c.CORS.AllowedOrigins = []string{"*.example.com"} }, "cors.allowed_origins"},
+		{"null origin", func(c *config.Config) { c.CORS.AllowedOrigins = []string{"null"} }, "cors.allowed_origins"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			tt.change(cfg)
+			err := cfg.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteYAML(t *testing.T) {
+	t.Setenv("AUTH_JWT_SECRET", strings.Repeat("s", 32))
+	t.Setenv("ADMIN_USERNAME", "admin")
+	t.Setenv("ADMIN_EMAIL", "admin@example.com")
+	t.Setenv("ADMIN_PASSWORD", "hunter2hunter2")
+	t.Setenv("USERS_DELETED_RETENTION", "72h")
+	cfg, err := config.LoadConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := cfg.WriteYAML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, secret := range []string{cfg.Auth.JWTSecret, cfg.Admin.Password} {
+		if strings.Contains(out, secret) {
+			t.Errorf("printed config contains the secret %q:\n%s", secret, out)
+		}
+	}
+	for _, want := range []string{"deleted_retention: 72h\n", "username: admin\n", "jwt_secret: REDACTED\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("printed config is missing %q:\n%s", want, out)
+		}
+	}
+
+	// The printed config loads back to the same values, apart from secrets
+	os.Unsetenv("AUTH_JWT_SECRET")
+	os.Unsetenv("ADMIN_PASSWORD")
+	t.Setenv("ADMIN_PASSWORD", "hunter2hunter2")
+	reloaded, err := config.LoadConfig([]string{"--config", writeFile(t, "printed.yaml", strings.Replace(out, "REDACTED", cfg.Auth.JWTSecret, 1))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reloaded, cfg) {
+		t.Errorf("reloaded config = %+v, want %+v", reloaded, cfg)
+	}
+}
+
+func TestReload(t *testing.T) {
+	t.Setenv("LOG_LEVEL", "info")
+	t.Setenv("SERVER_PORT", "8080")
+	cfg, err := config.LoadConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("LOG_LEVEL", "debug")
+	t.Setenv("SERVER_PORT", "9090")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example.com, https://b.example.com")
+	t.Setenv("RATE_LIMIT_IP", "10/1s")
+	t.Setenv("PASSWORD_REQUIRE_SYMBOL", "true")
+	t.Setenv("SERVER_READ_TIMEOUT", "1m")
+	next, err := config.LoadConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, changed, rejected := cfg.Reload(next)
+	if want := []string{"password.require_symbol", "log.level", "rate_limit.ip", "cors.allowed_origins"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed = %q, want %q", changed, want)
+	}
+	if want := []string{"server.port", "server.read_timeout"}; !reflect.DeepEqual(rejected, want) {
+		t.Errorf("rejected = %q, want %q", rejected, want)
+	}
+	if reloaded.Log.Level != "debug" || reloaded.RateLimit.PerIP != "10/1s" || !reloaded.Password.RequireSymbol {
+		t.Errorf("reloaded config = %+v, want the new reloadable settings", reloaded)
+	}
+	if want := []string{"https://a.example.com", "https://b.example.com"}; !reflect.DeepEqual(reloaded.CORS.AllowedOrigins, want) {
+		t.Errorf("allowed origins = %q, want %q", reloaded.CORS.AllowedOrigins, want)
+	}
+	if reloaded.Server.Port != "8080" || reloaded.Server.ReadTimeout != cfg.Server.ReadTimeout {
+		t.Errorf("reloaded server config = %+v, want it unchanged", reloaded.Server)
+	}
+	if cfg.Log.Level != "info" {
+		t.Errorf("Reload changed the original config")
+	}
+
+	if _, changed, rejected := reloaded.Reload(reloaded); changed != nil || rejected != nil {
+		t.Errorf("reloading the same config changed %q and rejected %q", changed, rejected)
+	}
+}
@@ -0,0 +1,375 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv names the config file when --config is not given
+const ConfigFileEnv = "CONFIG_FILE"
+
+// LoadConfig builds the configuration from, in increasing precedence, the
+// defaults, the YAML or JSON file named by --config or CONFIG_FILE, the
+// environment and the command-line flags in args. Every malformed or out of
+// range value is reported in the returned error.
+func LoadConfig(args []string) (*Config, error) {
+	cfg := Default()
+	table := settings(cfg)
+
+	fs := flag.NewFlagSet("go-rest", flag.ContinueOnError)
+	file := fs.String("config", os.Getenv(ConfigFileEnv), "YAML or JSON config `file`")
+	fs.BoolVar(&cfg.PrintConfig, "print-config", false, "print the effective config with secrets redacted and exit")
+	var flagValues []sourcedValue
+	for _, s := range table {
+		define := fs.Func
+		if s.isBool {
+			define = fs.BoolFunc
+		}
+		define(s.flagName(), "overrides $"+s.env, func(value string) error {
+			flagValues = append(flagValues, sourcedValue{s, "--" + s.flagName(), value})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	var values []sourcedValue
+	if *file != "" {
+		fileValues, err := readFile(*file, table)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, fileValues...)
+	}
+	for _, s := range table {
+		if value, ok := os.LookupEnv(s.env); ok {
+			values = append(values, sourcedValue{s, s.env, value})
+		}
+	}
+	values = append(values, flagValues...)
+
+	var errs []error
+	for _, v := range values {
+		if err := v.setting.parse(v.value); err != nil {
+			errs = append(errs, fmt.Errorf("%s=%q: %v", v.source, v.value, err))
+		}
+	}
+	if len(errs) == 0 {
+		errs = append(errs, cfg.Validate())
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// setting binds one value of a Config to its key in config files, its
+// environment variable and its command-line flag
+type setting struct {
+	// key is the dotted path in config files, e.g. "server.read_timeout"
+	key    string
+	env    string
+	secret bool
+	// reloadable settings can change while the server runs
+	reloadable bool
+	// isBool settings are flags that need no value
+	isBool bool
+	parse  func(value string) error
+	// get returns the value for printing
+	get func() any
+}
+
+// flagName turns the key into a flag name, e.g. "server-read-timeout"
+func (s setting) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(s.key)
+}
+
+// sourcedValue is a value for a setting and where it came from
+type sourcedValue struct {
+	setting setting
+	source  string
+	value   string
+}
+
+// settings lists every setting of cfg in the order they are printed
+func settings(cfg *Config) []setting {
+	return []setting{
+		stringSetting("server.port", "SERVER_PORT", &cfg.Server.Port),
+		durationSetting("server.read_timeout", "SERVER_READ_TIMEOUT", &cfg.Server.ReadTimeout),
+		durationSetting("server.write_timeout", "SERVER_WRITE_TIMEOUT", &cfg.Server.WriteTimeout),
+		durationSetting("server.idle_timeout", "SERVER_IDLE_TIMEOUT", &cfg.Server.IdleTimeout),
+		durationSetting("server.shutdown_timeout", "SERVER_SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout),
+		durationSetting("server.shutdown_delay", "SERVER_SHUTDOWN_DELAY", &cfg.Server.ShutdownDelay),
+		durationSetting("server.request_timeout", "SERVER_REQUEST_TIMEOUT", &cfg.Server.RequestTimeout),
+		listSetting("server.trusted_proxies", "SERVER_TRUSTED_PROXIES", &cfg.Server.TrustedProxies),
+
+		stringSetting("database.driver", "DB_DRIVER", &cfg.Database.Driver),
+		secret(stringSetting("database.dsn", "DB_DSN", &cfg.Database.DSN)),
+		stringSetting("database.data_dir", "DB_DATA_DIR", &cfg.Database.DataDir),
+		intSetting("database.max_connections", "DB_MAX_CONNECTIONS", &cfg.Database.MaxConnections),
+		intSetting("database.snapshot_interval", "DB_SNAPSHOT_INTERVAL", &cfg.Database.SnapshotInterval),
+
+		secret(stringSetting("auth.jwt_secret", "AUTH_JWT_SECRET", &cfg.Auth.JWTSecret)),
+		stringSetting("auth.issuer", "AUTH_ISSUER", &cfg.Auth.Issuer),
+		durationSetting("auth.access_token_ttl", "AUTH_ACCESS_TOKEN_TTL", &cfg.Auth.AccessTokenTTL),
+		durationSetting("auth.refresh_token_ttl", "AUTH_REFRESH_TOKEN_TTL", &cfg.Auth.RefreshTokenTTL),
+
+		stringSetting("admin.username", "ADMIN_USERNAME", &cfg.Admin.Username),
+		stringSetting("admin.email", "ADMIN_EMAIL", &cfg.Admin.Email),
+		secret(stringSetting("admin.password", "ADMIN_PASSWORD", &cfg.Admin.Password)),
+
+		stringSetting("password.algorithm", "PASSWORD_ALGORITHM", &cfg.Password.Algorithm),
+		intSetting("password.argon2_time", "PASSWORD_ARGON2_TIME", &cfg.Password.Argon2Time),
+		intSetting("password.argon2_memory", "PASSWORD_ARGON2_MEMORY", &cfg.Password.Argon2Memory),
+		intSetting("password.argon2_threads", "PASSWORD_ARGON2_THREADS", &cfg.Password.Argon2Threads),
+		intSetting("password.bcrypt_cost", "PASSWORD_BCRYPT_COST", &cfg.Password.BcryptCost),
+		reloadable(intSetting("password.min_length", "PASSWORD_MIN_LENGTH", &cfg.Password.MinLength)),
+		reloadable(intSetting("password.max_length", "PASSWORD_MAX_LENGTH", &cfg.Password.MaxLength)),
+		reloadable(boolSetting("password.require_upper", "PASSWORD_REQUIRE_UPPER", &cfg.Password.RequireUpper)),
+		reloadable(boolSetting("password.require_lower", "PASSWORD_REQUIRE_LOWER", &cfg.Password.RequireLower)),
+		reloadable(boolSetting("password.require_digit", "PASSWORD_REQUIRE_DIGIT", &cfg.Password.RequireDigit)),
+		reloadable(boolSetting("password.require_symbol", "PASSWORD_REQUIRE_SYMBOL", &cfg.Password.RequireSymbol)),
+
+		durationSetting("users.deleted_retention", "USERS_DELETED_RETENTION", &cfg.Users.DeletedRetention),
+		durationSetting("users.purge_interval", "USERS_PURGE_INTERVAL", &cfg.Users.PurgeInterval),
+
+		reloadable(stringSetting("log.level", "LOG_LEVEL", &cfg.Log.Level)),
+		stringSetting("log.format", "LOG_FORMAT", &cfg.Log.Format),
+
+		stringSetting("tracing.exporter", "TRACING_EXPORTER", &cfg.Tracing.Exporter),
+
+		reloadable(stringSetting("rate_limit.ip", "RATE_LIMIT_IP", &cfg.RateLimit.PerIP)),
+		reloadable(stringSetting("rate_limit.user", "RATE_LIMIT_USER", &cfg.RateLimit.PerUser)),
+		reloadable(stringSetting("rate_limit.routes", "RATE_LIMIT_ROUTES", &cfg.RateLimit.Routes)),
+		durationSetting("rate_limit.evict_interval", "RATE_LIMIT_EVICT_INTERVAL", &cfg.RateLimit.EvictInterval),
+
+		reloadable(listSetting("cors.allowed_origins", "CORS_ALLOWED_ORIGINS", &cfg.CORS.AllowedOrigins)),
+		reloadable(listSetting("cors.allowed_methods", "CORS_ALLOWED_METHODS", &cfg.CORS.AllowedMethods)),
+		reloadable(listSetting("cors.allowed_headers", "CORS_ALLOWED_HEADERS", &cfg.CORS.AllowedHeaders)),
+		reloadable(listSetting("cors.exposed_headers", "CORS_EXPOSED_HEADERS", &cfg.CORS.ExposedHeaders)),
+		reloadable(boolSetting("cors.allow_credentials", "CORS_ALLOW_CREDENTIALS", &cfg.CORS.AllowCredentials)),
+		reloadable(durationSetting("cors.max_age", "CORS_MAX_AGE", &cfg.CORS.MaxAge)),
+
+		durationSetting("health.check_timeout", "HEALTH_CHECK_TIMEOUT", &cfg.Health.CheckTimeout),
+		intSetting("health.min_free_disk_mb", "HEALTH_MIN_FREE_DISK_MB", &cfg.Health.MinFreeDiskMB),
+	}
+}
+
+func secret(s setting) setting {
+	s.secret = true
+	return s
+}
+
+func reloadable(s setting) setting {
+	s.reloadable = true
+	return s
+}
+
+func stringSetting(key, env string, p *string) setting {
+	return setting{
+		key: key, env: env,
+		parse: func(value string) error {
+			*p = value
+			return nil
+		},
+		get: func() any { return *p },
+	}
+}
+
+func intSetting(key, env string, p *int) setting {
+	return setting{
+		key: key, env: env,
+		parse: func(value string) error {
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return errors.New("not an integer")
+			}
+			*p = n
+			return nil
+		},
+		get: func() any { return *p },
+	}
+}
+
+func boolSetting(key, env string, p *bool) setting {
+	return setting{
+		key: key, env: env, isBool: true,
+		parse: func(value string) error {
+			b, err := strconv.ParseBool(strings.TrimSpace(value))
+			if err != nil {
+				return errors.New("not a boolean")
+			}
+			*p = b
+			return nil
+		},
+		get: func() any { return *p },
+	}
+}
+
+func durationSetting(key, env string, p *time.Duration) setting {
+	return setting{
+		key: key, env: env,
+		parse: func(value string) error {
+			d, err := time.ParseDuration(strings.TrimSpace(value))
+			if err != nil {
+				return errors.New("not a duration with a unit, such as 15s or 1h30m")
+			}
+			*p = d
+			return nil
+		},
+		get: func() any { return formatDuration(*p) },
+	}
+}
+
+// listSetting parses a comma-separated list, dropping empty items
+func listSetting(key, env string, p *[]string) setting {
+	return setting{
+		key: key, env: env,
+		parse: func(value string) error {
+			var list []string
+			for item := range strings.SplitSeq(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			*p = list
+			return nil
+		},
+		get: func() any {
+			if *p == nil {
+				return []string{}
+			}
+			return *p
+		},
+	}
+}
+
+// formatDuration drops the zero units time.Duration.String adds, so 720h0m0s
+// prints as 720h
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// readFile reads the settings of a YAML or JSON config file. Nested objects
+// form the dotted keys, and lists are joined with commas.
+func readFile(path string, table []setting) ([]sourcedValue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tree map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&tree)
+	default:
+		return nil, fmt.Errorf("%s: config files must be .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	flat := make(map[string]string)
+	if err := flatten("", tree, flat); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var values []sourcedValue
+	for _, s := range table {
+		if value, ok := flat[s.key]; ok {
+			values = append(values, sourcedValue{s, path + ": " + s.key, value})
+			delete(flat, s.key)
+		}
+	}
+	var errs []error
+	for key := range flat {
+		errs = append(errs, fmt.Errorf("%s: unknown setting %s", path, key))
+	}
+	return values, errors.Join(errs...)
+}
+
+func flatten(prefix string, node any, out map[string]string) error {
+	switch node := node.(type) {
+	case map[string]any:
+		for key, child := range node {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			if err := flatten(key, child, out); err != nil {
+				return err
+			}
+		}
+	case []any:
+		items := make([]string, len(node))
+		for i, item := range node {
+			switch item.(type) {
+			case map[string]any, []any:
+				return fmt.Errorf("%s: lists may only hold plain values", prefix)
+			}
+			items[i] = fmt.Sprint(item)
+		}
+		out[prefix] = strings.Join(items, ",")
+	case nil:
+		out[prefix] = ""
+	default:
+		out[prefix] = fmt.Sprint(node)
+	}
+	return nil
+}
+
+// WriteYAML writes the configuration in config file form, with secrets
+// redacted
+func (c *Config) WriteYAML(w io.Writer) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	var section *yaml.Node
+	var sectionName string
+	for _, s := range settings(c) {
+		name, key, _ := strings.Cut(s.key, ".")
+		if section == nil || name != sectionName {
+			section = &yaml.Node{Kind: yaml.MappingNode}
+			sectionName = name
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, section)
+		}
+
+		value := s.get()
+		if s.secret && value != "" {
+			value = "REDACTED"
+		}
+		var node yaml.Node
+		if err := node.Encode(value); err != nil {
+			return err
+		}
+		section.Content = append(section.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, &node)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+	return enc.Close()
+}
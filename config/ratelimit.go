@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimit is a token bucket holding up to Requests tokens, refilled evenly
+// over Period. Every request takes a token, so a client may burst Requests
+// requests and then make Requests per Period.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseRateLimit parses a limit written as "<requests>/<period>", e.g.
+// "100/1m"
+func ParseRateLimit(s string) (RateLimit, error) {
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("rate limit %q is not <requests>/<period>", s)
+	}
+	var limit RateLimit
+	var err error
+	if limit.Requests, err = strconv.Atoi(strings.TrimSpace(requests)); err != nil || limit.Requests < 1 {
+		return RateLimit{}, fmt.Errorf("rate limit %q must allow at least one request", s)
+	}
+	if limit.Period, err = time.ParseDuration(strings.TrimSpace(period)); err != nil || limit.Period <= 0 {
+		return RateLimit{}, fmt.Errorf("rate limit %q has an invalid period", s)
+	}
+	return limit, nil
+}
+
+func (l RateLimit) String() string {
+	return strconv.Itoa(l.Requests) + "/" + l.Period.String()
+}
+
+// RouteRateLimit is the limit of a single route
+type RouteRateLimit struct {
+	// Route is the method and path template, e.g. "POST /api/v1/users"
+	Route string
+	Limit RateLimit
+}
+
+// ParseRouteRateLimit parses one entry of RateLimitConfig.Routes, written as
+// "<METHOD> <route>=<requests>/<period>"
+func ParseRouteRateLimit(entry string) (RouteRateLimit, error) {
+	route, value, ok := strings.Cut(entry, "=")
+	fields := strings.Fields(route)
+	if !ok || len(fields) != 2 || !isMethod(fields[0]) || !strings.HasPrefix(fields[1], "/") {
+		return RouteRateLimit{}, fmt.Errorf("route rate limit %q is not <METHOD> <route>=<requests>/<period>", entry)
+	}
+	limit, err := ParseRateLimit(value)
+	if err != nil {
+		return RouteRateLimit{}, fmt.Errorf("route rate limit %q: %w", entry, err)
+	}
+	return RouteRateLimit{Route: fields[0] + " " + fields[1], Limit: limit}, nil
+}
+
+// ParseRouteRateLimits parses RateLimitConfig.Routes, skipping empty entries
+func ParseRouteRateLimits(s string) ([]RouteRateLimit, error) {
+	var routes []RouteRateLimit
+	for entry := range strings.SplitSeq(s, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		route, err := ParseRouteRateLimit(entry)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+func isMethod(s string) bool {
+	return s != "" && strings.Trim(s, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") == ""
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Reload returns a copy of c with the reloadable settings of next, a Config
+// loaded later. changed lists the settings that took a new value; rejected
+// lists those that differ in next but can only change with a restart, and
+// keep their value from c.
+func (c *Config) Reload(next *Config) (reloaded *Config, changed, rejected []string) {
+	copied := *c
+	reloaded = &copied
+	current, target, out := settings(c), settings(next), settings(reloaded)
+	for i, s := range current {
+		value := target[i].text()
+		if s.text() == value {
+			continue
+		}
+		if !s.reloadable {
+			rejected = append(rejected, s.key)
+			continue
+		}
+		// The value came from a loaded Config, so it parses
+		out[i].parse(value)
+		changed = append(changed, s.key)
+	}
+	return reloaded, changed, rejected
+}
+
+// text returns the value in the form parse accepts
+func (s setting) text() string {
+	if list, ok := s.get().([]string); ok {
+		return strings.Join(list, ",")
+	}
+	return fmt.Sprint(s.get())
+}
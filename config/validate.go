@@ -0,0 +1,121 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validate reports every value that is out of range or inconsistent with
+// another, naming settings by their config file keys
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	nonNegative := func(key string, d time.Duration) {
+		check(d >= 0, "%s must not be negative", key)
+	}
+	positive := func(key string, d time.Duration) {
+		check(d > 0, "%s must be positive", key)
+	}
+	oneOf := func(key, value string, allowed ...string) {
+		check(slices.Contains(allowed, value), "%s must be one of %v, not %q", key, allowed, value)
+	}
+	rateLimit := func(key, value string) {
+		if value != "" {
+			_, err := ParseRateLimit(value)
+			check(err == nil, "%s: %v", key, err)
+		}
+	}
+
+	port, err := strconv.Atoi(c.Server.Port)
+	check(err == nil && port >= 1 && port <= 65535, "server.port must be a port number between 1 and 65535, not %q", c.Server.Port)
+	nonNegative("server.read_timeout", c.Server.ReadTimeout)
+	nonNegative("server.write_timeout", c.Server.WriteTimeout)
+	nonNegative("server.idle_timeout", c.Server.IdleTimeout)
+	positive("server.shutdown_timeout", c.Server.ShutdownTimeout)
+	nonNegative("server.shutdown_delay", c.Server.ShutdownDelay)
+	nonNegative("server.request_timeout", c.Server.RequestTimeout)
+	for _, proxy := range c.Server.TrustedProxies {
+		_, addrErr := netip.ParseAddr(proxy)
+		_, prefixErr := netip.ParsePrefix(proxy)
+		check(addrErr == nil || prefixErr == nil, "server.trusted_proxies: %q is not an IP address or CIDR range", proxy)
+	}
+
+	check(c.Database.Driver == "" || c.Database.DSN != "", "database.dsn is required with database.driver")
+	check(c.Database.MaxConnections >= 0, "database.max_connections must not be negative")
+	check(c.Database.SnapshotInterval >= 0, "database.snapshot_interval must not be negative")
+
+	check(c.Auth.JWTSecret == "" || len(c.Auth.JWTSecret) >= 32, "auth.jwt_secret must be at least 32 bytes")
+	positive("auth.access_token_ttl", c.Auth.AccessTokenTTL)
+	positive("auth.refresh_token_ttl", c.Auth.RefreshTokenTTL)
+
+	check(c.Admin.Username == "" || (c.Admin.Email != "" && c.Admin.Password != ""), "admin.email and admin.password are required with admin.username")
+	// bcrypt only hashes the first 72 bytes and refuses longer passwords
+	check(c.Password.Algorithm != "bcrypt" || len(c.Admin.Password) <= 72, "admin.password must be at most 72 bytes with the bcrypt algorithm")
+
+	p := c.Password
+	oneOf("password.algorithm", p.Algorithm, "argon2id", "bcrypt")
+	check(p.Argon2Time >= 1, "password.argon2_time must be at least 1")
+	check(p.Argon2Threads >= 1 && p.Argon2Threads <= 255, "password.argon2_threads must be between 1 and 255")
+	check(p.Argon2Memory >= 8*p.Argon2Threads, "password.argon2_memory must be at least 8 KiB per thread")
+	check(p.BcryptCost >= 4 && p.BcryptCost <= 31, "password.bcrypt_cost must be between 4 and 31")
+	check(p.MinLength >= 1, "password.min_length must be at least 1")
+	check(p.MaxLength >= p.MinLength, "password.max_length must not be less than password.min_length")
+
+	nonNegative("users.deleted_retention", c.Users.DeletedRetention)
+	nonNegative("users.purge_interval", c.Users.PurgeInterval)
+
+	oneOf("log.level", c.Log.Level, "debug", "info", "warn", "error")
+	oneOf("log.format", c.Log.Format, "json", "text")
+	oneOf("tracing.exporter", c.Tracing.Exporter, "none", "stdout")
+
+	rateLimit("rate_limit.ip", c.RateLimit.PerIP)
+	rateLimit("rate_limit.user", c.RateLimit.PerUser)
+	// Report every bad entry, not only the first ParseRouteRateLimits stops at
+	for entry := range strings.SplitSeq(c.RateLimit.Routes, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			_, err := ParseRouteRateLimit(entry)
+			check(err == nil, "rate_limit.routes: %v", err)
+		}
+	}
+	nonNegative("rate_limit.evict_interval", c.RateLimit.EvictInterval)
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		check(validOrigin(origin), "cors.allowed_origins: %q is not *, an origin such as https://app.example.com or a wildcard such as https://*.example.com", origin)
+	}
+	// Credentials for any origin would let every site act on behalf of
+	// signed-in users
+	check(!c.CORS.AllowCredentials || !slices.Contains(c.CORS.AllowedOrigins, "*"), "cors.allow_credentials cannot be combined with the * origin")
+	nonNegative("cors.max_age", c.CORS.MaxAge)
+
+	nonNegative("health.check_timeout", c.Health.CheckTimeout)
+	check(c.Health.MinFreeDiskMB >= 0, "health.min_free_disk_mb must not be negative")
+
+	return errors.Join(errs...)
+}
+
+// validOrigin reports whether s is "*" or a scheme, host and optional port
+// that browsers send as the Origin header. The host may start with "*." to
+// match any subdomain.
+func validOrigin(s string) bool {
+	if s == "*" {
+		return true
+	}
+	scheme, host, ok := strings.Cut(s, "://")
+	if !ok {
+		return false
+	}
+	host = strings.TrimPrefix(host, "*.")
+	u, err := url.Parse(scheme + "://" + host)
+	return err == nil && u.Host == host && u.Hostname() != "" && !strings.Contains(host, "*") &&
+		u.User == nil && u.Path == "" && !u.ForceQuery && u.RawQuery == "" && u.Fragment == ""
+}
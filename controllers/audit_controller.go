@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rizqishq/Go-REST/logging"
+	"github.com/rizqishq/Go-REST/middleware"
+	"github.com/rizqishq/Go-REST/models"
+	"github.com/rizqishq/Go-REST/repositories"
+	"github.com/rizqishq/Go-REST/services"
+)
+
+// AuditController handles audit log endpoints
+type AuditController struct {
+	auditService *services.AuditService
+}
+
+// Create new AuditController
+func NewAuditController(s *services.AuditService) *AuditController {
+	return &AuditController{auditService: s}
+}
+
+// RegisterRoutes hooks controller into router. Reading the audit log
+// requires the audit:read permission.
+func (c *AuditController) RegisterRoutes(r *mux.Router, authenticate mux.MiddlewareFunc) {
+	r.Handle("/audit", authenticate(middleware.RequirePermission(models.PermAuditRead)(http.HandlerFunc(c.GetAuditEntries)))).Methods("GET")
+}
+
+// Page size limits for GET /audit
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 1000
+)
+
+// @Summary List audit entries
+// @Description List recorded user changes, oldest first. Page with after_id set to the last ID received.
+// @Tags audit
+// @Produce json
+// @Param user_id query int false "Changed user"
+// @Param action query string false "create, update, delete, restore or purge"
+// @Param since query string false "RFC 3339 timestamp, inclusive"
+// @Param after_id query int false "Only entries with a greater ID"
+// @Param limit query int false "Page size (default 100, max 1000)"
+// @Success 200 {object} models.AuditListResponse
+// @Failure 400 {object} middleware.ErrorResponse
+// @Security BearerAuth
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 403 {object} middleware.ErrorResponse
+// @Router /audit [get]
+func (c *AuditController) GetAuditEntries(w http.ResponseWriter, r *http.Request) {
+	q, err := parseAuditQuery(r.URL.Query())
+	if err != nil {
+		badRequest(w, r, err.Error())
+		return
+	}
+
+	entries, err := c.auditService.ListEntries(r.Context(), q)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, entries)
+}
+
+// parseAuditQuery reads the GET /audit query parameters
+func parseAuditQuery(values url.Values) (repositories.AuditQuery, error) {
+	q := repositories.AuditQuery{
+		Action: models.AuditAction(values.Get("action")),
+		Limit:  defaultAuditPageSize,
+	}
+
+	if q.Action != "" && !q.Action.Valid() {
+		return q, fmt.Errorf("unknown action %q", q.Action)
+	}
+
+	if v := values.Get("user_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || id == 0 {
+			return q, errors.New("user_id must be a positive integer")
+		}
+		q.UserID = uint(id)
+	}
+
+	if v := values.Get("after_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return q, errors.New("after_id must be a non-negative integer")
+		}
+		q.AfterID = uint(id)
+	}
+
+	if v := values.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return q, errors.New("since must be an RFC 3339 timestamp")
+		}
+		q.Since = t
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxAuditPageSize {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxAuditPageSize)
+		}
+		q.Limit = limit
+	}
+	return q, nil
+}
+
+// withAuditInfo attributes the user changes made by h to the signed-in user,
+// or to an anonymous client, and the ID of the request
+func withAuditInfo(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		info := services.AuditInfo{
+			Actor:     services.ActorAnonymous,
+			RequestID: logging.RequestID(r.Context()),
+		}
+		if user, ok := middleware.UserFromContext(r.Context()); ok {
+			info.ActorID = user.ID
+			info.Actor = user.Username
+		}
+		h(w, r.WithContext(services.WithAuditInfo(r.Context(), info)))
+	}
+}
@@ -0,0 +1,106 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rizqishq/Go-REST/controllers"
+	"github.com/rizqishq/Go-REST/middleware"
+	"github.com/rizqishq/Go-REST/models"
+	"github.com/rizqishq/Go-REST/repositories"
+	"github.com/rizqishq/Go-REST/services"
+)
+
+func TestGetAuditEntries(t *testing.T) {
+	ctx := context.Background()
+	users := repositories.NewInMemoryUserRepository()
+	admin := &models.User{Username: "admin", Email: "admin@example.com", Role: models.RoleAdmin}
+	plain := &models.User{Username: "john", Email: "john@example.com", Role: models.RoleUser}
+	for _, user := range []*models.User{admin, plain} {
+		if err := users.Create(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	audit := repositories.NewInMemoryAuditRepository()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, e := range []struct {
+		action models.AuditAction
+		userID uint
+	}{
+		{models.AuditCreate, 2},
+		{models.AuditCreate, 3},
+		{models.AuditUpdate, 2},
+		{models.AuditDelete, 3},
+		{models.AuditUpdate, 2},
+	} {
+		entry := &models.AuditEntry{Actor: "admin", Action: e.action, UserID: e.userID, CreatedAt: start.Add(time.Duration(i) * time.Hour)}
+		if err := audit.Create(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	router := mux.NewRouter()
+	controllers.NewAuditController(services.NewAuditService(audit)).RegisterRoutes(router, middleware.AuthMiddleware(tokenIsID{users}))
+
+	tests := []struct {
+		name, query string
+		status      int
+		ids         []uint
+	}{
+		{"everything", "", http.StatusOK, []uint{1, 2, 3, 4, 5}},
+		{"user_id", "?user_id=2", http.StatusOK, []uint{1, 3, 5}},
+		{"action", "?action=update", http.StatusOK, []uint{3, 5}},
+		{"since is inclusive", "?since=2026-01-01T02:00:00Z", http.StatusOK, []uint{3, 4, 5}},
+		{"since with offset", "?since=2026-01-01T04:00:00%2B01:00", http.StatusOK, []uint{4, 5}},
+		{"filters combined", "?user_id=3&action=delete", http.StatusOK, []uint{4}},
+		{"no match", "?user_id=9", http.StatusOK, []uint{}},
+		{"after_id and limit", "?after_id=1&limit=2", http.StatusOK, []uint{2, 3}},
+		{"bad since", "?since=yesterday", http.StatusBadRequest, nil},
+		{"since without zone", "?since=2026-01-01T02:00:00", http.StatusBadRequest, nil},
+		{"unknown action", "?action=read", http.StatusBadRequest, nil},
+		{"zero user_id", "?user_id=0", http.StatusBadRequest, nil},
+		{"negative user_id", "?user_id=-1", http.StatusBadRequest, nil},
+		{"bad after_id", "?after_id=x", http.StatusBadRequest, nil},
+		{"limit too large", "?limit=1001", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(router, "GET", "/audit"+tt.query, admin.ID, nil, "")
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				var resp middleware.ErrorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Code != middleware.CodeBadRequest {
+					t.Errorf("error body = %s, want code %q", rec.Body, middleware.CodeBadRequest)
+				}
+				return
+			}
+
+			var resp models.AuditListResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			ids := []uint{}
+			for _, e := range resp.Data {
+				ids = append(ids, e.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.ids) {
+				t.Errorf("entries = %v, want %v", ids, tt.ids)
+			}
+		})
+	}
+
+	if rec := serve(router, "GET", "/audit", plain.ID, nil, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("status for a plain user = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if rec := serve(router, "GET", "/audit", 0, nil, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("status without a token = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
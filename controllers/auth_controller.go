@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rizqishq/Go-REST/models"
+	"github.com/rizqishq/Go-REST/services"
+	"github.com/rizqishq/Go-REST/utils"
+)
+
+// AuthController handles login and token endpoints
+type AuthController struct {
+	authService *services.AuthService
+	validator   *utils.Validator
+}
+
+// Create new AuthController
+func NewAuthController(s *services.AuthService, v *utils.Validator) *AuthController {
+	return &AuthController{authService: s, validator: v}
+}
+
+// RegisterRoutes hooks controller into router
+func (c *AuthController) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/auth/login", c.Login).Methods("POST")
+	r.HandleFunc("/auth/refresh", c.Refresh).Methods("POST")
+	r.HandleFunc("/auth/logout", c.Logout).Methods("POST")
+}
+
+// @Summary Log in
+// @Description Exchange a username and password for an access token and a refresh token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credentials body models.LoginRequest true "Credentials"
+// @Success 200 {object} models.TokenResponse
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 422 {object} middleware.ErrorResponse
+// @Failure 429 {object} middleware.ErrorResponse
+// @Router /auth/login [post]
+func (c *AuthController) Login(w http.ResponseWriter, r *http.Request) {
+	var req models.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "Invalid request body")
+		return
+	}
+	if !validateRequest(w, r, c.validator, &req) {
+		return
+	}
+
+	tokens, err := c.authService.Login(r.Context(), req)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, tokens)
+}
+
+// @Summary Refresh tokens
+// @Description Exchange a refresh token for a new token pair. Refresh tokens are single use.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token body models.RefreshRequest true "Refresh token"
+// @Success 200 {object} models.TokenResponse
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 422 {object} middleware.ErrorResponse
+// @Router /auth/refresh [post]
+func (c *AuthController) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "Invalid request body")
+		return
+	}
+	if !validateRequest(w, r, c.validator, &req) {
+		return
+	}
+
+	tokens, err := c.authService.Refresh(r.Context(), req)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, tokens)
+}
+
+// @Summary Log out
+// @Description Revoke the session a refresh token belongs to
+// @Tags auth
+// @Accept json
+// @Param token body models.RefreshRequest true "Refresh token"
+// @Success 204 "No Content"
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 422 {object} middleware.ErrorResponse
+// @Router /auth/logout [post]
+func (c *AuthController) Logout(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "Invalid request body")
+		return
+	}
+	if !validateRequest(w, r, c.validator, &req) {
+		return
+	}
+
+	if err := c.authService.Logout(r.Context(), req); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/rizqishq/Go-REST/middleware"
+	"github.com/rizqishq/Go-REST/repositories"
+	"github.com/rizqishq/Go-REST/services"
+	"github.com/rizqishq/Go-REST/utils"
+)
+
+// respondWithError renders err as an ErrorResponse with a status chosen from
+// the error's type. Errors the client cannot act on are logged and reported
+// without detail. Failures after the request's deadline passed become 504;
+// after the client disconnected, 499 is recorded and nothing is sent.
+func respondWithError(w http.ResponseWriter, r *http.Request, err error) {
+	var validationErr *services.ValidationError
+	var conflictErr *services.ConflictError
+
+	switch {
+	case errors.As(err, &validationErr):
+		details := make([]middleware.FieldError, len(validationErr.Fields))
+		for i, f := range validationErr.Fields {
+			details[i] = middleware.FieldError{Field: f.Field, Message: f.Message}
+		}
+		middleware.WriteError(w, r, http.StatusUnprocessableEntity, middleware.CodeValidation, "Request validation failed", details...)
+	case errors.As(err, &conflictErr):
+		var details []middleware.FieldError
+		if conflictErr.Field != "" {
+			details = append(details, middleware.FieldError{Field: conflictErr.Field, Message: "already exists"})
+		}
+		middleware.WriteError(w, r, http.StatusConflict, middleware.CodeConflict, conflictErr.Error(), details...)
+	case errors.Is(err, services.ErrNotFound):
+		middleware.WriteError(w, r, http.StatusNotFound, middleware.CodeNotFound, err.Error())
+	case errors.Is(err, services.ErrUnauthorized):
+		middleware.WriteError(w, r, http.StatusUnauthorized, middleware.CodeUnauthorized, err.Error())
+	case errors.Is(err, services.ErrPreconditionFailed):
+		middleware.WriteError(w, r, http.StatusPreconditionFailed, middleware.CodePreconditionFailed, err.Error())
+	case errors.Is(err, utils.ErrPatchTestFailed):
+		middleware.WriteError(w, r, http.StatusConflict, middleware.CodeConflict, err.Error())
+	case errors.Is(err, utils.ErrInvalidPatch):
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrInvalidQuery):
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeBadRequest, err.Error())
+	default:
+		if middleware.WriteContextError(w, r, err) {
+			return
+		}
+		slog.ErrorContext(r.Context(), "Request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+		middleware.WriteError(w, r, http.StatusInternalServerError, middleware.CodeInternal, "An unexpected error occurred")
+	}
+}
+
+// badRequest reports a malformed request, e.g. an unparsable body or ID
+func badRequest(w http.ResponseWriter, r *http.Request, message string) {
+	middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeBadRequest, message)
+}
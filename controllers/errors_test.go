@@ -0,0 +1,79 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rizqishq/Go-REST/middleware"
+	"github.com/rizqishq/Go-REST/models"
+	"github.com/rizqishq/Go-REST/repositories"
+)
+
+// failingQueries fails every user listing with err
+type failingQueries struct {
+	repositories.UserRepository
+	err error
+}
+
+func (r failingQueries) Query(ctx context.Context, q repositories.UserQuery) (*repositories.UserPage, error) {
+	return nil, r.err
+}
+
+func TestErrorResponses(t *testing.T) {
+	repoErr := errors.New("dial tcp 10.0.0.5:5432: connection refused")
+	tests := []struct {
+		name, method, path, body string
+		status                   int
+		code                     string
+		details                  []middleware.FieldError
+	}{
+		{"validation failure", "POST", "/users", `{"username": "", "email": "john", "password": "short"}`, http.StatusUnprocessableEntity, middleware.CodeValidation, []middleware.FieldError{
+			{Field: "username", Message: "is required"},
+			{Field: "email", Message: "must be a valid email address"},
+			{Field: "password", Message: "must be at least 8 characters"},
+		}},
+		{"missing user", "GET", "/users/999", "", http.StatusNotFound, middleware.CodeNotFound, nil},
+		{"malformed JSON", "POST", "/users", `{"username": "john",`, http.StatusBadRequest, middleware.CodeBadRequest, nil},
+		{"repository error", "GET", "/users", "", http.StatusInternalServerError, middleware.CodeInternal, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := repositories.NewInMemoryUserRepository()
+			h, _, _ := newUserAPIWith(t, failingQueries{repo, repoErr})
+			admin := &models.User{Username: "admin", Email: "admin@example.com", Role: models.RoleAdmin}
+			if err := repo.Create(context.Background(), admin); err != nil {
+				t.Fatal(err)
+			}
+
+			rec := serve(h, tt.method, tt.path, admin.ID, map[string]string{middleware.RequestIDHeader: "req-42"}, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			if strings.Contains(rec.Body.String(), "connection refused") {
+				t.Errorf("body leaks the repository error: %s", rec.Body)
+			}
+
+			var resp middleware.ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("body = %s: %v", rec.Body, err)
+			}
+			if resp.Code != tt.code || resp.Message == "" {
+				t.Errorf("code = %q, message = %q; want code %q", resp.Code, resp.Message, tt.code)
+			}
+			if !reflect.DeepEqual(resp.Details, tt.details) {
+				t.Errorf("details = %+v, want %+v", resp.Details, tt.details)
+			}
+			if resp.RequestID != "req-42" {
+				t.Errorf("request_id = %q, want req-42", resp.RequestID)
+			}
+		})
+	}
+}
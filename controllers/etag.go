@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rizqishq/Go-REST/models"
+)
+
+// userETag returns the entity tag of a user, derived from its version
+func userETag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// respondWithUser renders a user together with its ETag
+func respondWithUser(w http.ResponseWriter, status int, user *models.UserResponse) {
+	w.Header().Set("ETag", userETag(user.Version))
+	respondWithJSON(w, status, user)
+}
+
+// ifMatchVersions returns the versions listed in the If-Match header. It
+// returns nil when any version is acceptable, i.e. without the header or with
+// "*", and ok=false when the header lists no tag we could have issued.
+func ifMatchVersions(r *http.Request) (versions []uint64, ok bool) {
+	tags := entityTags(r.Header, "If-Match")
+	if tags == nil {
+		return nil, true
+	}
+	for _, tag := range tags {
+		if tag == "*" {
+			return nil, true
+		}
+		// If-Match uses the strong comparison, so weak tags never match
+		if v, ok := parseETag(tag); ok {
+			versions = append(versions, v)
+		}
+	}
+	return versions, len(versions) > 0
+}
+
+// ifNoneMatch reports whether the If-None-Match header matches etag, using
+// the weak comparison
+func ifNoneMatch(r *http.Request, etag string) bool {
+	for _, tag := range entityTags(r.Header, "If-None-Match") {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// entityTags splits the comma-separated tags of every name header
+func entityTags(h http.Header, name string) []string {
+	var tags []string
+	for _, value := range h.Values(name) {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// parseETag reads the version from a strong tag made by userETag
+func parseETag(tag string) (uint64, bool) {
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(tag[1:len(tag)-1], 10, 64)
+	return v, err == nil
+}
@@ -1,70 +1,164 @@
 package controllers
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/rizqishq/Go-REST/middleware"
 	"github.com/rizqishq/Go-REST/models"
+	"github.com/rizqishq/Go-REST/repositories"
 	"github.com/rizqishq/Go-REST/services"
+	"github.com/rizqishq/Go-REST/utils"
 )
 
 // UserController handles user-related endpoints
 type UserController struct {
 	userService *services.UserService
+	validator   *utils.Validator
 }
 
 // Create new UserController
-func NewUserController(s *services.UserService) *UserController {
-	return &UserController{userService: s}
+func NewUserController(s *services.UserService, v *utils.Validator) *UserController {
+	return &UserController{userService: s, validator: v}
 }
 
-// RegisterRoutes hooks controller into router
-func (c *UserController) RegisterRoutes(r *mux.Router) {
-	r.HandleFunc("/users", c.GetAllUsers).Methods("GET")
-	r.HandleFunc("/users/{id:[0-9]+}", c.GetUserByID).Methods("GET")
-	r.HandleFunc("/users", c.CreateUser).Methods("POST")
-	r.HandleFunc("/users/{id:[0-9]+}", c.UpdateUser).Methods("PUT")
-	r.HandleFunc("/users/{id:[0-9]+}", c.DeleteUser).Methods("DELETE")
+// RegisterRoutes hooks controller into router. Registration via POST /users
+// is public; every other route is authenticated and then authorized by the
+// permission declared next to it. Users may always read and update themselves.
+// Changes are attributed to the signed-in user in the audit log.
+func (c *UserController) RegisterRoutes(r *mux.Router, authenticate mux.MiddlewareFunc) {
+	protect := func(h http.HandlerFunc, authorize mux.MiddlewareFunc) http.Handler {
+		return authenticate(authorize(withAuditInfo(h)))
+	}
+
+	r.Handle("/users", protect(c.GetAllUsers, middleware.RequirePermission(models.PermUsersList))).Methods("GET")
+	r.Handle("/users/{id:[0-9]+}", protect(c.GetUserByID, middleware.RequireSelfOrPermission(models.PermUsersRead))).Methods("GET")
+	r.Handle("/users", withAuditInfo(c.CreateUser)).Methods("POST")
+	r.Handle("/users/{id:[0-9]+}", protect(c.UpdateUser, middleware.RequireSelfOrPermission(models.PermUsersUpdate))).Methods("PUT")
+	r.Handle("/users/{id:[0-9]+}", protect(c.PatchUser, middleware.RequireSelfOrPermission(models.PermUsersUpdate))).Methods("PATCH")
+	r.Handle("/users/{id:[0-9]+}", protect(c.DeleteUser, middleware.RequirePermission(models.PermUsersDelete))).Methods("DELETE")
+	r.Handle("/users/{id:[0-9]+}/role", protect(c.UpdateUserRole, middleware.RequirePermission(models.PermUsersManageRoles))).Methods("PUT")
+	r.Handle("/users/deleted", protect(c.GetDeletedUsers, middleware.RequirePermission(models.PermUsersManageDeleted))).Methods("GET")
+	r.Handle("/users/{id:[0-9]+}/restore", protect(c.RestoreUser, middleware.RequirePermission(models.PermUsersManageDeleted))).Methods("POST")
 }
 
-// @Summary Get all users
-// @Description Get a list of all users
+// Page size limits for GET /users
+const (
+	defaultPageSize = 50
+	maxPageSize     = 1000
+)
+
+// @Summary List users
+// @Description List users with filtering, sorting and cursor pagination
 // @Tags users
 // @Produce json
-// @Success 200 {array} models.UserResponse
+// @Param limit query int false "Page size (default 50, max 1000)"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param sort query string false "Comma-separated fields, prefix with - for descending, e.g. created_at,-username"
+// @Param username query string false "Exact username (case-insensitive)"
+// @Param email query string false "Exact email (case-insensitive)"
+// @Param created_after query string false "RFC 3339 timestamp"
+// @Success 200 {object} models.UserListResponse
+// @Failure 400 {object} middleware.ErrorResponse
+// @Security BearerAuth
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 403 {object} middleware.ErrorResponse
 // @Router /users [get]
 func (c *UserController) GetAllUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := c.userService.GetAllUsers(r.Context())
+	q, err := parseUserQuery(r.URL.Query())
+	if err != nil {
+		badRequest(w, r, err.Error())
+		return
+	}
+
+	users, err := c.userService.ListUsers(r.Context(), q)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondWithError(w, r, err)
 		return
 	}
 	respondWithJSON(w, http.StatusOK, users)
 }
 
+// parseUserQuery reads the GET /users query parameters
+func parseUserQuery(values url.Values) (repositories.UserQuery, error) {
+	q := repositories.UserQuery{
+		Username: values.Get("username"),
+		Email:    values.Get("email"),
+		Cursor:   values.Get("cursor"),
+		Limit:    defaultPageSize,
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		q.Limit = limit
+	}
+
+	if v := values.Get("created_after"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return q, errors.New("created_after must be an RFC 3339 timestamp")
+		}
+		q.CreatedAfter = t
+	}
+
+	if v := values.Get("sort"); v != "" {
+		for _, field := range strings.Split(v, ",") {
+			field = strings.TrimSpace(field)
+			desc := strings.HasPrefix(field, "-")
+			q.Sort = append(q.Sort, repositories.SortField{
+				Field: strings.TrimPrefix(field, "-"),
+				Desc:  desc,
+			})
+		}
+	}
+	return q, nil
+}
+
 // @Summary Get a user by ID
 // @Description Get user details by ID
 // @Tags users
 // @Produce json
 // @Param id path int true "User ID"
+// @Param If-None-Match header string false "ETag from an earlier response"
 // @Success 200 {object} models.UserResponse
+// @Header 200 {string} ETag "Current version of the user"
+// @Success 304 "Not Modified"
 // @Failure 404 {object} middleware.ErrorResponse
+// @Security BearerAuth
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 403 {object} middleware.ErrorResponse
 // @Router /users/{id} [get]
 func (c *UserController) GetUserByID(w http.ResponseWriter, r *http.Request) {
 	idStr := mux.Vars(r)["id"]
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		badRequest(w, r, "Invalid user ID")
 		return
 	}
 	user, err := c.userService.GetUserByID(r.Context(), uint(id))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		respondWithError(w, r, err)
 		return
 	}
-	respondWithJSON(w, http.StatusOK, user)
+	if ifNoneMatch(r, userETag(user.Version)) {
+		w.Header().Set("ETag", userETag(user.Version))
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	respondWithUser(w, http.StatusOK, user)
 }
 
 // @Summary Create a new user
@@ -75,74 +169,289 @@ func (c *UserController) GetUserByID(w http.ResponseWriter, r *http.Request) {
 // @Param user body models.CreateUserRequest true "User Data"
 // @Success 201 {object} models.UserResponse
 // @Failure 400 {object} middleware.ErrorResponse
+// @Failure 409 {object} middleware.ErrorResponse
+// @Failure 422 {object} middleware.ErrorResponse
+// @Failure 429 {object} middleware.ErrorResponse
 // @Router /users [post]
 func (c *UserController) CreateUser(w http.ResponseWriter, r *http.Request) {
 	var req models.CreateUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		badRequest(w, r, "Invalid request body")
+		return
+	}
+	if !validateRequest(w, r, c.validator, &req) {
 		return
 	}
 
 	user, err := c.userService.CreateUser(r.Context(), req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		respondWithError(w, r, err)
 		return
 	}
-	respondWithJSON(w, http.StatusCreated, user)
+	respondWithUser(w, http.StatusCreated, user)
 }
 
-// @Summary Update an existing user
-// @Description Update user data by ID
+// @Summary Replace an existing user
+// @Description Replace user data by ID. Omitted names are cleared; the password is kept unless given.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param id path int true "User ID"
 // @Param user body models.UpdateUserRequest true "Updated data"
+// @Param If-Match header string false "Only update if the user still has this ETag"
 // @Success 200 {object} models.UserResponse
+// @Header 200 {string} ETag "New version of the user"
 // @Failure 400 {object} middleware.ErrorResponse
+// @Security BearerAuth
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 403 {object} middleware.ErrorResponse
+// @Failure 404 {object} middleware.ErrorResponse
+// @Failure 409 {object} middleware.ErrorResponse
+// @Failure 412 {object} middleware.ErrorResponse
+// @Failure 422 {object} middleware.ErrorResponse
 // @Router /users/{id} [put]
 func (c *UserController) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	idStr := mux.Vars(r)["id"]
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		badRequest(w, r, "Invalid user ID")
 		return
 	}
 	var req models.UpdateUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		badRequest(w, r, "Invalid request body")
+		return
+	}
+	if !validateRequest(w, r, c.validator, &req) {
 		return
 	}
-	user, err := c.userService.UpdateUser(r.Context(), uint(id), req)
+	versions, ok := ifMatchVersions(r)
+	if !ok {
+		respondWithError(w, r, services.ErrVersionMismatch)
+		return
+	}
+	user, err := c.userService.UpdateUser(r.Context(), uint(id), req, versions)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		respondWithError(w, r, err)
 		return
 	}
-	respondWithJSON(w, http.StatusOK, user)
+	respondWithUser(w, http.StatusOK, user)
+}
+
+// Media types accepted by PATCH /users/{id}
+const (
+	mediaTypeMergePatch = "application/merge-patch+json"
+	mediaTypeJSONPatch  = "application/json-patch+json"
+)
+
+// @Summary Partially update a user
+// @Description Apply a JSON Merge Patch (RFC 7396) or JSON Patch (RFC 6902) to the fields of models.UpdateUserRequest. null clears a field. The patch is based on what the client last read, so If-Match is required.
+// @Tags users
+// @Accept application/merge-patch+json
+// @Accept application/json-patch+json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param patch body object true "Merge patch object or JSON Patch operations"
+// @Param If-Match header string true "Only update if the user still has this ETag"
+// @Success 200 {object} models.UserResponse
+// @Header 200 {string} ETag "New version of the user"
+// @Failure 400 {object} middleware.ErrorResponse
+// @Security BearerAuth
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 403 {object} middleware.ErrorResponse
+// @Failure 404 {object} middleware.ErrorResponse
+// @Failure 409 {object} middleware.ErrorResponse
+// @Failure 412 {object} middleware.ErrorResponse
+// @Failure 415 {object} middleware.ErrorResponse
+// @Failure 422 {object} middleware.ErrorResponse
+// @Failure 428 {object} middleware.ErrorResponse
+// @Router /users/{id} [patch]
+func (c *UserController) PatchUser(w http.ResponseWriter, r *http.Request) {
+	idStr := mux.Vars(r)["id"]
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		badRequest(w, r, "Invalid user ID")
+		return
+	}
+
+	var apply func(doc, patch []byte) ([]byte, error)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case mediaTypeMergePatch:
+		apply = utils.MergePatch
+	case mediaTypeJSONPatch:
+		apply = utils.ApplyJSONPatch
+	default:
+		w.Header().Set("Accept-Patch", mediaTypeMergePatch+", "+mediaTypeJSONPatch)
+		middleware.WriteError(w, r, http.StatusUnsupportedMediaType, middleware.CodeUnsupportedMedia,
+			"Content-Type must be "+mediaTypeMergePatch+" or "+mediaTypeJSONPatch)
+		return
+	}
+
+	if entityTags(r.Header, "If-Match") == nil {
+		middleware.WriteError(w, r, http.StatusPreconditionRequired, middleware.CodePreconditionRequired,
+			"If-Match with the user's ETag is required")
+		return
+	}
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		badRequest(w, r, "Invalid request body")
+		return
+	}
+
+	versions, ok := ifMatchVersions(r)
+	if !ok {
+		respondWithError(w, r, services.ErrVersionMismatch)
+		return
+	}
+
+	user, err := c.userService.PatchUser(r.Context(), uint(id), versions, func(current models.UpdateUserRequest) (models.UpdateUserRequest, error) {
+		doc, err := json.Marshal(current)
+		if err != nil {
+			return current, err
+		}
+		patched, err := apply(doc, patch)
+		if err != nil {
+			return current, err
+		}
+		return c.decodePatchedUser(patched)
+	})
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	respondWithUser(w, http.StatusOK, user)
+}
+
+// decodePatchedUser checks that a patched document is still a valid
+// replacement for the user
+func (c *UserController) decodePatchedUser(data []byte) (models.UpdateUserRequest, error) {
+	var req models.UpdateUserRequest
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &typeErr) && typeErr.Field != "":
+			return req, &services.ValidationError{Fields: []services.FieldError{{Field: typeErr.Field, Message: "must be a string"}}}
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+			return req, &services.ValidationError{Fields: []services.FieldError{{Field: field, Message: "cannot be changed"}}}
+		}
+		return req, fmt.Errorf("%w: result must be a JSON object", utils.ErrInvalidPatch)
+	}
+	return req, validationError(c.validator, &req)
 }
 
 // @Summary Delete a user
-// @Description Delete a user by ID
+// @Description Soft-delete a user by ID. The user can no longer sign in and is hidden from other endpoints, but keeps its username and email until it is restored or purged after the retention period.
 // @Tags users
 // @Produce json
 // @Param id path int true "User ID"
 // @Success 204 "No Content"
 // @Failure 404 {object} middleware.ErrorResponse
+// @Security BearerAuth
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 403 {object} middleware.ErrorResponse
 // @Router /users/{id} [delete]
 func (c *UserController) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	idStr := mux.Vars(r)["id"]
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		badRequest(w, r, "Invalid user ID")
 		return
 	}
 	if err := c.userService.DeleteUser(r.Context(), uint(id)); err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		respondWithError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// @Summary List deleted users
+// @Description List soft-deleted users that have not been purged yet
+// @Tags users
+// @Produce json
+// @Success 200 {object} models.UserListResponse
+// @Security BearerAuth
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 403 {object} middleware.ErrorResponse
+// @Router /users/deleted [get]
+func (c *UserController) GetDeletedUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := c.userService.ListDeletedUsers(r.Context())
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, users)
+}
+
+// @Summary Restore a deleted user
+// @Description Undo the soft deletion of a user
+// @Tags users
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} models.UserResponse
+// @Header 200 {string} ETag "New version of the user"
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 404 {object} middleware.ErrorResponse
+// @Security BearerAuth
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 403 {object} middleware.ErrorResponse
+// @Router /users/{id}/restore [post]
+func (c *UserController) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	idStr := mux.Vars(r)["id"]
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		badRequest(w, r, "Invalid user ID")
+		return
+	}
+	user, err := c.userService.RestoreUser(r.Context(), uint(id))
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	respondWithUser(w, http.StatusOK, user)
+}
+
+// @Summary Change a user's role
+// @Description Replace the role and explicit permissions of a user
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param role body models.UpdateRoleRequest true "Role and permissions"
+// @Success 200 {object} models.UserResponse
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 403 {object} middleware.ErrorResponse
+// @Failure 404 {object} middleware.ErrorResponse
+// @Failure 422 {object} middleware.ErrorResponse
+// @Security BearerAuth
+// @Router /users/{id}/role [put]
+func (c *UserController) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	idStr := mux.Vars(r)["id"]
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		badRequest(w, r, "Invalid user ID")
+		return
+	}
+	var req models.UpdateRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "Invalid request body")
+		return
+	}
+	if !validateRequest(w, r, c.validator, &req) {
+		return
+	}
+	user, err := c.userService.SetRole(r.Context(), uint(id), req)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	respondWithUser(w, http.StatusOK, user)
+}
+
 func respondWithJSON(w http.ResponseWriter, status int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -0,0 +1,419 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/rizqishq/Go-REST/controllers"
+	"github.com/rizqishq/Go-REST/middleware"
+	"github.com/rizqishq/Go-REST/models"
+	"github.com/rizqishq/Go-REST/repositories"
+	"github.com/rizqishq/Go-REST/services"
+	"github.com/rizqishq/Go-REST/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// tokenIsID accepts a user's ID as their bearer token
+type tokenIsID struct {
+	repo repositories.UserRepository
+}
+
+func (v tokenIsID) VerifyAccessToken(ctx context.Context, token string) (*models.User, error) {
+	id, err := strconv.ParseUint(token, 10, 32)
+	if err != nil {
+		return nil, errors.New("not a user ID")
+	}
+	return v.repo.FindByID(ctx, uint(id))
+}
+
+// newUserAPI serves the user routes from an in-memory repository. Requests
+// authenticate with "Authorization: Bearer <user ID>".
+func newUserAPI(t *testing.T) (http.Handler, *services.UserService, repositories.UserRepository) {
+	t.Helper()
+	return newUserAPIWith(t, repositories.NewInMemoryUserRepository())
+}
+
+// newUserAPIWith serves the user routes from repo
+func newUserAPIWith(t *testing.T, repo repositories.UserRepository) (http.Handler, *services.UserService, repositories.UserRepository) {
+	t.Helper()
+	users, err := services.NewUserService(repo, repositories.NewInMemoryAuditRepository(), repositories.NewInMemoryTransactor(), utils.NewBcryptHasher(bcrypt.MinCost))
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator := utils.NewValidator(utils.PasswordPolicy{MinLength: 8, MaxLength: 72})
+
+	router := mux.NewRouter()
+	router.Use(middleware.RequestIDMiddleware)
+	controllers.NewUserController(users, validator).RegisterRoutes(router, middleware.AuthMiddleware(tokenIsID{repo}))
+	return router, users, repo
+}
+
+func createUser(t *testing.T, users *services.UserService, username string) *models.UserResponse {
+	t.Helper()
+	user, err := users.CreateUser(context.Background(), models.CreateUserRequest{
+		Username:  username,
+		Email:     username + "@example.com",
+		Password:  "password1",
+		FirstName: "First",
+		LastName:  "Last",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// serve sends a request as the user with ID asUser, or anonymously for 0
+func serve(h http.Handler, method, path string, asUser uint, headers map[string]string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if asUser != 0 {
+		req.Header.Set("Authorization", "Bearer "+strconv.FormatUint(uint64(asUser), 10))
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPatchUser(t *testing.T) {
+	tests := []struct {
+		name, contentType, ifMatch, body string
+		status                           int
+		code                             string
+		lastName                         string
+	}{
+		{"merge patch null clears", "application/merge-patch+json", `"1"`, `{"last_name": null}`, http.StatusOK, "", ""},
+		{"merge patch sets", "application/merge-patch+json", `"1"`, `{"last_name": "Smith"}`, http.StatusOK, "", "Smith"},
+		{"JSON Patch replace with null clears", "application/json-patch+json", `"1"`, `[{"op": "replace", "path": "/last_name", "value": null}]`, http.StatusOK, "", ""},
+		{"JSON Patch test and replace", "application/json-patch+json", `*`, `[{"op": "test", "path": "/last_name", "value": "Last"}, {"op": "replace", "path": "/last_name", "value": "Smith"}]`, http.StatusOK, "", "Smith"},
+		{"JSON Patch test fails", "application/json-patch+json", `"1"`, `[{"op": "test", "path": "/last_name", "value": "Other"}]`, http.StatusConflict, middleware.CodeConflict, "Last"},
+		{"invalid pointer", "application/json-patch+json", `"1"`, `[{"op": "replace", "path": "last_name", "value": "x"}]`, http.StatusBadRequest, middleware.CodeBadRequest, "Last"},
+		{"missing member", "application/json-patch+json", `"1"`, `[{"op": "remove", "path": "/nickname"}]`, http.StatusBadRequest, middleware.CodeBadRequest, "Last"},
+		{"field that cannot change", "application/merge-patch+json", `"1"`, `{"role": "admin"}`, http.StatusUnprocessableEntity, middleware.CodeValidation, "Last"},
+		{"invalid result", "application/merge-patch+json", `"1"`, `{"email": null}`, http.StatusUnprocessableEntity, middleware.CodeValidation, "Last"},
+		{"unsupported content type", "application/json", `"1"`, `{"last_name": null}`, http.StatusUnsupportedMediaType, middleware.CodeUnsupportedMedia, "Last"},
+		{"without If-Match", "application/merge-patch+json", "", `{"last_name": null}`, http.StatusPreconditionRequired, middleware.CodePreconditionRequired, "Last"},
+		{"stale If-Match", "application/merge-patch+json", `"2"`, `{"last_name": null}`, http.StatusPreconditionFailed, middleware.CodePreconditionFailed, "Last"},
+		{"weak If-Match", "application/merge-patch+json", `W/"1"`, `{"last_name": null}`, http.StatusPreconditionFailed, middleware.CodePreconditionFailed, "Last"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, users, _ := newUserAPI(t)
+			user := createUser(t, users, "john")
+
+			headers := map[string]string{"Content-Type": tt.contentType}
+			if tt.ifMatch != "" {
+				headers["If-Match"] = tt.ifMatch
+			}
+			path := "/users/" + strconv.FormatUint(uint64(user.ID), 10)
+			rec := serve(h, "PATCH", path, user.ID, headers, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+
+			if tt.status == http.StatusOK {
+				if etag := rec.Header().Get("ETag"); etag != `"2"` {
+					t.Errorf("ETag = %s, want \"2\"", etag)
+				}
+			} else {
+				var resp middleware.ErrorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Code != tt.code {
+					t.Errorf("error body = %s, want code %q", rec.Body, tt.code)
+				}
+			}
+
+			got, err := users.GetUserByID(context.Background(), user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.LastName != tt.lastName {
+				t.Errorf("last name = %q, want %q", got.LastName, tt.lastName)
+			}
+		})
+	}
+}
+
+func TestUserRoutesAuthorization(t *testing.T) {
+	const (
+		putBody   = `{"username": "{user}", "email": "{user}@example.com", "first_name": "Changed"}`
+		patchBody = `{"first_name": "Changed"}`
+		roleBody  = `{"role": "admin"}`
+	)
+	tests := []struct {
+		name, as, method, path, body string
+		status                       int
+	}{
+		{"user lists users", "john", "GET", "/users", "", http.StatusForbidden},
+		{"user reads other user", "john", "GET", "/users/{jane}", "", http.StatusForbidden},
+		{"user replaces other user", "john", "PUT", "/users/{jane}", putBody, http.StatusForbidden},
+		{"user patches other user", "john", "PATCH", "/users/{jane}", patchBody, http.StatusForbidden},
+		{"user deletes other user", "john", "DELETE", "/users/{jane}", "", http.StatusForbidden},
+		{"user sets other role", "john", "PUT", "/users/{jane}/role", roleBody, http.StatusForbidden},
+		{"user lists deleted users", "john", "GET", "/users/deleted", "", http.StatusForbidden},
+		{"user restores user", "john", "POST", "/users/{old}/restore", "", http.StatusForbidden},
+
+		{"user reads self", "john", "GET", "/users/{john}", "", http.StatusOK},
+		{"user replaces self", "john", "PUT", "/users/{john}", putBody, http.StatusOK},
+		{"user patches self", "john", "PATCH", "/users/{john}", patchBody, http.StatusOK},
+		{"user deletes self", "john", "DELETE", "/users/{john}", "", http.StatusForbidden},
+		{"user promotes self", "john", "PUT", "/users/{john}/role", roleBody, http.StatusForbidden},
+
+		{"admin lists users", "admin", "GET", "/users", "", http.StatusOK},
+		{"admin reads other user", "admin", "GET", "/users/{jane}", "", http.StatusOK},
+		{"admin replaces other user", "admin", "PUT", "/users/{jane}", putBody, http.StatusOK},
+		{"admin patches other user", "admin", "PATCH", "/users/{jane}", patchBody, http.StatusOK},
+		{"admin deletes other user", "admin", "DELETE", "/users/{jane}", "", http.StatusNoContent},
+		{"admin sets other role", "admin", "PUT", "/users/{jane}/role", roleBody, http.StatusOK},
+		{"admin lists deleted users", "admin", "GET", "/users/deleted", "", http.StatusOK},
+		{"admin restores user", "admin", "POST", "/users/{old}/restore", "", http.StatusOK},
+
+		{"unknown role lists users", "ghost", "GET", "/users", "", http.StatusForbidden},
+		{"unknown role reads other user", "ghost", "GET", "/users/{jane}", "", http.StatusForbidden},
+		{"unknown role deletes other user", "ghost", "DELETE", "/users/{jane}", "", http.StatusForbidden},
+		{"unknown role sets own role", "ghost", "PUT", "/users/{ghost}/role", roleBody, http.StatusForbidden},
+
+		{"anonymous reads user", "", "GET", "/users/{jane}", "", http.StatusUnauthorized},
+		{"anonymous lists users", "", "GET", "/users", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			h, users, repo := newUserAPI(t)
+			ids := map[string]uint{}
+			for _, name := range []string{"john", "jane", "old"} {
+				ids[name] = createUser(t, users, name).ID
+			}
+			if err := users.DeleteUser(ctx, ids["old"]); err != nil {
+				t.Fatal(err)
+			}
+			// Roles cannot be set on sign-up, so store these accounts directly
+			for name, role := range map[string]models.Role{"admin": models.RoleAdmin, "ghost": "superuser"} {
+				user := &models.User{Username: name, Email: name + "@example.com", Role: role}
+				if err := repo.Create(ctx, user); err != nil {
+					t.Fatal(err)
+				}
+				ids[name] = user.ID
+			}
+
+			path := tt.path
+			target := tt.as
+			for name, id := range ids {
+				if strings.Contains(path, "{"+name+"}") {
+					target = name
+				}
+				path = strings.ReplaceAll(path, "{"+name+"}", strconv.FormatUint(uint64(id), 10))
+			}
+			headers := map[string]string{"If-Match": `"1"`}
+			if tt.method == "PATCH" {
+				headers["Content-Type"] = "application/merge-patch+json"
+			}
+			rec := serve(h, tt.method, path, ids[tt.as], headers, strings.ReplaceAll(tt.body, "{user}", target))
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
+
+func TestUpdateUserConflict(t *testing.T) {
+	h, users, _ := newUserAPI(t)
+	john := createUser(t, users, "john")
+	createUser(t, users, "jane")
+
+	path := "/users/" + strconv.FormatUint(uint64(john.ID), 10)
+	rec := serve(h, "PUT", path, john.ID, nil, `{"username": "john", "email": "Jane@example.com"}`)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusConflict, rec.Body)
+	}
+	var resp middleware.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != middleware.CodeConflict || len(resp.Details) != 1 || resp.Details[0].Field != "email" {
+		t.Errorf("error body = %s, want a conflict on email", rec.Body)
+	}
+}
+
+func TestGetUserIfNoneMatch(t *testing.T) {
+	tests := []struct {
+		name, ifNoneMatch string
+		status            int
+	}{
+		{"without If-None-Match", "", http.StatusOK},
+		{"current tag", `"1"`, http.StatusNotModified},
+		{"weak current tag", `W/"1"`, http.StatusNotModified},
+		{"other tag", `"2"`, http.StatusOK},
+		{"any tag", `*`, http.StatusNotModified},
+		{"list with current tag", `"3", W/"1"`, http.StatusNotModified},
+		{"list without current tag", `"2","3"`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, users, _ := newUserAPI(t)
+			user := createUser(t, users, "john")
+
+			var headers map[string]string
+			if tt.ifNoneMatch != "" {
+				headers = map[string]string{"If-None-Match": tt.ifNoneMatch}
+			}
+			rec := serve(h, "GET", "/users/"+strconv.FormatUint(uint64(user.ID), 10), user.ID, headers, "")
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if etag := rec.Header().Get("ETag"); etag != `"1"` {
+				t.Errorf("ETag = %s, want \"1\"", etag)
+			}
+			if tt.status == http.StatusNotModified && rec.Body.Len() != 0 {
+				t.Errorf("304 response has a body: %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestUpdateUserIfMatch(t *testing.T) {
+	tests := []struct {
+		name, ifMatch string
+		status        int
+	}{
+		{"without If-Match", "", http.StatusOK},
+		{"current tag", `"1"`, http.StatusOK},
+		{"list with current tag", `"0", "1"`, http.StatusOK},
+		{"any tag", `*`, http.StatusOK},
+		{"stale tag", `"2"`, http.StatusPreconditionFailed},
+		{"weak current tag", `W/"1"`, http.StatusPreconditionFailed},
+		{"tag we never issue", `"abc"`, http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, users, _ := newUserAPI(t)
+			user := createUser(t, users, "john")
+
+			var headers map[string]string
+			if tt.ifMatch != "" {
+				headers = map[string]string{"If-Match": tt.ifMatch}
+			}
+			path := "/users/" + strconv.FormatUint(uint64(user.ID), 10)
+			rec := serve(h, "PUT", path, user.ID, headers, `{"username": "john", "email": "john@example.com", "first_name": "Changed"}`)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+
+			got, err := users.GetUserByID(context.Background(), user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.status == http.StatusOK {
+				if etag := rec.Header().Get("ETag"); etag != `"2"` {
+					t.Errorf("ETag = %s, want \"2\"", etag)
+				}
+				if got.FirstName != "Changed" || got.Version != 2 {
+					t.Errorf("stored user = %+v, want it updated to version 2", got)
+				}
+				return
+			}
+			var resp middleware.ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Code != middleware.CodePreconditionFailed {
+				t.Errorf("error body = %s, want code %q", rec.Body, middleware.CodePreconditionFailed)
+			}
+			if got.FirstName != "First" || got.Version != 1 {
+				t.Errorf("stored user = %+v, want it unchanged", got)
+			}
+		})
+	}
+}
+
+func TestDeletedUserRoutes(t *testing.T) {
+	ctx := context.Background()
+	h, users, repo := newUserAPI(t)
+	admin := &models.User{Username: "admin", Email: "admin@example.com", Role: models.RoleAdmin}
+	if err := repo.Create(ctx, admin); err != nil {
+		t.Fatal(err)
+	}
+	john := createUser(t, users, "john")
+	old := createUser(t, users, "old")
+	older := createUser(t, users, "older")
+	for _, id := range []uint{older.ID, old.ID} {
+		if err := users.DeleteUser(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	listDeleted := func() []uint {
+		t.Helper()
+		rec := serve(h, "GET", "/users/deleted", admin.ID, nil, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /users/deleted status = %d: %s", rec.Code, rec.Body)
+		}
+		var resp models.UserListResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		ids := []uint{}
+		for _, user := range resp.Data {
+			if user.DeletedAt == nil {
+				t.Errorf("listed user %d has no deleted_at", user.ID)
+			}
+			ids = append(ids, user.ID)
+		}
+		if resp.Total != len(ids) {
+			t.Errorf("total = %d, want %d", resp.Total, len(ids))
+		}
+		return ids
+	}
+	if got, want := listDeleted(), []uint{old.ID, older.ID}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("deleted users = %v, want %v", got, want)
+	}
+
+	restore := func(id string) *httptest.ResponseRecorder {
+		return serve(h, "POST", "/users/"+id+"/restore", admin.ID, nil, "")
+	}
+	rec := restore(strconv.FormatUint(uint64(old.ID), 10))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("restore status = %d: %s", rec.Code, rec.Body)
+	}
+	if etag := rec.Header().Get("ETag"); etag != `"3"` {
+		t.Errorf("ETag = %s, want \"3\"", etag)
+	}
+	var restored models.UserResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &restored); err != nil || restored.ID != old.ID || restored.DeletedAt != nil {
+		t.Errorf("restored user = %s", rec.Body)
+	}
+	if rec := serve(h, "GET", "/users/"+strconv.FormatUint(uint64(old.ID), 10), admin.ID, nil, ""); rec.Code != http.StatusOK {
+		t.Errorf("GET restored user status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got, want := listDeleted(), []uint{older.ID}; !reflect.DeepEqual(got, want) {
+		t.Errorf("deleted users after restore = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		name, id string
+		status   int
+		code     string
+	}{
+		{"already restored", strconv.FormatUint(uint64(old.ID), 10), http.StatusNotFound, middleware.CodeNotFound},
+		{"active user", strconv.FormatUint(uint64(john.ID), 10), http.StatusNotFound, middleware.CodeNotFound},
+		{"missing user", "999", http.StatusNotFound, middleware.CodeNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := restore(tt.id)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			var resp middleware.ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Code != tt.code {
+				t.Errorf("error body = %s, want code %q", rec.Body, tt.code)
+			}
+		})
+	}
+}
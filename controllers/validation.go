@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/rizqishq/Go-REST/models"
+	"github.com/rizqishq/Go-REST/services"
+	"github.com/rizqishq/Go-REST/utils"
+)
+
+// ValidatedRequests are the request bodies the controllers validate; register
+// them with the Validator on startup to catch malformed validate tags early
+var ValidatedRequests = []any{
+	models.LoginRequest{},
+	models.RefreshRequest{},
+	models.CreateUserRequest{},
+	models.UpdateUserRequest{},
+	models.UpdateRoleRequest{},
+}
+
+// validateRequest checks req against its validate tags before it reaches a
+// service. On failure it renders every violation and returns false.
+func validateRequest(w http.ResponseWriter, r *http.Request, validator *utils.Validator, req any) bool {
+	if err := validationError(validator, req); err != nil {
+		respondWithError(w, r, err)
+		return false
+	}
+	return true
+}
+
+// validationError returns a *services.ValidationError listing every rule req
+// breaks, or nil
+func validationError(validator *utils.Validator, req any) error {
+	violations, err := validator.Validate(req)
+	if err != nil || len(violations) == 0 {
+		return err
+	}
+
+	fields := make([]services.FieldError, len(violations))
+	for i, v := range violations {
+		fields[i] = services.FieldError{Field: v.Field, Message: v.Message}
+	}
+	return &services.ValidationError{Fields: fields}
+}
@@ -0,0 +1,14 @@
+package controllers_test
+
+import (
+	"testing"
+
+	"github.com/rizqishq/Go-REST/controllers"
+	"github.com/rizqishq/Go-REST/utils"
+)
+
+func TestValidatedRequestsHaveValidTags(t *testing.T) {
+	if err := utils.NewValidator(utils.PasswordPolicy{}).Register(controllers.ValidatedRequests...); err != nil {
+		t.Error(err)
+	}
+}
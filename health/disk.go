@@ -0,0 +1,29 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// errNoDiskStats is returned by freeSpace on platforms without file system
+// statistics
+var errNoDiskStats = errors.New("free disk space is not available on this platform")
+
+// DiskSpace checks that the file system holding dir has at least minFree
+// bytes available. It always passes where free space cannot be measured.
+func DiskSpace(dir string, minFree uint64) Check {
+	return func(ctx context.Context) error {
+		free, err := freeSpace(dir)
+		if errors.Is(err, errNoDiskStats) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("%d MiB free in %s, need %d MiB", free>>20, dir, minFree>>20)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,25 @@
+//go:build linux || darwin || freebsd
+
+package health_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/rizqishq/Go-REST/health"
+)
+
+func TestDiskSpace(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	if err := health.DiskSpace(dir, 1)(ctx); err != nil {
+		t.Errorf("DiskSpace(1 byte) = %v", err)
+	}
+	if err := health.DiskSpace(dir, math.MaxUint64)(ctx); err == nil {
+		t.Error("DiskSpace(max) passed")
+	}
+	if err := health.DiskSpace(dir+"/missing", 1)(ctx); err == nil {
+		t.Error("DiskSpace of a missing directory passed")
+	}
+}
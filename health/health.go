@@ -0,0 +1,179 @@
+// Package health answers liveness and readiness probes. Subsystems register
+// checks of their dependencies in a Registry; the process is ready while all
+// of them pass and it is not shutting down.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Statuses reported in Response and CheckResult
+const (
+	StatusOK           = "ok"
+	StatusFailing      = "failing"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Check reports whether a dependency is usable. It should return soon after
+// ctx is done.
+type Check func(ctx context.Context) error
+
+// Response is the body of liveness and readiness probes
+type Response struct {
+	Status        string                 `json:"status" example:"ok"`
+	Version       string                 `json:"version" example:"1.4.0"`
+	Uptime        string                 `json:"uptime" example:"3h25m10s"`
+	UptimeSeconds float64                `json:"uptime_seconds" example:"12310"`
+	Checks        map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// CheckResult is the outcome of one registered check
+type CheckResult struct {
+	Status     string  `json:"status" example:"ok"`
+	DurationMS float64 `json:"duration_ms" example:"0.42"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Registry holds the checks that decide readiness
+type Registry struct {
+	version string
+	start   time.Time
+	timeout time.Duration
+
+	mutex        sync.RWMutex
+	checks       map[string]Check
+	shuttingDown atomic.Bool
+}
+
+// Create new Registry. Every check gets at most timeout to complete.
+func NewRegistry(version string, timeout time.Duration) *Registry {
+	return &Registry{
+		version: version,
+		start:   time.Now(),
+		timeout: timeout,
+		checks:  make(map[string]Check),
+	}
+}
+
+// Register adds a check under name. It panics if the name is taken.
+func (r *Registry) Register(name string, check Check) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.checks[name]; ok {
+		panic(fmt.Sprintf("health: check %q registered twice", name))
+	}
+	r.checks[name] = check
+}
+
+// ShutDown makes readiness fail from now on, so load balancers stop sending
+// new requests while those in flight complete
+func (r *Registry) ShutDown() {
+	r.shuttingDown.Store(true)
+}
+
+// Live reports that the process is running, without running any checks
+func (r *Registry) Live() Response {
+	return r.response(StatusOK)
+}
+
+// Ready runs every check concurrently and reports whether all passed. Once
+// ShutDown has been called it fails without running them.
+func (r *Registry) Ready(ctx context.Context) Response {
+	if r.shuttingDown.Load() {
+		return r.response(StatusShuttingDown)
+	}
+
+	r.mutex.RLock()
+	names := slices.Sorted(maps.Keys(r.checks))
+	checks := make([]Check, len(names))
+	for i, name := range names {
+		checks[i] = r.checks[name]
+	}
+	r.mutex.RUnlock()
+
+	results := make([]CheckResult, len(names))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = r.run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	resp := r.response(StatusOK)
+	resp.Checks = make(map[string]CheckResult, len(names))
+	for i, name := range names {
+		resp.Checks[name] = results[i]
+		if results[i].Status != StatusOK {
+			resp.Status = StatusFailing
+		}
+	}
+	return resp
+}
+
+func (r *Registry) run(ctx context.Context, check Check) CheckResult {
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	err := check(ctx)
+	result := CheckResult{
+		Status:     StatusOK,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFailing
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (r *Registry) response(status string) Response {
+	uptime := time.Since(r.start)
+	return Response{
+		Status:        status,
+		Version:       r.version,
+		Uptime:        uptime.Round(time.Second).String(),
+		UptimeSeconds: uptime.Seconds(),
+	}
+}
+
+// LiveHandler answers liveness probes with 200 while the process can serve
+// HTTP at all
+func (r *Registry) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeResponse(w, r.Live())
+	})
+}
+
+// ReadyHandler answers readiness probes with 200 when every check passes and
+// 503 otherwise
+func (r *Registry) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeResponse(w, r.Ready(req.Context()))
+	})
+}
+
+func writeResponse(w http.ResponseWriter, resp Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if resp.Status == StatusOK {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
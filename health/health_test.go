@@ -0,0 +1,84 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rizqishq/Go-REST/health"
+)
+
+func probe(t *testing.T, h http.Handler) (int, health.Response) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	var resp health.Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("body is not JSON: %v\n%s", err, rec.Body.String())
+	}
+	return rec.Code, resp
+}
+
+func TestReadiness(t *testing.T) {
+	reg := health.NewRegistry("1.2.3", 50*time.Millisecond)
+	var dbErr error
+	reg.Register("db", func(ctx context.Context) error { return dbErr })
+	reg.Register("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	code, resp := probe(t, reg.ReadyHandler())
+	if code != http.StatusServiceUnavailable || resp.Status != health.StatusFailing {
+		t.Errorf("status %d %q, want 503 failing because of the slow check", code, resp.Status)
+	}
+	if resp.Version != "1.2.3" || resp.Checks["db"].Status != health.StatusOK {
+		t.Errorf("response = %+v, want version 1.2.3 and db ok", resp)
+	}
+	if slow := resp.Checks["slow"]; slow.Status != health.StatusFailing || slow.Error != context.DeadlineExceeded.Error() {
+		t.Errorf("slow check = %+v, want it timed out", slow)
+	}
+
+	dbErr = errors.New("connection refused")
+	_, resp = probe(t, reg.ReadyHandler())
+	if db := resp.Checks["db"]; db.Status != health.StatusFailing || db.Error != "connection refused" {
+		t.Errorf("db check = %+v, want the error", db)
+	}
+}
+
+func TestShutDown(t *testing.T) {
+	reg := health.NewRegistry("dev", time.Second)
+	ran := false
+	reg.Register("db", func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+
+	if code, resp := probe(t, reg.ReadyHandler()); code != http.StatusOK || resp.Status != health.StatusOK {
+		t.Fatalf("status %d %q, want 200 ok", code, resp.Status)
+	}
+	reg.ShutDown()
+	ran = false
+	if code, resp := probe(t, reg.ReadyHandler()); code != http.StatusServiceUnavailable || resp.Status != health.StatusShuttingDown || ran {
+		t.Errorf("status %d %q, ran checks %v; want 503 shutting_down without checks", code, resp.Status, ran)
+	}
+	// The process is still alive while it drains
+	if code, resp := probe(t, reg.LiveHandler()); code != http.StatusOK || resp.Status != health.StatusOK || resp.Checks != nil {
+		t.Errorf("liveness = %d %+v, want 200 ok without checks", code, resp)
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	reg := health.NewRegistry("dev", time.Second)
+	reg.Register("db", func(ctx context.Context) error { return nil })
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name twice did not panic")
+		}
+	}()
+	reg.Register("db", func(ctx context.Context) error { return nil })
+}
@@ -0,0 +1,75 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/rizqishq/Go-REST/logging"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		level, format string
+		ok            bool
+	}{
+		{"info", "json", true},
+		{"DEBUG", "text", true},
+		{"warn", "JSON", true},
+		{"error", "json", true},
+		{"verbose", "json", false},
+		{"info", "xml", false},
+	}
+	for _, tt := range tests {
+		_, err := logging.New(&bytes.Buffer{}, tt.level, tt.format)
+		if (err == nil) != tt.ok {
+			t.Errorf("New(%q, %q) error = %v, want ok = %v", tt.level, tt.format, err, tt.ok)
+		}
+	}
+}
+
+func TestRequestIDIsLogged(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "info", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := logging.WithRequestID(context.Background(), "req-1")
+	logger.InfoContext(ctx, "with id", "n", 1)
+	logger.With("component", "test").InfoContext(ctx, "derived logger")
+	logger.Info("without id")
+	logger.DebugContext(ctx, "below the level")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3:\n%s", len(lines), buf.String())
+	}
+	for i, want := range []string{"req-1", "req-1", ""} {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(lines[i]), &record); err != nil {
+			t.Fatalf("line %d is not JSON: %v", i, err)
+		}
+		got, _ := record["request_id"].(string)
+		if got != want {
+			t.Errorf("line %d request_id = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestLevelVar(t *testing.T) {
+	var buf bytes.Buffer
+	var level slog.LevelVar
+	logger, err := logging.NewWithLevel(&buf, &level, "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Debug("hidden")
+	level.Set(slog.LevelDebug)
+	logger.Debug("shown")
+	if out := buf.String(); strings.Contains(out, "hidden") || !strings.Contains(out, "shown") {
+		t.Errorf("output = %q, want only the message logged after lowering the level", out)
+	}
+}
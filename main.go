@@ -6,47 +6,209 @@
 // @host localhost:8080
 // @BasePath /api/v1
 // @schemes http
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Access token from /auth/login, sent as "Bearer <token>"
 package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rizqishq/Go-REST/config"
 	"github.com/rizqishq/Go-REST/controllers"
 	_ "github.com/rizqishq/Go-REST/docs"
+	"github.com/rizqishq/Go-REST/health"
+	"github.com/rizqishq/Go-REST/logging"
+	"github.com/rizqishq/Go-REST/metrics"
 	"github.com/rizqishq/Go-REST/middleware"
 	"github.com/rizqishq/Go-REST/repositories"
 	"github.com/rizqishq/Go-REST/services"
+	"github.com/rizqishq/Go-REST/tracing"
+	"github.com/rizqishq/Go-REST/utils"
 	httpSwagger "github.com/swaggo/http-swagger"
+	"golang.org/x/crypto/bcrypt"
+	_ "modernc.org/sqlite"
 )
 
+// version is reported by the health endpoints; release builds set it with
+// -ldflags "-X main.version=1.2.3"
+var version = "dev"
+
 func main() {
-	cfg := config.LoadConfig()
+	cfg, err := config.LoadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+	if cfg.PrintConfig {
+		if err := cfg.WriteYAML(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not print configuration: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// The level is a variable so SIGHUP can change it
+	logLevel := new(slog.LevelVar)
+	if err := logLevel.UnmarshalText([]byte(cfg.Log.Level)); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not configure logging: %v\n", err)
+		os.Exit(1)
+	}
+	logger, err := logging.NewWithLevel(os.Stderr, logLevel, cfg.Log.Format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not configure logging: %v\n", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	tracer, err := newTracer(cfg.Tracing)
+	if err != nil {
+		fatal("Could not configure tracing", err)
+	}
+
+	ipRules, userRules, err := newRateLimitRules(cfg.RateLimit)
+	if err != nil {
+		fatal("Could not configure rate limits", err)
+	}
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		fatal("Could not configure trusted proxies", err)
+	}
+	rateLimits := middleware.NewInMemoryRateLimitStore()
+	limitClients := middleware.NewReloadableMiddleware(middleware.RateLimitMiddleware(rateLimits, ipRules...))
+	limitUsers := middleware.NewReloadableMiddleware(middleware.RateLimitMiddleware(rateLimits, userRules...))
+
+	registry := metrics.NewRegistry()
+	instrument := middleware.MetricsMiddleware(registry)
 
 	router := mux.NewRouter()
+	router.NotFoundHandler = instrument(limitClients.Middleware(middleware.NotFoundHandler()))
+	router.MethodNotAllowedHandler = instrument(limitClients.Middleware(middleware.MethodNotAllowedHandler()))
 
-	router.Use(middleware.LoggingMiddleware)
+	router.Use(instrument)
+	router.Use(middleware.SpanRouteMiddleware)
 	router.Use(middleware.RecoveryMiddleware)
 
-	apiRouter := router.PathPrefix("/api/v1").Subrouter()
+	userRepo, err := newUserRepository(cfg.Database)
+	if err != nil {
+		fatal("Could not open user repository", err)
+	}
+	auditRepo, transactor, err := newAuditRepository(userRepo)
+	if err != nil {
+		fatal("Could not open audit log", err)
+	}
+	repoMetrics := repositories.NewRepositoryMetrics(registry)
+	repositories.RegisterUserGauges(registry, userRepo)
+	instrumentedUserRepo := repositories.NewInstrumentedUserRepository(userRepo, repoMetrics)
+	instrumentedAuditRepo := repositories.NewInstrumentedAuditRepository(auditRepo, repoMetrics)
+	healthChecks := health.NewRegistry(version, cfg.Health.CheckTimeout)
+	if pinger, ok := userRepo.(repositories.Pinger); ok {
+		healthChecks.Register("repository", pinger.Ping)
+	}
+	if cfg.Database.Driver == "" && cfg.Database.DataDir != "" {
+		healthChecks.Register("disk", health.DiskSpace(cfg.Database.DataDir, uint64(cfg.Health.MinFreeDiskMB)<<20))
+	}
+
+	hasher, err := newPasswordHasher(cfg.Password)
+	if err != nil {
+		fatal("Could not configure password hashing", err)
+	}
+	userService, err := services.NewUserService(instrumentedUserRepo, instrumentedAuditRepo, transactor, hasher)
+	if err != nil {
+		fatal("Could not configure password hashing", err)
+	}
+	validator := utils.NewValidator(newPasswordPolicy(cfg.Password))
+	if err := validator.Register(controllers.ValidatedRequests...); err != nil {
+		fatal("Could not parse request validation rules", err)
+	}
+	userController := controllers.NewUserController(userService, validator)
+	auditController := controllers.NewAuditController(services.NewAuditService(instrumentedAuditRepo))
 
-	userRepo := repositories.NewInMemoryUserRepository()
-	userService := services.NewUserService(userRepo)
-	userController := controllers.NewUserController(userService)
+	if cfg.Admin.Username != "" {
+		created, err := userService.EnsureAdmin(context.Background(), cfg.Admin.Username, cfg.Admin.Email, cfg.Admin.Password)
+		if err != nil {
+			fatal("Could not bootstrap admin account", err)
+		}
+		if created {
+			slog.Info("Created admin account", "username", cfg.Admin.Username)
+		}
+	}
+
+	// The generated secret stays out of cfg, which reloads compare with the
+	// configuration as loaded
+	authConfig := cfg.Auth
+	if authConfig.JWTSecret == "" {
+		secret, err := utils.RandomToken(32)
+		if err != nil {
+			fatal("Could not generate JWT secret", err)
+		}
+		authConfig.JWTSecret = secret
+		slog.Warn("AUTH_JWT_SECRET is not set; using a random secret, tokens will not survive a restart")
+	}
+	authService, err := services.NewAuthService(userService, repositories.NewInstrumentedRefreshTokenRepository(newRefreshTokenRepository(userRepo), repoMetrics), authConfig)
+	if err != nil {
+		fatal("Could not configure authentication", err)
+	}
+	authController := controllers.NewAuthController(authService, validator)
+
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	purgeDone := make(chan struct{})
+	go func() {
+		defer close(purgeDone)
+		if cfg.Users.DeletedRetention > 0 && cfg.Users.PurgeInterval > 0 {
+			userService.RunPurgeJob(jobCtx, cfg.Users.DeletedRetention, cfg.Users.PurgeInterval)
+		}
+	}()
+	if cfg.RateLimit.EvictInterval > 0 {
+		go rateLimits.RunEvictor(jobCtx, cfg.RateLimit.EvictInterval)
+	}
 
-	registerRoutes(apiRouter, userController)
+	// Users are only known once authenticated, so their limits apply there
+	verifyToken := middleware.AuthMiddleware(authService)
+	authenticate := func(next http.Handler) http.Handler {
+		return verifyToken(limitUsers.Middleware(next))
+	}
+
+	// Probes and scrapes are never refused or cut short because of client
+	// traffic, so they are registered outside the API chain, and before it
+	// since mux matches routes in order and the API claims all of /api/v1
+	registerProbes(router, healthChecks)
+	router.Handle("/metrics", registry.Handler()).Methods("GET")
 	router.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
 
+	apiRouter := router.PathPrefix("/api/v1").Subrouter()
+	apiRouter.Use(limitClients.Middleware)
+	apiRouter.Use(middleware.TimeoutMiddleware(cfg.Server.RequestTimeout))
+	registerRoutes(apiRouter, userController, authController, auditController, authenticate)
+
+	// CORS, request IDs, traces and the access log wrap the whole router, so
+	// preflights and requests that match no route get them too
+	cors := middleware.NewReloadableMiddleware(middleware.CORSMiddleware(router, newCORSOptions(cfg.CORS)))
+	var handler http.Handler = cors.Middleware(router)
+	handler = middleware.LoggingMiddleware(handler)
+	handler = middleware.TracingMiddleware(tracer)(handler)
+	handler = middleware.RequestIDMiddleware(handler)
+	handler = middleware.ClientIPMiddleware(trustedProxies)(handler)
+
 	server := &http.Server{
 		Addr:         ":" + cfg.Server.Port,
-		Handler:      router,
+		Handler:      handler,
+		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
 		ReadTimeout:  cfg.Server.ReadTimeout,
 		WriteTimeout: cfg.Server.WriteTimeout,
 		IdleTimeout:  cfg.Server.IdleTimeout,
@@ -54,43 +216,242 @@ func main() {
 
 	// Start server in a goroutine
 	go func() {
-		fmt.Printf("Starting server on :%s\n", cfg.Server.Port)
+		slog.Info("Starting server", "addr", server.Addr)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Could not listen on :%s: %v\n", cfg.Server.Port, err)
+			fatal("Could not listen", err, "addr", server.Addr)
 		}
 	}()
 
-	// Wait for interrupt signal to gracefully shut down the server
+	// reload re-reads the configuration and swaps in the settings that can
+	// change at runtime. Nothing changes when the new configuration is
+	// invalid; settings that need a restart keep their current values.
+	current := cfg
+	reload := func() {
+		next, err := config.LoadConfig(os.Args[1:])
+		if err != nil {
+			slog.Error("Could not reload configuration", "error", err)
+			return
+		}
+		reloaded, changed, rejected := current.Reload(next)
+		if len(rejected) > 0 {
+			slog.Error("Settings cannot change without a restart; keeping their current values", "settings", rejected)
+		}
+		ipRules, userRules, err := newRateLimitRules(reloaded.RateLimit)
+		if err != nil {
+			slog.Error("Could not reload configuration", "error", err)
+			return
+		}
+		if err := logLevel.UnmarshalText([]byte(reloaded.Log.Level)); err != nil {
+			slog.Error("Could not reload configuration", "error", err)
+			return
+		}
+		limitClients.Set(middleware.RateLimitMiddleware(rateLimits, ipRules...))
+		limitUsers.Set(middleware.RateLimitMiddleware(rateLimits, userRules...))
+		cors.Set(middleware.CORSMiddleware(router, newCORSOptions(reloaded.CORS)))
+		validator.SetPolicy(newPasswordPolicy(reloaded.Password))
+		current = reloaded
+		slog.Info("Reloaded configuration", "changed", changed)
+	}
+
+	// Reload on SIGHUP until an interrupt signal gracefully shuts down the
+	// server
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	for running := true; running; {
+		select {
+		case <-hangup:
+			reload()
+		case <-quit:
+			running = false
+		}
+	}
+	signal.Stop(hangup)
 
-	fmt.Println("Server is shutting down...")
+	slog.Info("Server is shutting down")
+	healthChecks.ShutDown()
+	// Keep serving while load balancers notice the failing readiness probe
+	time.Sleep(cfg.Server.ShutdownDelay)
 
 	// Create a deadline to wait for current operations to complete
 	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		fatal("Server forced to shutdown", err)
+	}
+
+	// Stop the purge job before the repository is closed
+	stopJobs()
+	<-purgeDone
+
+	if closer, ok := userRepo.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			slog.Error("Could not close user repository", "error", err)
+		}
+	}
+	if closer, ok := auditRepo.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			slog.Error("Could not close audit log", "error", err)
+		}
 	}
 
-	fmt.Println("Server exited properly")
+	slog.Info("Server exited properly")
 }
 
-// registerRoutes sets up all API routes
+// fatal logs err with the attributes in args and exits
+func fatal(msg string, err error, args ...any) {
+	slog.Error(msg, append(args, "error", err)...)
+	os.Exit(1)
+}
+
+// newTracer builds the tracer with the exporter chosen in config
+func newTracer(cfg config.TracingConfig) (*tracing.Tracer, error) {
+	switch cfg.Exporter {
+	case "none", "":
+		return tracing.NewTracer(nil), nil
+	case "stdout":
+		return tracing.NewTracer(tracing.NewWriterExporter(os.Stdout)), nil
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+}
+
+// newCORSOptions turns the CORS config into middleware options
+func newCORSOptions(cfg config.CORSConfig) middleware.CORSOptions {
+	return middleware.CORSOptions{
+		AllowedOrigins:   cfg.AllowedOrigins,
+		AllowedMethods:   cfg.AllowedMethods,
+		AllowedHeaders:   cfg.AllowedHeaders,
+		ExposedHeaders:   cfg.ExposedHeaders,
+		AllowCredentials: cfg.AllowCredentials,
+		MaxAge:           cfg.MaxAge,
+	}
+}
+
+// newRateLimitRules parses the rate limits in config into the rules keyed by
+// client IP and route, and those keyed by user
+func newRateLimitRules(cfg config.RateLimitConfig) (clients, users []middleware.RateLimitRule, err error) {
+	if cfg.PerIP != "" {
+		limit, err := config.ParseRateLimit(cfg.PerIP)
+		if err != nil {
+			return nil, nil, err
+		}
+		clients = append(clients, middleware.RateLimitRule{Name: "ip", Limit: limit, Key: middleware.ClientIPKey})
+	}
+	routes, err := config.ParseRouteRateLimits(cfg.Routes)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, r := range routes {
+		clients = append(clients, middleware.RateLimitRule{Name: "route:" + r.Route, Limit: r.Limit, Key: middleware.RouteKey(r.Route)})
+	}
+	if cfg.PerUser != "" {
+		limit, err := config.ParseRateLimit(cfg.PerUser)
+		if err != nil {
+			return nil, nil, err
+		}
+		users = append(users, middleware.RateLimitRule{Name: "user", Limit: limit, Key: middleware.UserKey})
+	}
+	return clients, users, nil
+}
+
+// newPasswordHasher builds the hasher for new passwords from config
+func newPasswordHasher(cfg config.PasswordConfig) (utils.PasswordHasher, error) {
+	switch cfg.Algorithm {
+	case "argon2id":
+		if cfg.Argon2Time < 1 || cfg.Argon2Memory < 8*cfg.Argon2Threads || cfg.Argon2Threads < 1 || cfg.Argon2Threads > 255 {
+			return nil, fmt.Errorf("invalid argon2id parameters t=%d m=%d p=%d", cfg.Argon2Time, cfg.Argon2Memory, cfg.Argon2Threads)
+		}
+		params := utils.DefaultArgon2idParams
+		params.Time = uint32(cfg.Argon2Time)
+		params.Memory = uint32(cfg.Argon2Memory)
+		params.Threads = uint8(cfg.Argon2Threads)
+		return utils.NewArgon2idHasher(params), nil
+	case "bcrypt":
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return utils.NewBcryptHasher(cfg.BcryptCost), nil
+	default:
+		return nil, fmt.Errorf("unknown password algorithm %q", cfg.Algorithm)
+	}
+}
+
+// newPasswordPolicy takes the rules for new passwords from config
+func newPasswordPolicy(cfg config.PasswordConfig) utils.PasswordPolicy {
+	policy := utils.PasswordPolicy{
+		MinLength:     cfg.MinLength,
+		MaxLength:     cfg.MaxLength,
+		RequireUpper:  cfg.RequireUpper,
+		RequireLower:  cfg.RequireLower,
+		RequireDigit:  cfg.RequireDigit,
+		RequireSymbol: cfg.RequireSymbol,
+	}
+	// Longer passwords would pass validation and then fail to hash
+	if cfg.Algorithm == "bcrypt" {
+		policy.MaxBytes = utils.BcryptMaxPasswordBytes
+	}
+	return policy
+}
+
+// newRefreshTokenRepository keeps refresh tokens next to the users when they
+// live in a database, and in memory otherwise
+func newRefreshTokenRepository(userRepo repositories.UserRepository) repositories.RefreshTokenRepository {
+	if sqlRepo, ok := userRepo.(*repositories.SQLUserRepository); ok {
+		return repositories.NewSQLRefreshTokenRepository(sqlRepo)
+	}
+	return repositories.NewInMemoryRefreshTokenRepository()
+}
+
+// newUserRepository picks the storage backend from the database config
+func newUserRepository(cfg config.DatabaseConfig) (repositories.UserRepository, error) {
+	switch {
+	case cfg.Driver != "":
+		return repositories.OpenSQLUserRepository(context.Background(), cfg.Driver, cfg.DSN, cfg.MaxConnections)
+	case cfg.DataDir != "":
+		return repositories.NewFileUserRepository(cfg.DataDir, cfg.SnapshotInterval)
+	default:
+		return repositories.NewInMemoryUserRepository(), nil
+	}
+}
+
+// newAuditRepository keeps the audit log in the same backend as the users,
+// together with the transactor that writes both atomically
+func newAuditRepository(userRepo repositories.UserRepository) (repositories.AuditRepository, repositories.Transactor, error) {
+	switch repo := userRepo.(type) {
+	case *repositories.SQLUserRepository:
+		return repositories.NewSQLAuditRepository(repo), repositories.NewSQLTransactor(repo), nil
+	case *repositories.FileUserRepository:
+		auditRepo, err := repositories.NewFileAuditRepository(repo)
+		if err != nil {
+			return nil, nil, err
+		}
+		return auditRepo, repositories.NewFileTransactor(repo), nil
+	default:
+		return repositories.NewInMemoryAuditRepository(), repositories.NewInMemoryTransactor(), nil
+	}
+}
+
+// registerProbes sets up liveness and readiness probes
 // @Summary Health Check
-// @Description Returns API health status
+// @Description Reports version, uptime and the dependency checks; the same as /readyz outside the API
 // @Tags system
-// @Produce plain
-// @Success 200 {string} string "API is healthy"
+// @Produce json
+// @Success 200 {object} health.Response
+// @Failure 503 {object} health.Response
 // @Router /health [get]
-func registerRoutes(router *mux.Router, userController *controllers.UserController) {
+func registerProbes(router *mux.Router, checks *health.Registry) {
+	router.Handle("/livez", checks.LiveHandler()).Methods("GET")
+	router.Handle("/readyz", checks.ReadyHandler()).Methods("GET")
 	// Health check endpoint
-	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("API is healthy"))
-	}).Methods("GET")
+	router.Handle("/api/v1/health", checks.ReadyHandler()).Methods("GET")
+}
 
-	userController.RegisterRoutes(router)
+// registerRoutes sets up all API routes
+func registerRoutes(router *mux.Router, userController *controllers.UserController, authController *controllers.AuthController, auditController *controllers.AuditController, authenticate mux.MiddlewareFunc) {
+	authController.RegisterRoutes(router)
+	userController.RegisterRoutes(router, authenticate)
+	auditController.RegisterRoutes(router, authenticate)
 }
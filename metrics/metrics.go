@@ -0,0 +1,394 @@
+// Package metrics implements counters, gauges and histograms and exposes them
+// in the Prometheus text exposition format, without depending on a
+// Prometheus client library.
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets are histogram upper bounds in seconds suited to request latencies
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var nameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// Registry holds metrics and writes them in registration order. Registering
+// an invalid or duplicate name panics, since that is a programming error.
+type Registry struct {
+	mutex   sync.Mutex
+	metrics []metric
+	names   map[string]bool
+}
+
+// metric is one metric family
+type metric interface {
+	name() string
+	write(ctx context.Context, w *bufio.Writer)
+}
+
+// Create new empty Registry
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+func (r *Registry) register(m metric, labels []string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !nameRE.MatchString(m.name()) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", m.name()))
+	}
+	for _, label := range labels {
+		if !nameRE.MatchString(label) || strings.Contains(label, ":") || label == "le" {
+			panic(fmt.Sprintf("metrics: invalid label name %q", label))
+		}
+	}
+	if r.names[m.name()] {
+		panic(fmt.Sprintf("metrics: duplicate metric %q", m.name()))
+	}
+	r.names[m.name()] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// Write writes every metric to w in the text exposition format. ctx is passed
+// to gauge functions.
+func (r *Registry) Write(ctx context.Context, w io.Writer) error {
+	r.mutex.Lock()
+	metrics := slices.Clone(r.metrics)
+	r.mutex.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(ctx, bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves the metrics to scrapers
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(req.Context(), w)
+	})
+}
+
+// family holds the series of one metric, keyed by their label values
+type family[T any] struct {
+	metricName string
+	help       string
+	typ        string
+	labels     []string
+	newSeries  func() *T
+
+	mutex  sync.RWMutex
+	series map[string]*labeled[T]
+}
+
+type labeled[T any] struct {
+	values []string
+	series *T
+}
+
+func newFamily[T any](name, help, typ string, labels []string, newSeries func() *T) *family[T] {
+	return &family[T]{
+		metricName: name,
+		help:       help,
+		typ:        typ,
+		labels:     labels,
+		newSeries:  newSeries,
+		series:     make(map[string]*labeled[T]),
+	}
+}
+
+func (f *family[T]) name() string { return f.metricName }
+
+// with returns the series for values, creating it on first use
+func (f *family[T]) with(values []string) *T {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", f.metricName, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	f.mutex.RLock()
+	s, ok := f.series[key]
+	f.mutex.RUnlock()
+	if ok {
+		return s.series
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if s, ok := f.series[key]; ok {
+		return s.series
+	}
+	s = &labeled[T]{values: slices.Clone(values), series: f.newSeries()}
+	f.series[key] = s
+	return s.series
+}
+
+// sorted returns the series ordered by their label values
+func (f *family[T]) sorted() []*labeled[T] {
+	f.mutex.RLock()
+	series := make([]*labeled[T], 0, len(f.series))
+	for _, s := range f.series {
+		series = append(series, s)
+	}
+	f.mutex.RUnlock()
+
+	sort.Slice(series, func(i, j int) bool {
+		return slices.Compare(series[i].values, series[j].values) < 0
+	})
+	return series
+}
+
+func (f *family[T]) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.metricName, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.metricName, f.typ)
+}
+
+// value is a float64 that can be changed atomically
+type value struct {
+	bits atomic.Uint64
+}
+
+func (v *value) add(delta float64) {
+	for {
+		old := v.bits.Load()
+		if v.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+func (v *value) get() float64 { return math.Float64frombits(v.bits.Load()) }
+
+// Counter is a value that only goes up
+type Counter struct {
+	v value
+}
+
+// Inc adds 1
+func (c *Counter) Inc() { c.v.add(1) }
+
+// Add adds delta, which must not be negative
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	c.v.add(delta)
+}
+
+// CounterVec is a counter partitioned by label values
+type CounterVec struct {
+	*family[Counter]
+}
+
+// NewCounterVec registers a counter with the given label names
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newFamily(name, help, "counter", labels, func() *Counter { return &Counter{} })}
+	r.register(c, labels)
+	return c
+}
+
+// With returns the counter for the label values, in the order of the labels
+func (c *CounterVec) With(values ...string) *Counter { return c.with(values) }
+
+func (c *CounterVec) write(_ context.Context, w *bufio.Writer) {
+	c.writeHeader(w)
+	for _, s := range c.sorted() {
+		writeSample(w, c.metricName, c.labels, s.values, "", "", s.series.v.get())
+	}
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	v value
+}
+
+// Set replaces the value
+func (g *Gauge) Set(v float64) { g.v.bits.Store(math.Float64bits(v)) }
+
+// Add adds delta, which may be negative
+func (g *Gauge) Add(delta float64) { g.v.add(delta) }
+
+// Inc adds 1
+func (g *Gauge) Inc() { g.v.add(1) }
+
+// Dec subtracts 1
+func (g *Gauge) Dec() { g.v.add(-1) }
+
+// GaugeVec is a gauge partitioned by label values
+type GaugeVec struct {
+	*family[Gauge]
+}
+
+// NewGaugeVec registers a gauge with the given label names
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newFamily(name, help, "gauge", labels, func() *Gauge { return &Gauge{} })}
+	r.register(g, labels)
+	return g
+}
+
+// NewGauge registers a gauge without labels
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	return r.NewGaugeVec(name, help).With()
+}
+
+// With returns the gauge for the label values, in the order of the labels
+func (g *GaugeVec) With(values ...string) *Gauge { return g.with(values) }
+
+func (g *GaugeVec) write(_ context.Context, w *bufio.Writer) {
+	g.writeHeader(w)
+	for _, s := range g.sorted() {
+		writeSample(w, g.metricName, g.labels, s.values, "", "", s.series.v.get())
+	}
+}
+
+// gaugeFunc is a gauge whose value is computed on every scrape
+type gaugeFunc struct {
+	metricName string
+	help       string
+	fn         func(ctx context.Context) (float64, error)
+}
+
+// NewGaugeFunc registers a gauge whose value fn computes on every scrape. The
+// gauge is left out of a scrape in which fn fails.
+func (r *Registry) NewGaugeFunc(name, help string, fn func(ctx context.Context) (float64, error)) {
+	r.register(&gaugeFunc{metricName: name, help: help, fn: fn}, nil)
+}
+
+func (g *gaugeFunc) name() string { return g.metricName }
+
+func (g *gaugeFunc) write(ctx context.Context, w *bufio.Writer) {
+	v, err := g.fn(ctx)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n", g.metricName, escapeHelp(g.help))
+	fmt.Fprintf(w, "# TYPE %s gauge\n", g.metricName)
+	writeSample(w, g.metricName, nil, nil, "", "", v)
+}
+
+// Histogram counts observations in buckets
+type Histogram struct {
+	mutex   sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+// Observe records v
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// HistogramVec is a histogram partitioned by label values
+type HistogramVec struct {
+	*family[Histogram]
+	buckets []float64
+}
+
+// NewHistogramVec registers a histogram with the given upper bucket bounds,
+// in increasing order, and label names
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("metrics: buckets of %s are not sorted", name))
+	}
+	buckets = slices.Clone(buckets)
+	h := &HistogramVec{
+		family: newFamily(name, help, "histogram", labels, func() *Histogram {
+			return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+		}),
+		buckets: buckets,
+	}
+	r.register(h, labels)
+	return h
+}
+
+// With returns the histogram for the label values, in the order of the labels
+func (h *HistogramVec) With(values ...string) *Histogram { return h.with(values) }
+
+func (h *HistogramVec) write(_ context.Context, w *bufio.Writer) {
+	h.writeHeader(w)
+	for _, s := range h.sorted() {
+		s.series.mutex.Lock()
+		counts := slices.Clone(s.series.counts)
+		count, sum := s.series.count, s.series.sum
+		s.series.mutex.Unlock()
+
+		// Buckets are cumulative in the exposition format
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += counts[i]
+			writeSample(w, h.metricName+"_bucket", h.labels, s.values, "le", formatFloat(bound), float64(cumulative))
+		}
+		writeSample(w, h.metricName+"_bucket", h.labels, s.values, "le", "+Inf", float64(count))
+		writeSample(w, h.metricName+"_sum", h.labels, s.values, "", "", sum)
+		writeSample(w, h.metricName+"_count", h.labels, s.values, "", "", float64(count))
+	}
+}
+
+// writeSample writes one line; extraName/extraValue add a label such as le
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraName, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", label, escapeLabel(values[i]))
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", extraName, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
@@ -0,0 +1,117 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rizqishq/Go-REST/metrics"
+)
+
+// scrape fetches the registry through its handler
+func scrape(t *testing.T, reg *metrics.Registry) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the text exposition format", ct)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+func TestExposition(t *testing.T) {
+	reg := metrics.NewRegistry()
+	requests := reg.NewCounterVec("requests_total", "Requests handled.", "method", "code")
+	requests.With("POST", "201").Inc()
+	requests.With("GET", "200").Add(2)
+	requests.With("GET", "200").Inc()
+	inFlight := reg.NewGauge("in_flight", "Requests in flight.")
+	inFlight.Inc()
+	inFlight.Inc()
+	inFlight.Dec()
+	latency := reg.NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	for _, v := range []float64{0.05, 0.1, 0.5, 3} {
+		latency.With("/users").Observe(v)
+	}
+	reg.NewGaugeFunc("answer", "Computed on scrape.", func(ctx context.Context) (float64, error) {
+		return 42, nil
+	})
+
+	want := `# HELP requests_total Requests handled.
+# TYPE requests_total counter
+requests_total{method="GET",code="200"} 3
+requests_total{method="POST",code="201"} 1
+# HELP in_flight Requests in flight.
+# TYPE in_flight gauge
+in_flight 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/users",le="0.1"} 2
+latency_seconds_bucket{route="/users",le="1"} 3
+latency_seconds_bucket{route="/users",le="+Inf"} 4
+latency_seconds_sum{route="/users"} 3.65
+latency_seconds_count{route="/users"} 4
+# HELP answer Computed on scrape.
+# TYPE answer gauge
+answer 42
+`
+	if got := scrape(t, reg); got != want {
+		t.Errorf("scrape returned\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	reg := metrics.NewRegistry()
+	reg.NewCounterVec("escaped_total", "Help with \\ and\nnewline.", "value").With("a \"quoted\"\\\nvalue").Inc()
+
+	got := scrape(t, reg)
+	for _, line := range []string{
+		`# HELP escaped_total Help with \\ and\nnewline.`,
+		`escaped_total{value="a \"quoted\"\\\nvalue"} 1`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("scrape is missing %q:\n%s", line, got)
+		}
+	}
+}
+
+func TestFailingGaugeFuncIsSkipped(t *testing.T) {
+	reg := metrics.NewRegistry()
+	reg.NewGaugeFunc("broken", "Always fails.", func(ctx context.Context) (float64, error) {
+		return 0, errors.New("boom")
+	})
+	if got := scrape(t, reg); got != "" {
+		t.Errorf("scrape returned %q, want nothing", got)
+	}
+}
+
+func TestRegistrationPanics(t *testing.T) {
+	tests := []struct {
+		name     string
+		register func(reg *metrics.Registry)
+	}{
+		{"duplicate", func(reg *metrics.Registry) {
+			reg.NewGauge("dup", "")
+			reg.NewCounterVec("dup", "")
+		}},
+		{"invalid name", func(reg *metrics.Registry) { reg.NewGauge("bad-name", "") }},
+		{"reserved label", func(reg *metrics.Registry) { reg.NewHistogramVec("h", "", metrics.DefBuckets, "le") }},
+		{"unsorted buckets", func(reg *metrics.Registry) { reg.NewHistogramVec("h", "", []float64{1, 0.5}) }},
+		{"wrong label count", func(reg *metrics.Registry) { reg.NewCounterVec("c", "", "a", "b").With("x") }},
+		{"negative counter", func(reg *metrics.Registry) { reg.NewCounterVec("c", "").With().Add(-1) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("no panic")
+				}
+			}()
+			tt.register(metrics.NewRegistry())
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/rizqishq/Go-REST/models"
+)
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+// TokenVerifier resolves a bearer token to the user it was issued to
+type TokenVerifier interface {
+	VerifyAccessToken(ctx context.Context, token string) (*models.User, error)
+}
+
+// AuthMiddleware rejects requests without a valid bearer token and stores the
+// authenticated user in the request context
+func AuthMiddleware(verifier TokenVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+				unauthorized(w, r, "Missing bearer token")
+				return
+			}
+
+			user, err := verifier.VerifyAccessToken(r.Context(), token)
+			if err != nil {
+				if !WriteContextError(w, r, err) {
+					unauthorized(w, r, "Invalid or expired token")
+				}
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+		})
+	}
+}
+
+// WithUser returns a copy of ctx carrying the authenticated user
+func WithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// UserFromContext returns the authenticated user, if any
+func UserFromContext(ctx context.Context) (*models.User, bool) {
+	user, ok := ctx.Value(userContextKey).(*models.User)
+	return user, ok
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+	WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, message)
+}
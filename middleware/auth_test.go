@@ -0,0 +1,97 @@
+package middleware_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rizqishq/Go-REST/middleware"
+	"github.com/rizqishq/Go-REST/models"
+)
+
+// staticVerifier accepts only the token "valid", for the user it holds
+type staticVerifier struct {
+	user *models.User
+	err  error
+}
+
+func (v staticVerifier) VerifyAccessToken(ctx context.Context, token string) (*models.User, error) {
+	if v.err != nil {
+		return nil, v.err
+	}
+	if token != "valid" {
+		return nil, errors.New("invalid token")
+	}
+	return v.user, nil
+}
+
+// whoAmI writes the username of the authenticated user
+var whoAmI = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "no user in context", http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte(user.Username))
+})
+
+func TestAuthMiddleware(t *testing.T) {
+	h := middleware.AuthMiddleware(staticVerifier{user: &models.User{ID: 1, Username: "john"}})(whoAmI)
+
+	tests := []struct {
+		name, authorization string
+		status              int
+	}{
+		{"valid token", "Bearer valid", http.StatusOK},
+		{"lower case scheme", "bearer valid", http.StatusOK},
+		{"no header", "", http.StatusUnauthorized},
+		{"invalid token", "Bearer forged", http.StatusUnauthorized},
+		{"basic scheme", "Basic am9objpwYXNzd29yZA==", http.StatusUnauthorized},
+		{"scheme only", "Bearer", http.StatusUnauthorized},
+		{"empty token", "Bearer ", http.StatusUnauthorized},
+		{"token without scheme", "valid", http.StatusUnauthorized},
+		{"extra space", "Bearer  valid", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/users/me", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status == http.StatusOK {
+				if rec.Body.String() != "john" {
+					t.Errorf("user in context = %q, want john", rec.Body)
+				}
+				return
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); got != `Bearer realm="api"` {
+				t.Errorf("WWW-Authenticate = %q", got)
+			}
+			var resp middleware.ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Code != middleware.CodeUnauthorized {
+				t.Errorf("error body = %s, want code %q", rec.Body, middleware.CodeUnauthorized)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareTimeout(t *testing.T) {
+	h := middleware.AuthMiddleware(staticVerifier{err: context.DeadlineExceeded})(whoAmI)
+
+	req := httptest.NewRequest("GET", "/users/me", nil)
+	req.Header.Set("Authorization", "Bearer valid")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusGatewayTimeout)
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/rizqishq/Go-REST/models"
+)
+
+// RequirePermission allows the request only if the authenticated user holds
+// perm. It must run after AuthMiddleware.
+func RequirePermission(perm models.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := UserFromContext(r.Context())
+			if !ok {
+				unauthorized(w, r, "Missing bearer token")
+				return
+			}
+			if !user.HasPermission(perm) {
+				forbidden(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSelfOrPermission allows the request if the {id} route variable is the
+// authenticated user's own ID, or if the user holds perm. It must run after
+// AuthMiddleware.
+func RequireSelfOrPermission(perm models.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := UserFromContext(r.Context())
+			if !ok {
+				unauthorized(w, r, "Missing bearer token")
+				return
+			}
+			id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+			isSelf := err == nil && uint(id) == user.ID
+			if !isSelf && !user.HasPermission(perm) {
+				forbidden(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func forbidden(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, r, http.StatusForbidden, CodeForbidden, "You do not have permission to perform this action")
+}
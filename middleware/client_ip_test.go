@@ -0,0 +1,64 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rizqishq/Go-REST/middleware"
+)
+
+func TestClientIPMiddleware(t *testing.T) {
+	trusted, err := middleware.ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, remoteAddr string
+		forwardedFor     []string
+		trusted          bool
+		want             string
+	}{
+		{"no proxy", "203.0.113.7:5000", nil, true, "203.0.113.7"},
+		{"untrusted peer cannot spoof", "203.0.113.7:5000", []string{"198.51.100.1"}, true, "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:5000", []string{"198.51.100.1"}, true, "198.51.100.1"},
+		{"chain of trusted proxies", "10.1.2.3:5000", []string{"198.51.100.1, 192.0.2.1", "10.9.9.9"}, true, "198.51.100.1"},
+		{"spoofed entries before the client are ignored", "10.1.2.3:5000", []string{"1.1.1.1, 198.51.100.1"}, true, "198.51.100.1"},
+		{"garbage stops the walk", "10.1.2.3:5000", []string{"198.51.100.1, not-an-ip, 192.0.2.1"}, true, "192.0.2.1"},
+		{"only proxies", "10.1.2.3:5000", []string{"10.0.0.1"}, true, "10.0.0.1"},
+		{"trusted proxy without header", "10.1.2.3:5000", nil, true, "10.1.2.3"},
+		{"IPv6 proxy", "[2001:db8::1]:5000", []string{"198.51.100.1"}, true, "198.51.100.1"},
+		{"no trusted proxies configured", "10.1.2.3:5000", []string{"198.51.100.1"}, false, "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = middleware.ClientIPKey(r)
+			})
+			proxies := trusted
+			if !tt.trusted {
+				proxies = nil
+			}
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			middleware.ClientIPMiddleware(proxies)(h).ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("client IP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	for _, bad := range []string{"10.0.0.0/33", "proxy.local", ""} {
+		if _, err := middleware.ParseTrustedProxies([]string{bad}); err == nil {
+			t.Errorf("ParseTrustedProxies(%q) succeeded", bad)
+		}
+	}
+}
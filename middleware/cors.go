@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// CORSOptions controls which cross-origin browser requests are allowed
+type CORSOptions struct {
+	// AllowedOrigins lists origins such as "https://app.example.com".
+	// "https://*.example.com" allows every subdomain of example.com and "*"
+	// allows any origin. CORS is disabled when the list is empty.
+	AllowedOrigins []string
+	AllowedMethods []string
+	// AllowedHeaders lists request headers scripts may send; "*" allows any
+	AllowedHeaders []string
+	// ExposedHeaders lists response headers scripts may read
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration
+}
+
+// CORSMiddleware adds CORS headers to responses for allowed origins and
+// answers preflight requests itself, for routes of router that accept the
+// requested method. Wrap the router with it: mux never routes OPTIONS
+// requests to handlers registered for other methods.
+func CORSMiddleware(router *mux.Router, opts CORSOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(opts.AllowedOrigins) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			h := w.Header()
+			h.Add("Vary", "Origin")
+
+			method := r.Header.Get("Access-Control-Request-Method")
+			if r.Method != http.MethodOptions || method == "" {
+				if opts.allowsOrigin(origin) {
+					opts.setOrigin(h, origin)
+					if len(opts.ExposedHeaders) > 0 {
+						h.Set("Access-Control-Expose-Headers", strings.Join(opts.ExposedHeaders, ", "))
+					}
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			headers := r.Header.Get("Access-Control-Request-Headers")
+			switch {
+			case !opts.allowsOrigin(origin):
+				WriteError(w, r, http.StatusForbidden, CodeForbidden, "Origin not allowed")
+				return
+			case !slices.Contains(opts.AllowedMethods, method) || !routeAccepts(router, r, method):
+				WriteError(w, r, http.StatusForbidden, CodeForbidden, "Method not allowed for this resource")
+				return
+			case !opts.allowsHeaders(headers):
+				WriteError(w, r, http.StatusForbidden, CodeForbidden, "Request headers not allowed")
+				return
+			}
+
+			opts.setOrigin(h, origin)
+			h.Set("Access-Control-Allow-Methods", strings.Join(opts.AllowedMethods, ", "))
+			if headers != "" {
+				h.Set("Access-Control-Allow-Headers", headers)
+			}
+			if opts.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// routeAccepts reports whether router has a route for the path of r with the
+// given method
+func routeAccepts(router *mux.Router, r *http.Request, method string) bool {
+	req := r.Clone(r.Context())
+	req.Method = method
+	var match mux.RouteMatch
+	return router.Match(req, &match) && match.MatchErr == nil
+}
+
+func (o CORSOptions) setOrigin(h http.Header, origin string) {
+	if slices.Contains(o.AllowedOrigins, "*") && !o.AllowCredentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if o.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (o CORSOptions) allowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range o.AllowedOrigins {
+		allowed = strings.ToLower(allowed)
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		prefix, suffix, ok := strings.Cut(allowed, "*")
+		if !ok || !strings.HasPrefix(suffix, ".") {
+			continue
+		}
+		if sub, ok := strings.CutPrefix(origin, prefix); ok {
+			if sub, ok := strings.CutSuffix(sub, suffix); ok && isSubdomain(sub) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isSubdomain reports whether s is one or more DNS labels
+func isSubdomain(s string) bool {
+	if s == "" || strings.HasPrefix(s, ".") || strings.HasSuffix(s, ".") || strings.Contains(s, "..") {
+		return false
+	}
+	for _, c := range s {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// allowsHeaders reports whether every header of the comma-separated list is
+// allowed
+func (o CORSOptions) allowsHeaders(list string) bool {
+	if slices.Contains(o.AllowedHeaders, "*") {
+		return true
+	}
+	for header := range strings.SplitSeq(list, ",") {
+		header = strings.TrimSpace(header)
+		if header == "" {
+			continue
+		}
+		if !slices.ContainsFunc(o.AllowedHeaders, func(allowed string) bool { return strings.EqualFold(allowed, header) }) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rizqishq/Go-REST/middleware"
+)
+
+func newCORSRouter(opts middleware.CORSOptions) http.Handler {
+	router := mux.NewRouter()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"1"`)
+	})
+	// The shape of UserController.RegisterRoutes
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.Handle("/users", ok).Methods("GET", "POST")
+	api.Handle("/users/{id:[0-9]+}", ok).Methods("GET", "PUT", "PATCH", "DELETE")
+	api.Handle("/users/{id:[0-9]+}/restore", ok).Methods("POST")
+	return middleware.CORSMiddleware(router, opts)(router)
+}
+
+func TestCORSPreflight(t *testing.T) {
+	h := newCORSRouter(middleware.CORSOptions{
+		AllowedOrigins: []string{"https://app.example.com", "https://*.example.org"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowedHeaders: []string{"Authorization", "Content-Type", "If-Match"},
+		MaxAge:         10 * time.Minute,
+	})
+
+	tests := []struct {
+		name, origin, path, method, headers string
+		allowed                             bool
+	}{
+		{"patch user", "https://app.example.com", "/api/v1/users/1", "PATCH", "authorization, content-type, if-match", true},
+		{"delete user", "https://app.example.com", "/api/v1/users/1", "DELETE", "Authorization", true},
+		{"restore user", "https://app.example.com", "/api/v1/users/1/restore", "POST", "", true},
+		{"wildcard subdomain", "https://admin.eu.example.org", "/api/v1/users", "POST", "Content-Type", true},
+		{"wildcard needs a subdomain", "https://example.org", "/api/v1/users", "POST", "", false},
+		{"wildcard is not a suffix match", "https://evilexample.org", "/api/v1/users", "POST", "", false},
+		{"unknown origin", "https://evil.com", "/api/v1/users/1", "PATCH", "", false},
+		{"method not on route", "https://app.example.com", "/api/v1/users/1/restore", "DELETE", "", false},
+		{"unknown route", "https://app.example.com", "/api/v1/nothing", "GET", "", false},
+		{"header not allowed", "https://app.example.com", "/api/v1/users/1", "PUT", "X-Secret", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("OPTIONS", tt.path, nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", tt.method)
+			if tt.headers != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.headers)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			got := rec.Header().Get("Access-Control-Allow-Origin")
+			if !tt.allowed {
+				if rec.Code != http.StatusForbidden || got != "" {
+					t.Errorf("status %d, Allow-Origin %q; want 403 without CORS headers", rec.Code, got)
+				}
+				return
+			}
+			if rec.Code != http.StatusNoContent || got != tt.origin {
+				t.Fatalf("status %d, Allow-Origin %q; want 204 for %s", rec.Code, got, tt.origin)
+			}
+			if m := rec.Header().Get("Access-Control-Allow-Methods"); m != "GET, POST, PUT, PATCH, DELETE" {
+				t.Errorf("Allow-Methods = %q", m)
+			}
+			if hs := rec.Header().Get("Access-Control-Allow-Headers"); hs != tt.headers {
+				t.Errorf("Allow-Headers = %q, want %q", hs, tt.headers)
+			}
+			if age := rec.Header().Get("Access-Control-Max-Age"); age != "600" {
+				t.Errorf("Max-Age = %q, want 600", age)
+			}
+			if rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+				t.Error("credentials allowed without AllowCredentials")
+			}
+		})
+	}
+}
+
+func TestCORSActualRequest(t *testing.T) {
+	h := newCORSRouter(middleware.CORSOptions{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{"GET"},
+		ExposedHeaders:   []string{"ETag", "X-Request-ID"},
+		AllowCredentials: true,
+	})
+
+	do := func(method, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1/users/1", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("GET", "https://app.example.com")
+	want := map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Expose-Headers":    "ETag, X-Request-ID",
+		"Vary":                             "Origin",
+		"ETag":                             `"1"`,
+	}
+	for key, value := range want {
+		if got := rec.Header().Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+
+	// Disallowed origins still reach the handler, but browsers hide the response
+	if rec := do("GET", "https://evil.com"); rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("disallowed origin: status %d, Allow-Origin %q", rec.Code, rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if rec := do("GET", ""); rec.Header().Get("Vary") != "" {
+		t.Error("same-origin request got CORS headers")
+	}
+	// OPTIONS without Access-Control-Request-Method is not a preflight and
+	// is left to the router, which has no OPTIONS routes
+	if rec := do("OPTIONS", "https://app.example.com"); rec.Code == http.StatusNoContent || rec.Code == http.StatusOK {
+		t.Errorf("plain OPTIONS status = %d, want the router's error", rec.Code)
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	h := newCORSRouter(middleware.CORSOptions{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"*"}, AllowedMethods: []string{"PUT"}})
+
+	req := httptest.NewRequest("OPTIONS", "/api/v1/users/1", nil)
+	req.Header.Set("Origin", "https://anywhere.test")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	req.Header.Set("Access-Control-Request-Headers", "X-Custom")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "*" || rec.Header().Get("Access-Control-Allow-Headers") != "X-Custom" {
+		t.Errorf("status %d, headers %v; want 204 for any origin and header", rec.Code, rec.Header())
+	}
+}
+
+func TestCORSDisabled(t *testing.T) {
+	h := newCORSRouter(middleware.CORSOptions{})
+
+	req := httptest.NewRequest("OPTIONS", "/api/v1/users/1", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code == http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("status %d, Allow-Origin %q with CORS disabled; want the router's error", rec.Code, rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
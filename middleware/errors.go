@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rizqishq/Go-REST/logging"
+	"github.com/rizqishq/Go-REST/tracing"
+)
+
+// Error codes returned in ErrorResponse.Code
+const (
+	CodeBadRequest           = "bad_request"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeConflict             = "conflict"
+	CodePreconditionFailed   = "precondition_failed"
+	CodePreconditionRequired = "precondition_required"
+	CodeUnsupportedMedia     = "unsupported_media_type"
+	CodeRateLimited          = "rate_limited"
+	CodeTimeout              = "timeout"
+	CodeValidation           = "validation_failed"
+	CodeInternal             = "internal_error"
+)
+
+// ErrorResponse is the body of every error returned by the API
+type ErrorResponse struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	TraceID   string       `json:"trace_id,omitempty"`
+}
+
+// FieldError describes a problem with one field of the request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// WriteError renders an ErrorResponse with the given status and the request
+// and trace IDs of r's context
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code, message string, details ...FieldError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: logging.RequestID(r.Context()),
+		TraceID:   traceID(r),
+	})
+}
+
+// traceID returns the trace of r, or "" if it is not traced
+func traceID(r *http.Request) string {
+	if sc := tracing.SpanContextFromContext(r.Context()); sc.IsValid() {
+		return sc.TraceID.String()
+	}
+	return ""
+}
+
+// NotFoundHandler answers unknown routes with a JSON error
+func NotFoundHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Resource not found")
+	})
+}
+
+// MethodNotAllowedHandler answers known routes called with the wrong method
+func MethodNotAllowedHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+	})
+}
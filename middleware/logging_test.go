@@ -0,0 +1,104 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rizqishq/Go-REST/logging"
+	"github.com/rizqishq/Go-REST/middleware"
+)
+
+// captureLogs sends the default logger to a buffer for the rest of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "info", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	long := strings.Repeat("a", 129)
+	tests := []struct {
+		name, header string
+		keep         bool
+	}{
+		{"propagated", "client-id-1", true},
+		{"generated", "", false},
+		{"too long", long, false},
+		{"control characters", "bad\nid", false},
+		{"spaces", "bad id", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			h := middleware.RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = logging.RequestID(r.Context())
+			}))
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Request-ID", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			got := rec.Header().Get("X-Request-ID")
+			if got == "" || got != seen {
+				t.Fatalf("response ID %q, context ID %q; want the same non-empty ID", got, seen)
+			}
+			if (got == tt.header) != tt.keep {
+				t.Errorf("ID = %q for header %q, want kept = %v", got, tt.header, tt.keep)
+			}
+		})
+	}
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	logs := captureLogs(t)
+	h := middleware.RequestIDMiddleware(middleware.LoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		middleware.WriteError(w, r, http.StatusTeapot, "teapot", "short and stout")
+	})))
+
+	req := httptest.NewRequest("POST", "/brew?kind=tea", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var body middleware.ErrorResponse
+	if err := json.NewDecoder(bytes.NewReader(rec.Body.Bytes())).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.RequestID != "req-42" {
+		t.Errorf("error body request_id = %q, want req-42", body.RequestID)
+	}
+
+	var line map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+		t.Fatalf("log is not a single JSON line: %v\n%s", err, logs.String())
+	}
+	want := map[string]any{
+		"method":     "POST",
+		"path":       "/brew",
+		"status":     float64(http.StatusTeapot),
+		"bytes":      float64(rec.Body.Len()),
+		"request_id": "req-42",
+		"remote_ip":  "192.0.2.1",
+	}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("log %s = %v, want %v", key, line[key], value)
+		}
+	}
+	if _, ok := line["duration_ms"].(float64); !ok {
+		t.Errorf("log has no duration_ms: %v", line)
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rizqishq/Go-REST/metrics"
+)
+
+// unmatchedRoute labels requests that matched no route, so that scans of
+// random paths cannot create new series
+const unmatchedRoute = "unmatched"
+
+// routeVarRE matches the pattern of a route variable such as {id:[0-9]+}
+var routeVarRE = regexp.MustCompile(`\{([^:}]+):[^}]*\}`)
+
+// MetricsMiddleware counts requests and measures their latency by method,
+// route template and status class, and tracks how many are in flight. Wrap
+// the router's NotFoundHandler and MethodNotAllowedHandler with it too, since
+// mux only runs middleware for matched routes.
+func MetricsMiddleware(reg *metrics.Registry) func(http.Handler) http.Handler {
+	labels := []string{"method", "route", "status_class"}
+	requests := reg.NewCounterVec("http_requests_total", "HTTP requests handled.", labels...)
+	duration := reg.NewHistogramVec("http_request_duration_seconds", "Time taken to handle HTTP requests.", metrics.DefBuckets, labels...)
+	inFlight := reg.NewGauge("http_requests_in_flight", "HTTP requests currently being handled.")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			inFlight.Inc()
+			defer inFlight.Dec()
+
+			rw := &responseWriter{
+				ResponseWriter: w,
+				statusCode:     http.StatusOK,
+			}
+			next.ServeHTTP(rw, r)
+
+			values := []string{methodLabel(r.Method), routeLabel(r), strconv.Itoa(rw.statusCode/100) + "xx"}
+			requests.With(values...).Inc()
+			duration.With(values...).Observe(time.Since(start).Seconds())
+		})
+	}
+}
+
+// routeLabel returns the template of the route r matched, with variable
+// patterns left out: /api/v1/users/{id}
+func routeLabel(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return unmatchedRoute
+	}
+	tmpl, err := route.GetPathTemplate()
+	if err != nil {
+		return unmatchedRoute
+	}
+	return routeVarRE.ReplaceAllString(tmpl, "{$1}")
+}
+
+// methodLabel keeps the label to the standard methods
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
@@ -0,0 +1,76 @@
+package middleware_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/rizqishq/Go-REST/metrics"
+	"github.com/rizqishq/Go-REST/middleware"
+)
+
+func scrape(t *testing.T, reg *metrics.Registry) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	reg := metrics.NewRegistry()
+	instrument := middleware.MetricsMiddleware(reg)
+
+	router := mux.NewRouter()
+	router.NotFoundHandler = instrument(middleware.NotFoundHandler())
+	router.MethodNotAllowedHandler = instrument(middleware.MethodNotAllowedHandler())
+	router.Use(instrument)
+
+	var inFlight string
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/users/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {
+		inFlight = scrape(t, reg)
+		if mux.Vars(r)["id"] == "0" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}).Methods("GET")
+
+	for _, req := range []struct{ method, path string }{
+		{"GET", "/api/v1/users/1"},
+		{"GET", "/api/v1/users/2"},
+		{"GET", "/api/v1/users/0"},
+		{"DELETE", "/api/v1/users/1"},
+		{"GET", "/no/such/path"},
+		{"BREW", "/no/such/path"},
+	} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, nil))
+	}
+
+	if !strings.Contains(inFlight, "\nhttp_requests_in_flight 1\n") {
+		t.Errorf("scrape during a request does not count it in flight:\n%s", inFlight)
+	}
+
+	got := scrape(t, reg)
+	for _, line := range []string{
+		`http_requests_total{method="GET",route="/api/v1/users/{id}",status_class="2xx"} 2`,
+		`http_requests_total{method="GET",route="/api/v1/users/{id}",status_class="4xx"} 1`,
+		`http_requests_total{method="GET",route="unmatched",status_class="4xx"} 1`,
+		`http_requests_total{method="DELETE",route="unmatched",status_class="4xx"} 1`,
+		`http_requests_total{method="OTHER",route="unmatched",status_class="4xx"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/api/v1/users/{id}",status_class="2xx"} 2`,
+		`http_request_duration_seconds_bucket{method="GET",route="/api/v1/users/{id}",status_class="2xx",le="+Inf"} 2`,
+		`http_requests_in_flight 0`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("scrape is missing %q:\n%s", line, got)
+		}
+	}
+	if strings.Contains(got, "/no/such/path") || strings.Contains(got, "/users/1") {
+		t.Errorf("scrape contains a raw request path:\n%s", got)
+	}
+}
@@ -0,0 +1,211 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rizqishq/Go-REST/config"
+)
+
+// RateLimit is a token bucket of Requests tokens refilled over Period; parse
+// one with config.ParseRateLimit
+type RateLimit = config.RateLimit
+
+// RateLimitResult is the state of a bucket after a request took from it
+type RateLimitResult struct {
+	Allowed bool
+	// Remaining is the number of whole tokens left
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until a denied request would be allowed
+	RetryAfter time.Duration
+}
+
+// RateLimitStore keeps token buckets by key. Implementations must be safe for
+// concurrent use; a shared store lets several instances enforce one limit.
+type RateLimitStore interface {
+	// Take takes a token from the bucket of key at time now, creating a full
+	// bucket for limit if there is none
+	Take(ctx context.Context, key string, limit RateLimit, now time.Time) (RateLimitResult, error)
+}
+
+// InMemoryRateLimitStore keeps buckets in a map. Idle buckets are removed by
+// Evict, which RunEvictor calls periodically.
+type InMemoryRateLimitStore struct {
+	mutex   sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// full is when the bucket will have refilled completely
+	full time.Time
+}
+
+// Create new InMemoryRateLimitStore
+func NewInMemoryRateLimitStore() *InMemoryRateLimitStore {
+	return &InMemoryRateLimitStore{buckets: make(map[string]*bucket)}
+}
+
+func (s *InMemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit, now time.Time) (RateLimitResult, error) {
+	if err := ctx.Err(); err != nil {
+		return RateLimitResult{}, err
+	}
+	capacity := float64(limit.Requests)
+	perToken := limit.Period / time.Duration(limit.Requests)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		s.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += float64(elapsed) / float64(perToken)
+		b.last = now
+	}
+	b.tokens = min(b.tokens, capacity)
+
+	var result RateLimitResult
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) * float64(perToken))
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration((capacity - b.tokens) * float64(perToken))
+	b.full = now.Add(result.Reset)
+	return result, nil
+}
+
+// Evict removes the buckets that have refilled completely by now, which are
+// no different from missing ones, and returns how many it removed
+func (s *InMemoryRateLimitStore) Evict(now time.Time) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	n := 0
+	for key, b := range s.buckets {
+		if !b.full.After(now) {
+			delete(s.buckets, key)
+			n++
+		}
+	}
+	return n
+}
+
+// Len returns the number of buckets held
+func (s *InMemoryRateLimitStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.buckets)
+}
+
+// RunEvictor calls Evict every interval until ctx is done
+func (s *InMemoryRateLimitStore) RunEvictor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.Evict(now)
+		}
+	}
+}
+
+// RateLimitRule applies Limit to the requests that Key maps to the same key.
+// Requests for which Key returns "" are not limited by the rule.
+type RateLimitRule struct {
+	// Name separates the buckets of different rules in the store
+	Name  string
+	Limit RateLimit
+	Key   func(r *http.Request) string
+}
+
+// ClientIPKey keys requests by the IP address they came from
+func ClientIPKey(r *http.Request) string {
+	return remoteIP(r)
+}
+
+// UserKey keys requests by the authenticated user. It only sees users in
+// middleware that runs inside AuthMiddleware.
+func UserKey(r *http.Request) string {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		return ""
+	}
+	return strconv.FormatUint(uint64(user.ID), 10)
+}
+
+// RouteKey keys requests for one route, given as method and route template
+// like "POST /api/v1/users", by client IP. It needs the matched route, so use
+// it in middleware registered on the router.
+func RouteKey(route string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		if r.Method+" "+routeLabel(r) != route {
+			return ""
+		}
+		return remoteIP(r)
+	}
+}
+
+// RateLimitMiddleware takes a token for each rule that applies to a request,
+// in order, and answers 429 Too Many Requests as soon as one is exhausted.
+// Responses carry RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset
+// headers for the rule closest to its limit, here or in an enclosing
+// RateLimitMiddleware. When the store fails, requests are let through.
+func RateLimitMiddleware(store RateLimitStore, rules ...RateLimitRule) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			now := time.Now()
+			for _, rule := range rules {
+				key := rule.Key(r)
+				if key == "" {
+					continue
+				}
+				result, err := store.Take(r.Context(), rule.Name+":"+key, rule.Limit, now)
+				if err != nil {
+					slog.ErrorContext(r.Context(), "Could not check rate limit", "rule", rule.Name, "error", err)
+					continue
+				}
+				if !result.Allowed {
+					setRateLimitHeaders(w.Header(), rule.Limit, result, true)
+					w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+					WriteError(w, r, http.StatusTooManyRequests, CodeRateLimited, "Too many requests, retry later")
+					return
+				}
+				setRateLimitHeaders(w.Header(), rule.Limit, result, false)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// setRateLimitHeaders describes result unless the headers already describe a
+// bucket with fewer tokens left
+func setRateLimitHeaders(h http.Header, limit RateLimit, result RateLimitResult, force bool) {
+	if prev, err := strconv.Atoi(h.Get("RateLimit-Remaining")); err == nil && prev < result.Remaining && !force {
+		return
+	}
+	h.Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+	h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+}
+
+// ceilSeconds rounds d up to whole seconds
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,126 @@
+package middleware_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rizqishq/Go-REST/middleware"
+	"github.com/rizqishq/Go-REST/models"
+)
+
+func TestInMemoryRateLimitStore(t *testing.T) {
+	ctx := context.Background()
+	store := middleware.NewInMemoryRateLimitStore()
+	limit := middleware.RateLimit{Requests: 3, Period: 3 * time.Second}
+	now := time.Unix(1000, 0)
+
+	for i := 2; i >= 0; i-- {
+		res, err := store.Take(ctx, "a", limit, now)
+		if err != nil || !res.Allowed || res.Remaining != i {
+			t.Fatalf("take %d = %+v, %v; want allowed with %d remaining", 3-i, res, err, i)
+		}
+	}
+	res, _ := store.Take(ctx, "a", limit, now)
+	if res.Allowed || res.RetryAfter != time.Second || res.Reset != 3*time.Second {
+		t.Errorf("exhausted bucket = %+v, want denied, retry after 1s, reset in 3s", res)
+	}
+	if res, _ := store.Take(ctx, "b", limit, now); !res.Allowed {
+		t.Error("bucket b shares tokens with a")
+	}
+
+	// One token refills per second
+	if res, _ := store.Take(ctx, "a", limit, now.Add(1500*time.Millisecond)); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("after refill = %+v, want allowed with 0 remaining", res)
+	}
+
+	// b is full again 1s after its take, a 3s after its last take at 1.5s
+	if n := store.Evict(now.Add(500 * time.Millisecond)); n != 0 || store.Len() != 2 {
+		t.Errorf("evicted %d buckets before they refilled, %d left", n, store.Len())
+	}
+	if n := store.Evict(now.Add(2 * time.Second)); n != 1 || store.Len() != 1 {
+		t.Errorf("evicted %d buckets at 2s, %d left; want b evicted", n, store.Len())
+	}
+	if n := store.Evict(now.Add(4500 * time.Millisecond)); n != 1 || store.Len() != 0 {
+		t.Errorf("evicted %d buckets at 4.5s, %d left; want a evicted", n, store.Len())
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := store.Take(canceled, "a", limit, now); err == nil {
+		t.Error("Take with a canceled context succeeded")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	store := middleware.NewInMemoryRateLimitStore()
+	perIP := middleware.RateLimit{Requests: 5, Period: time.Minute}
+	signup := middleware.RateLimit{Requests: 2, Period: time.Hour}
+	perUser := middleware.RateLimit{Requests: 3, Period: time.Minute}
+
+	router := mux.NewRouter()
+	router.Use(middleware.RateLimitMiddleware(store,
+		middleware.RateLimitRule{Name: "ip", Limit: perIP, Key: middleware.ClientIPKey},
+		middleware.RateLimitRule{Name: "signup", Limit: signup, Key: middleware.RouteKey("POST /users")},
+	))
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	router.Handle("/users", ok).Methods("POST")
+	router.Handle("/users", ok).Methods("GET")
+
+	// The user limit runs inside authentication, faked here
+	limitUsers := middleware.RateLimitMiddleware(store, middleware.RateLimitRule{Name: "user", Limit: perUser, Key: middleware.UserKey})
+	router.Handle("/me", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(middleware.WithUser(r.Context(), &models.User{ID: 7}))
+		limitUsers(ok).ServeHTTP(w, r)
+	}))
+
+	do := func(method, path, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	expect := func(rec *httptest.ResponseRecorder, status int, limit, remaining string) {
+		t.Helper()
+		if rec.Code != status {
+			t.Fatalf("status = %d, want %d", rec.Code, status)
+		}
+		h := rec.Header()
+		if h.Get("RateLimit-Limit") != limit || h.Get("RateLimit-Remaining") != remaining {
+			t.Errorf("RateLimit-Limit, -Remaining = %s, %s; want %s, %s", h.Get("RateLimit-Limit"), h.Get("RateLimit-Remaining"), limit, remaining)
+		}
+	}
+
+	// The route limit is the tighter one and is reported
+	expect(do("POST", "/users", "192.0.2.1"), http.StatusOK, "2", "1")
+	expect(do("POST", "/users", "192.0.2.1"), http.StatusOK, "2", "0")
+	rec := do("POST", "/users", "192.0.2.1")
+	expect(rec, http.StatusTooManyRequests, "2", "0")
+	if got := rec.Header().Get("Retry-After"); got != "1800" {
+		t.Errorf("Retry-After = %q, want 1800", got)
+	}
+	var body middleware.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Code != middleware.CodeRateLimited {
+		t.Errorf("body = %s, want code %s", rec.Body.String(), middleware.CodeRateLimited)
+	}
+
+	// Other routes and clients are limited separately
+	expect(do("GET", "/users", "192.0.2.1"), http.StatusOK, "5", "1")
+	expect(do("POST", "/users", "192.0.2.2"), http.StatusOK, "2", "1")
+
+	// The user limit is reported once it is tighter than the IP limit
+	expect(do("GET", "/me", "192.0.2.3"), http.StatusOK, "3", "2")
+	expect(do("GET", "/me", "192.0.2.4"), http.StatusOK, "3", "1")
+	expect(do("GET", "/me", "192.0.2.5"), http.StatusOK, "3", "0")
+	expect(do("GET", "/me", "192.0.2.6"), http.StatusTooManyRequests, "3", "0")
+
+	// The IP limit covers every route
+	expect(do("GET", "/users", "192.0.2.1"), http.StatusOK, "5", "0")
+	expect(do("GET", "/nothing", "192.0.2.1"), http.StatusNotFound, "", "")
+	expect(do("GET", "/users", "192.0.2.1"), http.StatusTooManyRequests, "5", "0")
+}
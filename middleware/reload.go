@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// ReloadableMiddleware applies whichever middleware was set last, so settings
+// such as CORS origins and rate limits can change while the server runs.
+// Requests in flight finish with the middleware they started with.
+type ReloadableMiddleware struct {
+	current atomic.Pointer[func(http.Handler) http.Handler]
+}
+
+// Create new ReloadableMiddleware applying mw until Set is called
+func NewReloadableMiddleware(mw func(http.Handler) http.Handler) *ReloadableMiddleware {
+	m := &ReloadableMiddleware{}
+	m.Set(mw)
+	return m
+}
+
+// Set makes requests from now on go through mw
+func (m *ReloadableMiddleware) Set(mw func(http.Handler) http.Handler) {
+	m.current.Store(&mw)
+}
+
+// Middleware wraps next in the current middleware on every request
+func (m *ReloadableMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		(*m.current.Load())(next).ServeHTTP(w, r)
+	})
+}
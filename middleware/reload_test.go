@@ -0,0 +1,36 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/rizqishq/Go-REST/middleware"
+)
+
+func TestReloadableMiddleware(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+	cors := func(origins ...string) func(http.Handler) http.Handler {
+		return middleware.CORSMiddleware(router, middleware.CORSOptions{AllowedOrigins: origins})
+	}
+	reloadable := middleware.NewReloadableMiddleware(cors("https://old.example.com"))
+	h := reloadable.Middleware(router)
+
+	allowed := func(origin string) bool {
+		req := httptest.NewRequest("GET", "/users", nil)
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Header().Get("Access-Control-Allow-Origin") == origin
+	}
+
+	if !allowed("https://old.example.com") || allowed("https://new.example.com") {
+		t.Fatal("the initial middleware is not applied")
+	}
+	reloadable.Set(cors("https://new.example.com"))
+	if allowed("https://old.example.com") || !allowed("https://new.example.com") {
+		t.Error("the middleware set later is not applied")
+	}
+}
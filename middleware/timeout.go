@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// StatusClientClosedRequest is recorded for requests the client abandoned
+// before a response was written. It is never seen by the client, only in the
+// access log (nginx uses the same code).
+const StatusClientClosedRequest = 499
+
+// TimeoutMiddleware gives every request a deadline of timeout. Handlers see it
+// on r.Context() and stop their work once it passes; a zero timeout leaves
+// requests unbounded.
+func TimeoutMiddleware(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if timeout <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// WriteContextError answers a request whose work was cut short by its
+// context: 504 once the deadline has passed, or only 499 for the access log
+// when the client went away. It writes nothing and returns false otherwise.
+func WriteContextError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(r.Context().Err(), context.DeadlineExceeded):
+		WriteError(w, r, http.StatusGatewayTimeout, CodeTimeout, "The request took too long to complete")
+	case errors.Is(err, context.Canceled), r.Context().Err() != nil:
+		w.WriteHeader(StatusClientClosedRequest)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package middleware_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rizqishq/Go-REST/middleware"
+)
+
+// waitForContext blocks until the request's context is done and reports it
+// the way the controllers do
+var waitForContext = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	<-r.Context().Done()
+	if !middleware.WriteContextError(w, r, r.Context().Err()) {
+		http.Error(w, "context error not handled", http.StatusInternalServerError)
+	}
+})
+
+// created answers 201 with a body and a header, and whether it had a deadline
+var created = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	deadline := "no"
+	if _, ok := r.Context().Deadline(); ok {
+		deadline = "yes"
+	}
+	w.Header().Set("X-Deadline", deadline)
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("created"))
+})
+
+func TestTimeoutMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		handler  http.Handler
+		cancel   bool
+		status   int
+		body     string
+		deadline string
+	}{
+		{"slow handler", 10 * time.Millisecond, waitForContext, false, http.StatusGatewayTimeout, "", ""},
+		{"client went away", time.Minute, waitForContext, true, middleware.StatusClientClosedRequest, "", ""},
+		{"fast handler", time.Minute, created, false, http.StatusCreated, "created", "yes"},
+		{"no timeout", 0, created, false, http.StatusCreated, "created", "no"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			h := middleware.LoggingMiddleware(middleware.TimeoutMiddleware(tt.timeout)(tt.handler))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				time.AfterFunc(10*time.Millisecond, cancel)
+			}
+			req := httptest.NewRequest("GET", "/slow", nil).WithContext(ctx)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			var line map[string]any
+			if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+				t.Fatalf("log is not a single JSON line: %v\n%s", err, logs)
+			}
+			if line["status"] != float64(tt.status) {
+				t.Errorf("logged status = %v, want %d", line["status"], tt.status)
+			}
+
+			switch tt.status {
+			case http.StatusGatewayTimeout:
+				if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+					t.Errorf("Content-Type = %q, want application/json", ct)
+				}
+				var resp middleware.ErrorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Code != middleware.CodeTimeout {
+					t.Errorf("error body = %s, want code %q", rec.Body, middleware.CodeTimeout)
+				}
+			default:
+				if rec.Body.String() != tt.body {
+					t.Errorf("body = %q, want %q", rec.Body, tt.body)
+				}
+				if got := rec.Header().Get("X-Deadline"); got != tt.deadline {
+					t.Errorf("handler saw a deadline: %q, want %q", got, tt.deadline)
+				}
+			}
+		})
+	}
+}
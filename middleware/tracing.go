@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/rizqishq/Go-REST/tracing"
+)
+
+// TracingMiddleware starts a span for every request, continuing the trace of
+// a valid W3C traceparent header or starting a new one. Services and
+// repositories add child spans through the request context. Register
+// SpanRouteMiddleware on the router to name the span after the route.
+func TracingMiddleware(tracer *tracing.Tracer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if parent, err := tracing.ParseTraceparent(r.Header.Get("traceparent")); err == nil {
+				ctx = tracing.WithRemoteParent(ctx, parent)
+			}
+			ctx, span := tracer.Start(ctx, "HTTP "+r.Method)
+			defer span.End()
+			span.SetAttributes(
+				tracing.Attr{Key: "http.method", Value: r.Method},
+				tracing.Attr{Key: "http.target", Value: r.URL.Path},
+			)
+
+			rw := &responseWriter{
+				ResponseWriter: w,
+				statusCode:     http.StatusOK,
+			}
+			next.ServeHTTP(rw, r.WithContext(ctx))
+
+			span.SetAttributes(tracing.Attr{Key: "http.status_code", Value: rw.statusCode})
+			if rw.statusCode >= http.StatusInternalServerError {
+				span.RecordError(statusError(rw.statusCode))
+			}
+		})
+	}
+}
+
+// SpanRouteMiddleware names the request span after the matched route
+// template, e.g. "GET /api/v1/users/{id}"
+func SpanRouteMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if span := tracing.SpanFromContext(r.Context()); span != nil {
+			route := routeLabel(r)
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(tracing.Attr{Key: "http.route", Value: route})
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statusError marks a span failed by its response status
+type statusError int
+
+func (e statusError) Error() string { return http.StatusText(int(e)) }
@@ -0,0 +1,79 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/rizqishq/Go-REST/middleware"
+	"github.com/rizqishq/Go-REST/tracing"
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	logs := captureLogs(t)
+	exporter := tracing.NewInMemoryExporter()
+
+	router := mux.NewRouter()
+	router.Use(middleware.SpanRouteMiddleware)
+	router.HandleFunc("/api/v1/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracing.Start(r.Context(), "UserService.GetUser")
+		span.End()
+		middleware.WriteError(w, r.WithContext(ctx), http.StatusInternalServerError, "internal_error", "boom")
+	}).Methods("GET")
+	h := middleware.TracingMiddleware(tracing.NewTracer(exporter))(middleware.LoggingMiddleware(router))
+
+	req := httptest.NewRequest("GET", "/api/v1/users/7", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2: %+v", len(spans), spans)
+	}
+	child, server := spans[0], spans[1]
+	if server.Name != "GET /api/v1/users/{id}" {
+		t.Errorf("server span name = %q, want the route", server.Name)
+	}
+	if server.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || server.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("server span = %+v, want it to continue the traceparent", server)
+	}
+	if child.TraceID != server.TraceID || child.ParentSpanID != server.SpanID {
+		t.Errorf("child span = %+v, want a child of %s", child, server.SpanID)
+	}
+	if server.Error == "" {
+		t.Error("server span of a 500 response has no error")
+	}
+
+	var body middleware.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.TraceID != server.TraceID {
+		t.Errorf("error body trace_id = %q, want %q", body.TraceID, server.TraceID)
+	}
+
+	var line map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+		t.Fatalf("log is not a single JSON line: %v\n%s", err, logs.String())
+	}
+	if line["trace_id"] != server.TraceID || line["span_id"] != server.SpanID {
+		t.Errorf("log trace_id, span_id = %v, %v; want %s, %s", line["trace_id"], line["span_id"], server.TraceID, server.SpanID)
+	}
+}
+
+func TestTracingMiddlewareStartsTrace(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	h := middleware.TracingMiddleware(tracing.NewTracer(exporter))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("POST", "/users", nil)
+	req.Header.Set("traceparent", "not-a-traceparent")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.Spans()
+	if len(spans) != 1 || spans[0].ParentSpanID != "" || spans[0].Name != "HTTP POST" {
+		t.Errorf("exported %+v, want one new root span", spans)
+	}
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditAction is the kind of change an audit entry records
+type AuditAction string
+
+const (
+	AuditCreate  AuditAction = "create"
+	AuditUpdate  AuditAction = "update"
+	AuditDelete  AuditAction = "delete"
+	AuditRestore AuditAction = "restore"
+	AuditPurge   AuditAction = "purge"
+)
+
+// Valid reports whether a is a known action
+func (a AuditAction) Valid() bool {
+	switch a {
+	case AuditCreate, AuditUpdate, AuditDelete, AuditRestore, AuditPurge:
+		return true
+	}
+	return false
+}
+
+// AuditEntry records who changed which user, how and when
+type AuditEntry struct {
+	ID uint `json:"id"`
+	// ActorID is 0 for changes made by the system or an anonymous client;
+	// Actor then names which one it was
+	ActorID   uint          `json:"actor_id,omitempty"`
+	Actor     string        `json:"actor"`
+	Action    AuditAction   `json:"action"`
+	UserID    uint          `json:"user_id"`
+	Changes   []FieldChange `json:"changes,omitempty"`
+	RequestID string        `json:"request_id,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// FieldChange is the JSON value of one user field before and after a change.
+// Old is omitted for fields that had no value and New for fields that were
+// cleared. Password values are never recorded, only that one was set.
+type FieldChange struct {
+	Field    string          `json:"field"`
+	Old      json.RawMessage `json:"old,omitempty" swaggertype:"object"`
+	New      json.RawMessage `json:"new,omitempty" swaggertype:"object"`
+	Redacted bool            `json:"redacted,omitempty"`
+}
+
+// AuditListResponse is a page of audit entries returned by GET /audit
+type AuditListResponse struct {
+	Data []AuditEntry `json:"data"`
+}
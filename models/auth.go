@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken is the server-side record of an issued refresh token. Only
+// the hash of the token is stored. Tokens rotated from the same login share
+// a FamilyID so a replayed token can revoke the whole session.
+type RefreshToken struct {
+	TokenHash string
+	UserID    uint
+	FamilyID  string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	Revoked   bool
+}
+
+// LoginRequest for POST /auth/login
+type LoginRequest struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// RefreshRequest for POST /auth/refresh and POST /auth/logout
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// TokenResponse is returned by a successful login or refresh
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"slices"
+)
+
+// Role is a named set of permissions assigned to a user
+type Role string
+
+const (
+	RoleAdmin Role = "admin"
+	RoleUser  Role = "user"
+)
+
+// Permission grants access to an operation on any user. Users can always
+// read and update their own account without one.
+type Permission string
+
+const (
+	PermUsersList          Permission = "users:list"
+	PermUsersRead          Permission = "users:read"
+	PermUsersUpdate        Permission = "users:update"
+	PermUsersDelete        Permission = "users:delete"
+	PermUsersManageRoles   Permission = "users:manage_roles"
+	PermUsersManageDeleted Permission = "users:manage_deleted"
+	PermAuditRead          Permission = "audit:read"
+)
+
+// AllPermissions lists every known permission
+var AllPermissions = []Permission{
+	PermUsersList,
+	PermUsersRead,
+	PermUsersUpdate,
+	PermUsersDelete,
+	PermUsersManageRoles,
+	PermUsersManageDeleted,
+	PermAuditRead,
+}
+
+// RolePermissions maps each role to the permissions it implies
+var RolePermissions = map[Role][]Permission{
+	RoleAdmin: AllPermissions,
+	RoleUser:  {},
+}
+
+// Valid reports whether r is a known role
+func (r Role) Valid() bool {
+	_, ok := RolePermissions[r]
+	return ok
+}
+
+// Valid reports whether p is a known permission
+func (p Permission) Valid() bool {
+	return slices.Contains(AllPermissions, p)
+}
+
+// UpdateRoleRequest for PUT /users/{id}/role
+type UpdateRoleRequest struct {
+	Role        Role         `json:"role" validate:"required"`
+	Permissions []Permission `json:"permissions"`
+}
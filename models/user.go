@@ -1,58 +1,100 @@
 package models
 
 import (
+	"slices"
 	"time"
 )
 
 // User represents a user in the system
 type User struct {
-	ID        uint      `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	Password  string    `json:"-"` 
-	FirstName string    `json:"first_name"`
-	LastName  string    `json:"last_name"`
+	ID        uint   `json:"id"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	Password  string `json:"-"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	// Role and Permissions together decide what the user may do; Permissions
+	// are grants on top of the ones the role implies
+	Role        Role         `json:"role"`
+	Permissions []Permission `json:"permissions,omitempty"`
+	// Version starts at 1 and is incremented by every update; writes based
+	// on an older version are rejected
+	Version   uint64    `json:"version"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt is set while the user is soft-deleted; such users can only be
+	// seen and restored by admins until they are purged
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
-// UserResponse is the struct returned to clients 
+// UserResponse is the struct returned to clients
 type UserResponse struct {
-	ID        uint      `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	FirstName string    `json:"first_name"`
-	LastName  string    `json:"last_name"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID          uint         `json:"id"`
+	Username    string       `json:"username"`
+	Email       string       `json:"email"`
+	FirstName   string       `json:"first_name"`
+	LastName    string       `json:"last_name"`
+	Role        Role         `json:"role"`
+	Permissions []Permission `json:"permissions,omitempty"`
+	Version     uint64       `json:"version"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+	DeletedAt   *time.Time   `json:"deleted_at,omitempty"`
 }
 
 func (u *User) ToResponse() UserResponse {
 	return UserResponse{
-		ID:        u.ID,
-		Username:  u.Username,
-		Email:     u.Email,
-		FirstName: u.FirstName,
-		LastName:  u.LastName,
-		CreatedAt: u.CreatedAt,
-		UpdatedAt: u.UpdatedAt,
+		ID:          u.ID,
+		Username:    u.Username,
+		Email:       u.Email,
+		FirstName:   u.FirstName,
+		LastName:    u.LastName,
+		Role:        u.EffectiveRole(),
+		Permissions: u.Permissions,
+		Version:     u.Version,
+		CreatedAt:   u.CreatedAt,
+		UpdatedAt:   u.UpdatedAt,
+		DeletedAt:   u.DeletedAt,
 	}
 }
 
+// EffectiveRole returns the user's role; accounts stored before roles existed
+// count as regular users
+func (u *User) EffectiveRole() Role {
+	if u.Role == "" {
+		return RoleUser
+	}
+	return u.Role
+}
+
+// HasPermission reports whether the user's role or explicit grants include p
+func (u *User) HasPermission(p Permission) bool {
+	return slices.Contains(RolePermissions[u.EffectiveRole()], p) || slices.Contains(u.Permissions, p)
+}
+
+// UserListResponse is a page of users returned by GET /users
+type UserListResponse struct {
+	Data       []UserResponse `json:"data"`
+	Total      int            `json:"total"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
 // CreateUserRequest for POST /users
 type CreateUserRequest struct {
-	Username  string `json:"username"`
-	Email     string `json:"email"`
-	Password  string `json:"password"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
+	Username  string `json:"username" validate:"required,min=3,max=32,username"`
+	Email     string `json:"email" validate:"required,max=254,email"`
+	Password  string `json:"password" validate:"required,password"`
+	FirstName string `json:"first_name" validate:"max=64"`
+	LastName  string `json:"last_name" validate:"max=64"`
 }
 
-// UpdateUserRequest for PUT /users/{id}
+// UpdateUserRequest for PUT /users/{id}. It replaces the whole user, so
+// omitted names are cleared; the password is write-only and is kept unless a
+// new one is given.
 type UpdateUserRequest struct {
-	Username  string `json:"username"`
-	Email     string `json:"email"`
-	Password  string `json:"password"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
+	Username  string `json:"username" validate:"required,min=3,max=32,username"`
+	Email     string `json:"email" validate:"required,max=254,email"`
+	Password  string `json:"password,omitempty" validate:"password"`
+	FirstName string `json:"first_name" validate:"max=64"`
+	LastName  string `json:"last_name" validate:"max=64"`
 }
@@ -0,0 +1,130 @@
+package repositories
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rizqishq/Go-REST/models"
+)
+
+// AuditQuery selects audit entries in ascending ID order. Zero values disable
+// a filter.
+type AuditQuery struct {
+	UserID uint
+	Action models.AuditAction
+	// Since keeps entries created at or after it
+	Since time.Time
+	// AfterID keeps entries with a greater ID, for paging
+	AfterID uint
+	// Limit caps the number of entries; 0 returns every match
+	Limit int
+}
+
+// AuditRepository interface to abstract audit log storage. Entries are only
+// ever added; Create sets the ID, which grows with every entry.
+type AuditRepository interface {
+	Create(ctx context.Context, entry *models.AuditEntry) error
+	Query(ctx context.Context, q AuditQuery) ([]models.AuditEntry, error)
+}
+
+// InMemoryAuditRepository implements AuditRepository in memory. Entries
+// created within an InMemoryTransactor transaction are dropped when it fails.
+type InMemoryAuditRepository struct {
+	entries []models.AuditEntry
+	mutex   sync.RWMutex
+	nextID  uint
+}
+
+// Create new empty repository
+func NewInMemoryAuditRepository() *InMemoryAuditRepository {
+	return &InMemoryAuditRepository{nextID: 1}
+}
+
+// cloneEntry returns a deep copy of entry
+func cloneEntry(entry *models.AuditEntry) models.AuditEntry {
+	clone := *entry
+	clone.Changes = slices.Clone(entry.Changes)
+	for i := range clone.Changes {
+		clone.Changes[i].Old = slices.Clone(clone.Changes[i].Old)
+		clone.Changes[i].New = slices.Clone(clone.Changes[i].New)
+	}
+	return clone
+}
+
+func (r *InMemoryAuditRepository) Create(ctx context.Context, entry *models.AuditEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	entry.ID = r.nextID
+	r.nextID++
+	r.entries = append(r.entries, cloneEntry(entry))
+
+	id := entry.ID
+	onRollback(ctx, func() { r.remove(id) })
+	return nil
+}
+
+func (r *InMemoryAuditRepository) Query(ctx context.Context, q AuditQuery) ([]models.AuditEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	// Entries are kept in ID order, so skip straight past AfterID
+	start, _ := slices.BinarySearchFunc(r.entries, q.AfterID+1, func(e models.AuditEntry, id uint) int {
+		return cmp.Compare(e.ID, id)
+	})
+	entries := make([]models.AuditEntry, 0)
+	for i := start; i < len(r.entries) && (q.Limit <= 0 || len(entries) < q.Limit); i++ {
+		if matchesAuditQuery(&r.entries[i], q) {
+			entries = append(entries, cloneEntry(&r.entries[i]))
+		}
+	}
+	return entries, nil
+}
+
+// matchesAuditQuery reports whether entry passes the filters of q, apart from
+// AfterID and Limit
+func matchesAuditQuery(entry *models.AuditEntry, q AuditQuery) bool {
+	if q.UserID != 0 && entry.UserID != q.UserID {
+		return false
+	}
+	if q.Action != "" && entry.Action != q.Action {
+		return false
+	}
+	if !q.Since.IsZero() && entry.CreatedAt.Before(q.Since) {
+		return false
+	}
+	return true
+}
+
+// put stores entry as-is, keeping nextID ahead of every known ID. Entries
+// must be put in ID order.
+func (r *InMemoryAuditRepository) put(entry *models.AuditEntry) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.entries = append(r.entries, cloneEntry(entry))
+	if entry.ID >= r.nextID {
+		r.nextID = entry.ID + 1
+	}
+}
+
+// remove drops an entry without reporting whether it existed.
+func (r *InMemoryAuditRepository) remove(id uint) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.entries = slices.DeleteFunc(r.entries, func(e models.AuditEntry) bool {
+		return e.ID == id
+	})
+}
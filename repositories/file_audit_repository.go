@@ -0,0 +1,199 @@
+package repositories
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rizqishq/Go-REST/models"
+)
+
+const auditFileName = "audit.log"
+
+// FileAuditRepository implements AuditRepository for the file backend. New
+// entries are written to the log of the FileUserRepository, in the same
+// record as the user changes of their FileTransactor transaction, and then
+// copied to an append-only audit log with one JSON entry per line. The audit
+// log is fsynced before the user log is compacted, and entries that did not
+// reach it are recovered from the user log on startup. Queries are served
+// from memory.
+type FileAuditRepository struct {
+	mem   *InMemoryAuditRepository
+	users *FileUserRepository
+
+	// mutex guards the audit log file
+	mutex sync.Mutex
+	file  *os.File
+	size  int64
+	// lastID is the last entry in the file; unsaved entries are only in the
+	// user log so far
+	lastID  uint
+	unsaved []models.AuditEntry
+}
+
+// NewFileAuditRepository opens (or creates) the audit log next to the log of
+// users and loads every entry, including those only found in the user log
+func NewFileAuditRepository(users *FileUserRepository) (*FileAuditRepository, error) {
+	file, err := os.OpenFile(filepath.Join(users.dir, auditFileName), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	r := &FileAuditRepository{mem: NewInMemoryAuditRepository(), users: users, file: file}
+	if err := r.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := users.attachAudit(r); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Close saves any remaining entries and releases the audit log
+func (r *FileAuditRepository) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.syncLocked()
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	r.file = nil
+	return err
+}
+
+func (r *FileAuditRepository) Create(ctx context.Context, entry *models.AuditEntry) error {
+	// Take the user log first, as a transaction does, so IDs follow log order
+	unlock := r.users.lock(ctx)
+	defer unlock()
+
+	if err := r.mem.Create(withoutJournal(ctx), entry); err != nil {
+		return err
+	}
+
+	saved := cloneEntry(entry)
+	return r.users.log(ctx, walRecord{Op: opAudit, Audit: &saved},
+		func() { r.mem.remove(saved.ID) },
+		func() { r.save(saved) })
+}
+
+func (r *FileAuditRepository) Query(ctx context.Context, q AuditQuery) ([]models.AuditEntry, error) {
+	return r.mem.Query(ctx, q)
+}
+
+// save copies an entry that is durable in the user log to the audit log. It
+// is not fsynced until the user log is compacted; if it cannot be written it
+// is retried then.
+func (r *FileAuditRepository) save(entry models.AuditEntry) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.unsaved = append(r.unsaved, entry)
+	r.writeUnsaved()
+}
+
+// recover takes the entries replayed from the user log that are missing from
+// the audit log and saves them
+func (r *FileAuditRepository) recover(entries []models.AuditEntry) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i := range entries {
+		if entries[i].ID > r.lastID {
+			r.mem.put(&entries[i])
+			r.unsaved = append(r.unsaved, entries[i])
+		}
+	}
+	return r.syncLocked()
+}
+
+// sync writes and fsyncs every unsaved entry
+func (r *FileAuditRepository) sync() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.syncLocked()
+}
+
+// syncLocked is sync for callers that hold r.mutex
+func (r *FileAuditRepository) syncLocked() error {
+	if r.file == nil {
+		return errors.New("audit log is closed")
+	}
+	if err := r.writeUnsaved(); err != nil {
+		return err
+	}
+	if err := r.file.Sync(); err != nil {
+		return fmt.Errorf("sync audit log: %w", err)
+	}
+	return nil
+}
+
+// writeUnsaved appends the unsaved entries to the audit log. An entry that
+// cannot be written is cut off again and stays unsaved, with the ones after
+// it. Callers must hold r.mutex.
+func (r *FileAuditRepository) writeUnsaved() error {
+	if r.file == nil {
+		return errors.New("audit log is closed")
+	}
+	for len(r.unsaved) > 0 {
+		entry := &r.unsaved[0]
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("encode audit entry: %w", err)
+		}
+		line = append(line, '\n')
+
+		if _, err := r.file.WriteAt(line, r.size); err != nil {
+			r.file.Truncate(r.size)
+			return fmt.Errorf("write audit entry: %w", err)
+		}
+		r.size += int64(len(line))
+		r.lastID = entry.ID
+		r.unsaved = r.unsaved[1:]
+	}
+	return nil
+}
+
+// load reads every entry. A final line without a trailing newline is the
+// remains of an interrupted write and is cut off; any other undecodable line
+// is reported as corruption.
+func (r *FileAuditRepository) load() error {
+	reader := bufio.NewReader(r.file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				if err := r.file.Truncate(r.size); err != nil {
+					return fmt.Errorf("truncate torn audit entry: %w", err)
+				}
+				if err := r.file.Sync(); err != nil {
+					return fmt.Errorf("sync audit log: %w", err)
+				}
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read audit log: %w", err)
+		}
+
+		var entry models.AuditEntry
+		if err := json.Unmarshal(bytes.TrimSpace(line), &entry); err != nil {
+			return fmt.Errorf("corrupt audit entry at offset %d: %w", r.size, err)
+		}
+		r.mem.put(&entry)
+		r.size += int64(len(line))
+		r.lastID = entry.ID
+	}
+}
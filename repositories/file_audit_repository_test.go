@@ -0,0 +1,167 @@
+package repositories_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rizqishq/Go-REST/models"
+	"github.com/rizqishq/Go-REST/repositories"
+)
+
+// openFileStore opens the file-backed users and audit log in dir
+func openFileStore(t *testing.T, dir string, snapshotInterval int) (*repositories.FileUserRepository, *repositories.FileAuditRepository, *repositories.FileTransactor) {
+	t.Helper()
+	users := openFileRepository(t, dir, snapshotInterval)
+	audit, err := repositories.NewFileAuditRepository(users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { audit.Close() })
+	return users, audit, repositories.NewFileTransactor(users)
+}
+
+// createAudited creates a user and its audit entry in one transaction
+func createAudited(t *testing.T, tx repositories.Transactor, users repositories.UserRepository, audit repositories.AuditRepository, name string) {
+	t.Helper()
+	err := tx.WithinTransaction(context.Background(), func(ctx context.Context) error {
+		user := &models.User{Username: name, Email: name + "@example.com"}
+		if err := users.Create(ctx, user); err != nil {
+			return err
+		}
+		return audit.Create(ctx, &models.AuditEntry{Actor: "system", Action: models.AuditCreate, UserID: user.ID})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func countStored(t *testing.T, users repositories.UserRepository, audit repositories.AuditRepository) (int, int) {
+	t.Helper()
+	all, err := users.FindAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := audit.Query(context.Background(), repositories.AuditQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, entry := range entries {
+		if entry.ID != uint(i+1) {
+			t.Errorf("audit entry %d has ID %d", i, entry.ID)
+		}
+	}
+	return len(all), len(entries)
+}
+
+// firstLine returns data up to and including its first newline
+func firstLine(data []byte) []byte {
+	return data[:bytes.IndexByte(data, '\n')+1]
+}
+
+func TestFileTransactionIsOneRecord(t *testing.T) {
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, "users.wal")
+	auditPath := filepath.Join(dir, "audit.log")
+
+	users, audit, tx := openFileStore(t, dir, 0)
+	createAudited(t, tx, users, audit, "john")
+	createAudited(t, tx, users, audit, "jane")
+	users.Close()
+	audit.Close()
+
+	wal, err := os.ReadFile(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(wal, []byte("\n")); n != 2 {
+		t.Fatalf("log has %d records for 2 transactions, want 2", n)
+	}
+	auditLog, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash while committing the second transaction tears its record.
+	// Entries are only copied to the audit log after a commit, so the
+	// audit log ends with the first entry.
+	first := len(firstLine(wal))
+	torn := wal[:first+(len(wal)-first)/2]
+	if err := os.WriteFile(walPath, torn, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(auditPath, firstLine(auditLog), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	users, audit, _ = openFileStore(t, dir, 0)
+	if nUsers, nEntries := countStored(t, users, audit); nUsers != 1 || nEntries != 1 {
+		t.Errorf("after a torn commit: %d users and %d audit entries, want 1 and 1", nUsers, nEntries)
+	}
+}
+
+func TestFileAuditRepositoryRecoversFromUserLog(t *testing.T) {
+	dir := t.TempDir()
+	auditPath := filepath.Join(dir, "audit.log")
+
+	users, audit, tx := openFileStore(t, dir, 0)
+	for _, name := range []string{"john", "jane", "joe"} {
+		createAudited(t, tx, users, audit, name)
+	}
+	users.Close()
+	audit.Close()
+
+	// A crash after the second commit but before its entry was copied
+	auditLog, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(auditPath, firstLine(auditLog), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	users, audit, tx = openFileStore(t, dir, 0)
+	if nUsers, nEntries := countStored(t, users, audit); nUsers != 3 || nEntries != 3 {
+		t.Fatalf("after reopening: %d users and %d audit entries, want 3 and 3", nUsers, nEntries)
+	}
+	if data, _ := os.ReadFile(auditPath); !bytes.Equal(data, auditLog) {
+		t.Errorf("audit log not caught up:\n got %s\nwant %s", data, auditLog)
+	}
+	createAudited(t, tx, users, audit, "jill")
+	if _, nEntries := countStored(t, users, audit); nEntries != 4 {
+		t.Errorf("%d audit entries after another write, want 4", nEntries)
+	}
+}
+
+func TestFileAuditRepositoryCompaction(t *testing.T) {
+	dir := t.TempDir()
+
+	users, audit, tx := openFileStore(t, dir, 2)
+	for _, name := range []string{"john", "jane", "joe", "jill", "jack"} {
+		createAudited(t, tx, users, audit, name)
+	}
+	users.Close()
+	audit.Close()
+
+	// The entries compacted out of the user log are in the audit log, and
+	// the ones still in it are not recovered twice
+	users, audit, _ = openFileStore(t, dir, 2)
+	if nUsers, nEntries := countStored(t, users, audit); nUsers != 5 || nEntries != 5 {
+		t.Errorf("after reopening: %d users and %d audit entries, want 5 and 5", nUsers, nEntries)
+	}
+	audit.Close()
+	users.Close()
+
+	// Without an audit repository the log keeps its audit entries
+	users = openFileRepository(t, dir, 1)
+	if err := users.Create(context.Background(), &models.User{Username: "kim", Email: "kim@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	users.Close()
+	users, audit, _ = openFileStore(t, dir, 2)
+	if nUsers, nEntries := countStored(t, users, audit); nUsers != 6 || nEntries != 5 {
+		t.Errorf("after writing users only: %d users and %d audit entries, want 6 and 5", nUsers, nEntries)
+	}
+}
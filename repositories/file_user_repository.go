@@ -0,0 +1,558 @@
+package repositories
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rizqishq/Go-REST/models"
+)
+
+const (
+	walFileName      = "users.wal"
+	snapshotFileName = "users.snapshot"
+
+	opCreate = "create"
+	opUpdate = "update"
+	opDelete = "delete"
+	opAudit  = "audit"
+	opBatch  = "batch"
+)
+
+// storedUser is the on-disk form of a user. Unlike models.User it keeps the
+// password hash, which is hidden from API responses.
+type storedUser struct {
+	models.User
+	Password string `json:"password"`
+}
+
+func toStored(u *models.User) *storedUser {
+	return &storedUser{User: *u, Password: u.Password}
+}
+
+func (s *storedUser) toUser() *models.User {
+	u := s.User
+	u.Password = s.Password
+	if u.Version == 0 {
+		// Written before users were versioned
+		u.Version = 1
+	}
+	return &u
+}
+
+// walRecord is a single line of the write-ahead log
+type walRecord struct {
+	Seq   uint64             `json:"seq,omitempty"`
+	Op    string             `json:"op"`
+	ID    uint               `json:"id,omitempty"`
+	User  *storedUser        `json:"user,omitempty"`
+	Audit *models.AuditEntry `json:"audit,omitempty"`
+	// Ops are the records of a transaction, which take effect together
+	Ops []walRecord `json:"ops,omitempty"`
+}
+
+// snapshot is a compacted copy of every record up to and including Seq
+type snapshot struct {
+	Seq    uint64       `json:"seq"`
+	NextID uint         `json:"next_id"`
+	Users  []storedUser `json:"users"`
+}
+
+// FileUserRepository implements UserRepository on top of an append-only log.
+// Every mutation is written and fsynced before it is acknowledged, and the log
+// is compacted into a snapshot every snapshotInterval writes. Reads are served
+// from memory. The writes of a FileTransactor transaction, including those of
+// the FileAuditRepository sharing the log, are written as one record when it
+// commits.
+type FileUserRepository struct {
+	mem *InMemoryUserRepository
+
+	// mutex serializes writers so log order matches the order of mutations.
+	// A FileTransactor transaction holds it until it commits.
+	mutex            sync.Mutex
+	dir              string
+	wal              *os.File
+	seq              uint64
+	sinceSnapshot    int
+	snapshotInterval int
+
+	// audit saves the audit entries of the log before it is compacted;
+	// until one is attached, the entries replayed from the log are kept in
+	// replayedAudit and the log is not compacted
+	audit         *FileAuditRepository
+	replayedAudit []models.AuditEntry
+}
+
+// NewFileUserRepository opens (or creates) a repository in dir and replays the
+// latest snapshot and log. A snapshotInterval <= 0 disables compaction.
+func NewFileUserRepository(dir string, snapshotInterval int) (*FileUserRepository, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create data directory: %w", err)
+	}
+
+	r := &FileUserRepository{
+		mem:              NewInMemoryUserRepository(),
+		dir:              dir,
+		snapshotInterval: snapshotInterval,
+	}
+	if err := r.loadSnapshot(); err != nil {
+		return nil, err
+	}
+
+	wal, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open write-ahead log: %w", err)
+	}
+	if err := r.replay(wal); err != nil {
+		wal.Close()
+		return nil, err
+	}
+	r.wal = wal
+	return r, nil
+}
+
+// Close releases the write-ahead log
+func (r *FileUserRepository) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.wal == nil {
+		return nil
+	}
+	err := r.wal.Close()
+	r.wal = nil
+	return err
+}
+
+// Ping checks that the repository is open and its data directory exists
+func (r *FileUserRepository) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.wal == nil {
+		return errors.New("repository is closed")
+	}
+	_, err := os.Stat(r.dir)
+	return err
+}
+
+func (r *FileUserRepository) FindAll(ctx context.Context) ([]models.User, error) {
+	return r.mem.FindAll(ctx)
+}
+
+func (r *FileUserRepository) Query(ctx context.Context, q UserQuery) (*UserPage, error) {
+	return r.mem.Query(ctx, q)
+}
+
+func (r *FileUserRepository) FindByID(ctx context.Context, id uint) (*models.User, error) {
+	return r.mem.FindByID(ctx, id)
+}
+
+func (r *FileUserRepository) FindByUsername(ctx context.Context, username string) (*models.User, error) {
+	return r.mem.FindByUsername(ctx, username)
+}
+
+func (r *FileUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.mem.FindByEmail(ctx, email)
+}
+
+func (r *FileUserRepository) Create(ctx context.Context, user *models.User) error {
+	unlock := r.lock(ctx)
+	defer unlock()
+
+	if err := r.mem.Create(withoutJournal(ctx), user); err != nil {
+		return err
+	}
+
+	id := user.ID
+	return r.log(ctx, walRecord{Op: opCreate, ID: id, User: toStored(user)}, func() { r.mem.remove(id) }, nil)
+}
+
+func (r *FileUserRepository) Update(ctx context.Context, user *models.User) error {
+	unlock := r.lock(ctx)
+	defer unlock()
+
+	prev, err := r.mem.FindByID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	old := *prev
+
+	if err := r.mem.Update(withoutJournal(ctx), user); err != nil {
+		return err
+	}
+	return r.log(ctx, walRecord{Op: opUpdate, ID: user.ID, User: toStored(user)}, func() {
+		r.mem.put(&old)
+		user.Version = old.Version
+	}, nil)
+}
+
+// Delete soft-deletes a user. Deletion and restore are logged as updates;
+// opDelete records are written when a user is purged.
+func (r *FileUserRepository) Delete(ctx context.Context, id uint, deletedAt time.Time) error {
+	unlock := r.lock(ctx)
+	defer unlock()
+
+	prev, err := r.mem.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := r.mem.Delete(withoutJournal(ctx), id, deletedAt); err != nil {
+		return err
+	}
+	return r.logChange(ctx, prev)
+}
+
+func (r *FileUserRepository) FindDeleted(ctx context.Context) ([]models.User, error) {
+	return r.mem.FindDeleted(ctx)
+}
+
+func (r *FileUserRepository) FindDeletedByID(ctx context.Context, id uint) (*models.User, error) {
+	return r.mem.FindDeletedByID(ctx, id)
+}
+
+func (r *FileUserRepository) Restore(ctx context.Context, id uint) error {
+	unlock := r.lock(ctx)
+	defer unlock()
+
+	prev, ok := r.mem.get(id)
+	if !ok {
+		return ErrNotFound
+	}
+
+	if err := r.mem.Restore(withoutJournal(ctx), id); err != nil {
+		return err
+	}
+	return r.logChange(ctx, prev)
+}
+
+// Purge removes users one log record at a time. If a record cannot be
+// written, the users purged before it stay purged and the error is returned.
+// Within a transaction all of them are written when it commits.
+func (r *FileUserRepository) Purge(ctx context.Context, deletedBefore time.Time) ([]uint, error) {
+	unlock := r.lock(ctx)
+	defer unlock()
+
+	deleted, err := r.mem.FindDeleted(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uint
+	for i := range deleted {
+		user := &deleted[i]
+		if !purgeable(user, deletedBefore) {
+			continue
+		}
+		r.mem.remove(user.ID)
+		if err := r.log(ctx, walRecord{Op: opDelete, ID: user.ID}, func() { r.mem.put(user) }, nil); err != nil {
+			return ids, err
+		}
+		ids = append(ids, user.ID)
+	}
+	return ids, nil
+}
+
+// txFrom returns the FileTransactor transaction of ctx if it writes to r
+func (r *FileUserRepository) txFrom(ctx context.Context) *fileTx {
+	if tx, _ := ctx.Value(fileTxKey{}).(*fileTx); tx != nil && tx.users == r {
+		return tx
+	}
+	return nil
+}
+
+// lock takes r.mutex, unless the transaction of ctx already holds it
+func (r *FileUserRepository) lock(ctx context.Context) (unlock func()) {
+	if r.txFrom(ctx) != nil {
+		return func() {}
+	}
+	r.mutex.Lock()
+	return r.mutex.Unlock
+}
+
+// logChange logs the current state of a user that was just changed in
+// memory, putting back prev if the change is not written. Callers must hold
+// the lock of ctx.
+func (r *FileUserRepository) logChange(ctx context.Context, prev *models.User) error {
+	user, _ := r.mem.get(prev.ID)
+	return r.log(ctx, walRecord{Op: opUpdate, ID: user.ID, User: toStored(user)}, func() { r.mem.put(prev) }, nil)
+}
+
+// log writes a record for a change already made in memory. Within a
+// transaction the record is queued until it commits. undo reverts the change
+// if the record is not written; committed, if not nil, runs once it is
+// durable. Callers must hold the lock of ctx.
+func (r *FileUserRepository) log(ctx context.Context, rec walRecord, undo, committed func()) error {
+	if tx := r.txFrom(ctx); tx != nil {
+		tx.records = append(tx.records, rec)
+		tx.undo = append(tx.undo, undo)
+		if committed != nil {
+			tx.committed = append(tx.committed, committed)
+		}
+		return nil
+	}
+
+	if err := r.write(rec); err != nil {
+		undo()
+		return err
+	}
+	if committed != nil {
+		committed()
+	}
+	r.compactIfDue()
+	return nil
+}
+
+// commit writes the records of a transaction as a single log record, so a
+// crash keeps either all or none of them. Callers must hold r.mutex.
+func (r *FileUserRepository) commit(tx *fileTx) error {
+	if len(tx.records) == 0 {
+		return nil
+	}
+	rec := tx.records[0]
+	if len(tx.records) > 1 {
+		rec = walRecord{Op: opBatch, Ops: tx.records}
+	}
+	if err := r.write(rec); err != nil {
+		return err
+	}
+	for _, fn := range tx.committed {
+		fn()
+	}
+	r.compactIfDue()
+	return nil
+}
+
+// write appends a record to the log and fsyncs it. Callers must hold r.mutex.
+func (r *FileUserRepository) write(rec walRecord) error {
+	if r.wal == nil {
+		return errors.New("repository is closed")
+	}
+
+	rec.Seq = r.seq + 1
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("encode log record: %w", err)
+	}
+	line = append(line, '\n')
+
+	// The log is opened without O_APPEND so replay can truncate a torn tail,
+	// so always seek to the end before writing.
+	end, err := r.wal.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("seek write-ahead log: %w", err)
+	}
+	if _, err := r.wal.Write(line); err != nil {
+		// Cut off whatever part of the record made it, so the next one
+		// does not land behind a torn line
+		r.wal.Truncate(end)
+		return fmt.Errorf("write log record: %w", err)
+	}
+	if err := r.wal.Sync(); err != nil {
+		r.wal.Truncate(end)
+		return fmt.Errorf("sync write-ahead log: %w", err)
+	}
+	r.seq = rec.Seq
+	r.sinceSnapshot++
+	return nil
+}
+
+// compactIfDue compacts the log every snapshotInterval records. Callers must
+// hold r.mutex.
+func (r *FileUserRepository) compactIfDue() {
+	if r.snapshotInterval > 0 && r.sinceSnapshot >= r.snapshotInterval {
+		// The records are already durable, so a failed compaction only
+		// means the next startup replays a longer log.
+		if err := r.compact(); err == nil {
+			r.sinceSnapshot = 0
+		}
+	}
+}
+
+// attachAudit hands the audit entries replayed from the log to audit, which
+// saves every entry from then on before the log is compacted
+func (r *FileUserRepository) attachAudit(audit *FileAuditRepository) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := audit.recover(r.replayedAudit); err != nil {
+		return err
+	}
+	r.audit = audit
+	r.replayedAudit = nil
+	return nil
+}
+
+// compact writes a snapshot of the current state and truncates the log.
+// Callers must hold r.mutex.
+func (r *FileUserRepository) compact() error {
+	// Audit entries must be in the audit log before the log drops them
+	if r.audit != nil {
+		if err := r.audit.sync(); err != nil {
+			return err
+		}
+	} else if len(r.replayedAudit) > 0 {
+		return errors.New("audit entries in the log have not been saved")
+	}
+
+	users, nextID := r.mem.state()
+	snap := snapshot{Seq: r.seq, NextID: nextID, Users: make([]storedUser, len(users))}
+	for i := range users {
+		snap.Users[i] = *toStored(&users[i])
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+
+	path := filepath.Join(r.dir, snapshotFileName)
+	if err := writeFileSync(path+".tmp", data); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("install snapshot: %w", err)
+	}
+	if err := syncDir(r.dir); err != nil {
+		return err
+	}
+
+	// A crash before the truncate is harmless: replay skips records the
+	// snapshot already covers.
+	if err := r.wal.Truncate(0); err != nil {
+		return fmt.Errorf("truncate write-ahead log: %w", err)
+	}
+	return r.wal.Sync()
+}
+
+func (r *FileUserRepository) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(r.dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read snapshot: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("decode snapshot: %w", err)
+	}
+	for i := range snap.Users {
+		r.mem.put(snap.Users[i].toUser())
+	}
+	r.mem.setNextID(snap.NextID)
+	r.seq = snap.Seq
+	return nil
+}
+
+// replay applies every log record newer than the snapshot. A final record
+// without a trailing newline is the remains of an interrupted write and is
+// cut off; any other undecodable record is reported as corruption.
+func (r *FileUserRepository) replay(wal *os.File) error {
+	reader := bufio.NewReader(wal)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				if err := wal.Truncate(offset); err != nil {
+					return fmt.Errorf("truncate torn log record: %w", err)
+				}
+				if err := wal.Sync(); err != nil {
+					return fmt.Errorf("sync write-ahead log: %w", err)
+				}
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read write-ahead log: %w", err)
+		}
+
+		var rec walRecord
+		if err := json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil {
+			return fmt.Errorf("corrupt log record at offset %d: %w", offset, err)
+		}
+		offset += int64(len(line))
+
+		if rec.Seq <= r.seq {
+			continue
+		}
+		if err := r.apply(rec.Seq, rec); err != nil {
+			return err
+		}
+		r.seq = rec.Seq
+		r.sinceSnapshot++
+	}
+}
+
+// apply replays one record, or every record of a transaction, of log
+// record seq
+func (r *FileUserRepository) apply(seq uint64, rec walRecord) error {
+	switch rec.Op {
+	case opCreate, opUpdate:
+		if rec.User == nil {
+			return fmt.Errorf("log record %d has no user", seq)
+		}
+		r.mem.put(rec.User.toUser())
+	case opDelete:
+		r.mem.remove(rec.ID)
+	case opAudit:
+		if rec.Audit == nil {
+			return fmt.Errorf("log record %d has no audit entry", seq)
+		}
+		r.replayedAudit = append(r.replayedAudit, *rec.Audit)
+	case opBatch:
+		for _, op := range rec.Ops {
+			if op.Op == opBatch {
+				return fmt.Errorf("log record %d has a nested batch", seq)
+			}
+			if err := r.apply(seq, op); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("log record %d has unknown op %q", seq, rec.Op)
+	}
+	return nil
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", filepath.Base(path), err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("sync %s: %w", filepath.Base(path), err)
+	}
+	return f.Close()
+}
+
+// syncDir makes a rename in dir durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open data directory: %w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("sync data directory: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package repositories_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rizqishq/Go-REST/models"
+	"github.com/rizqishq/Go-REST/repositories"
+	"github.com/rizqishq/Go-REST/repositories/repotest"
+)
+
+func newFileRepository(t *testing.T) repositories.UserRepository {
+	repo, err := repositories.NewFileUserRepository(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func TestFileUserRepositoryStress(t *testing.T) {
+	repotest.StressUserRepository(t, newFileRepository)
+}
+
+func TestFileUserRepository(t *testing.T) {
+	repotest.TestUserRepository(t, newFileRepository)
+}
+
+func TestFileAuditRepository(t *testing.T) {
+	repotest.TestAuditRepository(t, func(t *testing.T) repotest.Store {
+		dir := t.TempDir()
+		users, err := repositories.NewFileUserRepository(dir, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { users.Close() })
+		audit, err := repositories.NewFileAuditRepository(users)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { audit.Close() })
+		return repotest.Store{Users: users, Audit: audit, Tx: repositories.NewFileTransactor(users)}
+	})
+}
+
+func TestFileUserRepositoryPing(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	repo, err := repositories.NewFileUserRepository(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	if err := repo.Ping(ctx); err != nil {
+		t.Fatalf("Ping() = %v", err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Ping(ctx); err == nil {
+		t.Error("Ping() succeeded without a data directory")
+	}
+	repo.Close()
+	if err := repo.Ping(ctx); err == nil {
+		t.Error("Ping() succeeded after Close")
+	}
+}
+
+func openFileRepository(t *testing.T, dir string, snapshotInterval int) *repositories.FileUserRepository {
+	t.Helper()
+	repo, err := repositories.NewFileUserRepository(dir, snapshotInterval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+// dumpUsers describes every stored user, deleted or not, including the
+// password hash that JSON encoding leaves out
+func dumpUsers(t *testing.T, repo repositories.UserRepository) []string {
+	t.Helper()
+	ctx := context.Background()
+	active, err := repo.FindAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := repo.FindDeleted(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dump []string
+	for _, user := range append(active, deleted...) {
+		data, err := json.Marshal(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dump = append(dump, string(data)+" password="+user.Password)
+	}
+	slices.Sort(dump)
+	return dump
+}
+
+// writeHistory creates, updates, soft-deletes, restores and purges users,
+// making 11 log records
+func writeHistory(t *testing.T, repo repositories.UserRepository) {
+	t.Helper()
+	ctx := context.Background()
+	create := func(name string) *models.User {
+		user := &models.User{Username: name, Email: name + "@example.com", Password: "hash-" + name, Role: models.RoleUser}
+		if err := repo.Create(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+		return user
+	}
+	john, jane, old, gone := create("john"), create("jane"), create("old"), create("gone")
+
+	john.FirstName = "John"
+	john.Permissions = []models.Permission{models.PermAuditRead}
+	if err := repo.Update(ctx, john); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, id := range []uint{jane.ID, old.ID, gone.ID} {
+		if err := repo.Delete(ctx, id, now.Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Restore(ctx, jane.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete(ctx, old.ID, now); err == nil {
+		t.Fatal("deleted a user twice")
+	}
+	if ids, err := repo.Purge(ctx, now.Add(-time.Minute)); err != nil || len(ids) != 2 {
+		t.Fatalf("Purge() = %v, %v; want old and gone", ids, err)
+	}
+}
+
+func TestFileUserRepositoryReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	repo := openFileRepository(t, dir, 0)
+	writeHistory(t, repo)
+	want := dumpUsers(t, repo)
+	if err := repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "users.snapshot")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("snapshot written with compaction disabled: %v", err)
+	}
+
+	repo = openFileRepository(t, dir, 0)
+	if got := dumpUsers(t, repo); !slices.Equal(got, want) {
+		t.Fatalf("after reopening:\n got %v\nwant %v", got, want)
+	}
+
+	// IDs of purged users are not handed out again
+	user := &models.User{Username: "new", Email: "new@example.com"}
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 5 {
+		t.Errorf("new user ID = %d, want 5", user.ID)
+	}
+	if _, err := repo.FindByUsername(ctx, "JOHN"); err != nil {
+		t.Errorf("username index not rebuilt: %v", err)
+	}
+}
+
+func TestFileUserRepositoryCompaction(t *testing.T) {
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, "users.wal")
+
+	repo := openFileRepository(t, dir, 4)
+	writeHistory(t, repo)
+	want := dumpUsers(t, repo)
+	if err := repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 11 records with a snapshot every 4 leave 3 in the log
+	wal, err := os.ReadFile(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(wal, []byte("\n")); n != 3 {
+		t.Errorf("log has %d records after compaction, want 3", n)
+	}
+
+	repo = openFileRepository(t, dir, 4)
+	if got := dumpUsers(t, repo); !slices.Equal(got, want) {
+		t.Fatalf("after reopening:\n got %v\nwant %v", got, want)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash between writing the snapshot and truncating the log leaves
+	// records the snapshot already covers; replaying them must not undo
+	// later changes. Take them from the same history written uncompacted.
+	uncompacted := t.TempDir()
+	other := openFileRepository(t, uncompacted, 0)
+	writeHistory(t, other)
+	other.Close()
+	stale, err := os.ReadFile(filepath.Join(uncompacted, "users.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(walPath, append(stale[:bytes.IndexByte(stale, '\n')+1], wal...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	repo = openFileRepository(t, dir, 4)
+	if got := dumpUsers(t, repo); !slices.Equal(got, want) {
+		t.Errorf("after replaying covered records:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestFileUserRepositoryTornTail(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, "users.wal")
+
+	repo := openFileRepository(t, dir, 0)
+	writeHistory(t, repo)
+	want := dumpUsers(t, repo)
+	repo.Close()
+
+	intact, err := os.ReadFile(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := intact[bytes.LastIndexByte(intact[:len(intact)-1], '\n')+1:]
+	torn := append(slices.Clone(intact), last[:len(last)/2]...)
+	if err := os.WriteFile(walPath, torn, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	repo = openFileRepository(t, dir, 0)
+	if got := dumpUsers(t, repo); !slices.Equal(got, want) {
+		t.Fatalf("after a torn write:\n got %v\nwant %v", got, want)
+	}
+	if data, _ := os.ReadFile(walPath); !bytes.Equal(data, intact) {
+		t.Error("the torn record was not cut off")
+	}
+
+	// New records follow the last complete one and survive another restart
+	user := &models.User{Username: "new", Email: "new@example.com"}
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	want = dumpUsers(t, repo)
+	repo.Close()
+	repo = openFileRepository(t, dir, 0)
+	if got := dumpUsers(t, repo); !slices.Equal(got, want) {
+		t.Errorf("after writing past a torn record:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestFileUserRepositoryCorruptLog(t *testing.T) {
+	dir := t.TempDir()
+	repo := openFileRepository(t, dir, 0)
+	writeHistory(t, repo)
+	repo.Close()
+
+	walPath := filepath.Join(dir, "users.wal")
+	wal, err := os.ReadFile(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the final record may be incomplete
+	corrupt := bytes.Replace(wal, []byte("\n"), []byte("}\n"), 1)
+	if err := os.WriteFile(walPath, corrupt, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repositories.NewFileUserRepository(dir, 0); err == nil {
+		t.Error("opened a repository with a corrupt log record")
+	}
+}
@@ -0,0 +1,223 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rizqishq/Go-REST/metrics"
+	"github.com/rizqishq/Go-REST/models"
+	"github.com/rizqishq/Go-REST/tracing"
+)
+
+// repositoryBuckets suit operations that mostly take well below a millisecond
+var repositoryBuckets = []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, 1}
+
+// RepositoryMetrics measures the latency of repository operations by
+// repository, operation and result
+type RepositoryMetrics struct {
+	duration *metrics.HistogramVec
+}
+
+// Create new RepositoryMetrics registered with reg
+func NewRepositoryMetrics(reg *metrics.Registry) *RepositoryMetrics {
+	return &RepositoryMetrics{
+		duration: reg.NewHistogramVec("repository_operation_duration_seconds", "Time taken by repository operations.",
+			repositoryBuckets, "repository", "operation", "result"),
+	}
+}
+
+// start times an operation and traces it as a child of the span in ctx. The
+// returned function ends both; defer it with a pointer to the operation's
+// named error result.
+func (m *RepositoryMetrics) start(ctx context.Context, repository, operation string) (context.Context, func(err *error)) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, repository+"."+operation)
+	return ctx, func(err *error) {
+		result := resultLabel(*err)
+		m.duration.With(repository, operation, result).Observe(time.Since(start).Seconds())
+
+		span.SetAttributes(tracing.Attr{Key: "result", Value: result})
+		if result == "error" || result == "canceled" {
+			span.RecordError(*err)
+		}
+		span.End()
+	}
+}
+
+// resultLabel tells expected outcomes apart from failures of the store
+func resultLabel(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrConflict):
+		return "conflict"
+	case errors.Is(err, ErrStaleVersion):
+		return "stale"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "canceled"
+	}
+	return "error"
+}
+
+// InstrumentedUserRepository decorates a UserRepository with latency metrics
+// and a trace span per call
+type InstrumentedUserRepository struct {
+	next    UserRepository
+	metrics *RepositoryMetrics
+}
+
+// Create new InstrumentedUserRepository around next
+func NewInstrumentedUserRepository(next UserRepository, m *RepositoryMetrics) *InstrumentedUserRepository {
+	return &InstrumentedUserRepository{next: next, metrics: m}
+}
+
+func (r *InstrumentedUserRepository) FindAll(ctx context.Context) (users []models.User, err error) {
+	ctx, done := r.metrics.start(ctx, "users", "find_all")
+	defer done(&err)
+	return r.next.FindAll(ctx)
+}
+
+func (r *InstrumentedUserRepository) Query(ctx context.Context, q UserQuery) (page *UserPage, err error) {
+	ctx, done := r.metrics.start(ctx, "users", "query")
+	defer done(&err)
+	return r.next.Query(ctx, q)
+}
+
+func (r *InstrumentedUserRepository) FindByID(ctx context.Context, id uint) (user *models.User, err error) {
+	ctx, done := r.metrics.start(ctx, "users", "find_by_id")
+	defer done(&err)
+	return r.next.FindByID(ctx, id)
+}
+
+func (r *InstrumentedUserRepository) FindByUsername(ctx context.Context, username string) (user *models.User, err error) {
+	ctx, done := r.metrics.start(ctx, "users", "find_by_username")
+	defer done(&err)
+	return r.next.FindByUsername(ctx, username)
+}
+
+func (r *InstrumentedUserRepository) FindByEmail(ctx context.Context, email string) (user *models.User, err error) {
+	ctx, done := r.metrics.start(ctx, "users", "find_by_email")
+	defer done(&err)
+	return r.next.FindByEmail(ctx, email)
+}
+
+func (r *InstrumentedUserRepository) Create(ctx context.Context, user *models.User) (err error) {
+	ctx, done := r.metrics.start(ctx, "users", "create")
+	defer done(&err)
+	return r.next.Create(ctx, user)
+}
+
+func (r *InstrumentedUserRepository) Update(ctx context.Context, user *models.User) (err error) {
+	ctx, done := r.metrics.start(ctx, "users", "update")
+	defer done(&err)
+	return r.next.Update(ctx, user)
+}
+
+func (r *InstrumentedUserRepository) Delete(ctx context.Context, id uint, deletedAt time.Time) (err error) {
+	ctx, done := r.metrics.start(ctx, "users", "delete")
+	defer done(&err)
+	return r.next.Delete(ctx, id, deletedAt)
+}
+
+func (r *InstrumentedUserRepository) FindDeleted(ctx context.Context) (users []models.User, err error) {
+	ctx, done := r.metrics.start(ctx, "users", "find_deleted")
+	defer done(&err)
+	return r.next.FindDeleted(ctx)
+}
+
+func (r *InstrumentedUserRepository) FindDeletedByID(ctx context.Context, id uint) (user *models.User, err error) {
+	ctx, done := r.metrics.start(ctx, "users", "find_deleted_by_id")
+	defer done(&err)
+	return r.next.FindDeletedByID(ctx, id)
+}
+
+func (r *InstrumentedUserRepository) Restore(ctx context.Context, id uint) (err error) {
+	ctx, done := r.metrics.start(ctx, "users", "restore")
+	defer done(&err)
+	return r.next.Restore(ctx, id)
+}
+
+func (r *InstrumentedUserRepository) Purge(ctx context.Context, deletedBefore time.Time) (ids []uint, err error) {
+	ctx, done := r.metrics.start(ctx, "users", "purge")
+	defer done(&err)
+	return r.next.Purge(ctx, deletedBefore)
+}
+
+// InstrumentedAuditRepository decorates an AuditRepository with latency
+// metrics and a trace span per call
+type InstrumentedAuditRepository struct {
+	next    AuditRepository
+	metrics *RepositoryMetrics
+}
+
+// Create new InstrumentedAuditRepository around next
+func NewInstrumentedAuditRepository(next AuditRepository, m *RepositoryMetrics) *InstrumentedAuditRepository {
+	return &InstrumentedAuditRepository{next: next, metrics: m}
+}
+
+func (r *InstrumentedAuditRepository) Create(ctx context.Context, entry *models.AuditEntry) (err error) {
+	ctx, done := r.metrics.start(ctx, "audit", "create")
+	defer done(&err)
+	return r.next.Create(ctx, entry)
+}
+
+func (r *InstrumentedAuditRepository) Query(ctx context.Context, q AuditQuery) (entries []models.AuditEntry, err error) {
+	ctx, done := r.metrics.start(ctx, "audit", "query")
+	defer done(&err)
+	return r.next.Query(ctx, q)
+}
+
+// InstrumentedRefreshTokenRepository decorates a RefreshTokenRepository with
+// latency metrics and a trace span per call
+type InstrumentedRefreshTokenRepository struct {
+	next    RefreshTokenRepository
+	metrics *RepositoryMetrics
+}
+
+// Create new InstrumentedRefreshTokenRepository around next
+func NewInstrumentedRefreshTokenRepository(next RefreshTokenRepository, m *RepositoryMetrics) *InstrumentedRefreshTokenRepository {
+	return &InstrumentedRefreshTokenRepository{next: next, metrics: m}
+}
+
+func (r *InstrumentedRefreshTokenRepository) Create(ctx context.Context, token *models.RefreshToken) (err error) {
+	ctx, done := r.metrics.start(ctx, "refresh_tokens", "create")
+	defer done(&err)
+	return r.next.Create(ctx, token)
+}
+
+func (r *InstrumentedRefreshTokenRepository) FindByHash(ctx context.Context, hash string) (token *models.RefreshToken, err error) {
+	ctx, done := r.metrics.start(ctx, "refresh_tokens", "find_by_hash")
+	defer done(&err)
+	return r.next.FindByHash(ctx, hash)
+}
+
+func (r *InstrumentedRefreshTokenRepository) Revoke(ctx context.Context, hash string) (err error) {
+	ctx, done := r.metrics.start(ctx, "refresh_tokens", "revoke")
+	defer done(&err)
+	return r.next.Revoke(ctx, hash)
+}
+
+func (r *InstrumentedRefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string) (err error) {
+	ctx, done := r.metrics.start(ctx, "refresh_tokens", "revoke_family")
+	defer done(&err)
+	return r.next.RevokeFamily(ctx, familyID)
+}
+
+// RegisterUserGauges registers gauges of how many users repo holds, counted
+// on every scrape
+func RegisterUserGauges(reg *metrics.Registry, repo UserRepository) {
+	reg.NewGaugeFunc("users_active", "Users that are not deleted.", func(ctx context.Context) (float64, error) {
+		page, err := repo.Query(ctx, UserQuery{Limit: 1})
+		if err != nil {
+			return 0, err
+		}
+		return float64(page.Total), nil
+	})
+	reg.NewGaugeFunc("users_deleted", "Soft-deleted users that have not been purged yet.", func(ctx context.Context) (float64, error) {
+		users, err := repo.FindDeleted(ctx)
+		return float64(len(users)), err
+	})
+}
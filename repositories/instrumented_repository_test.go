@@ -0,0 +1,84 @@
+package repositories_test
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rizqishq/Go-REST/metrics"
+	"github.com/rizqishq/Go-REST/models"
+	"github.com/rizqishq/Go-REST/repositories"
+	"github.com/rizqishq/Go-REST/repositories/repotest"
+	"github.com/rizqishq/Go-REST/tracing"
+)
+
+func TestInstrumentedUserRepository(t *testing.T) {
+	repotest.TestUserRepository(t, func(t *testing.T) repositories.UserRepository {
+		m := repositories.NewRepositoryMetrics(metrics.NewRegistry())
+		return repositories.NewInstrumentedUserRepository(repositories.NewInMemoryUserRepository(), m)
+	})
+}
+
+func TestRepositoryMetrics(t *testing.T) {
+	ctx := context.Background()
+	reg := metrics.NewRegistry()
+	m := repositories.NewRepositoryMetrics(reg)
+	mem := repositories.NewInMemoryUserRepository()
+	repositories.RegisterUserGauges(reg, mem)
+	users := repositories.NewInstrumentedUserRepository(mem, m)
+	audit := repositories.NewInstrumentedAuditRepository(repositories.NewInMemoryAuditRepository(), m)
+
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if err := users.Create(ctx, &models.User{Username: name, Email: name + "@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	users.Create(ctx, &models.User{Username: "ALICE", Email: "other@example.com"})
+	users.FindByID(ctx, 99)
+	users.Delete(ctx, 3, time.Now())
+	audit.Create(ctx, &models.AuditEntry{Action: models.AuditCreate, UserID: 1})
+
+	rec := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	got := string(body)
+
+	for _, line := range []string{
+		`repository_operation_duration_seconds_count{repository="users",operation="create",result="ok"} 3`,
+		`repository_operation_duration_seconds_count{repository="users",operation="create",result="conflict"} 1`,
+		`repository_operation_duration_seconds_count{repository="users",operation="find_by_id",result="not_found"} 1`,
+		`repository_operation_duration_seconds_count{repository="users",operation="delete",result="ok"} 1`,
+		`repository_operation_duration_seconds_count{repository="audit",operation="create",result="ok"} 1`,
+		`users_active 2`,
+		`users_deleted 1`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("scrape is missing %q:\n%s", line, got)
+		}
+	}
+}
+
+func TestInstrumentedRepositorySpans(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	ctx, parent := tracing.NewTracer(exporter).Start(context.Background(), "parent")
+	m := repositories.NewRepositoryMetrics(metrics.NewRegistry())
+	users := repositories.NewInstrumentedUserRepository(repositories.NewInMemoryUserRepository(), m)
+
+	users.FindByID(ctx, 99)
+	parent.End()
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2: %+v", len(spans), spans)
+	}
+	span := spans[0]
+	if span.Name != "users.find_by_id" || span.ParentSpanID != parent.SpanContext().SpanID.String() {
+		t.Errorf("span = %+v, want users.find_by_id under the parent", span)
+	}
+	if len(span.Attributes) != 1 || span.Attributes[0].Value != "not_found" || span.Error != "" {
+		t.Errorf("span = %+v, want result not_found without error", span)
+	}
+}
@@ -0,0 +1,10 @@
+CREATE TABLE users (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    username   TEXT      NOT NULL UNIQUE,
+    email      TEXT      NOT NULL UNIQUE,
+    password   TEXT      NOT NULL,
+    first_name TEXT      NOT NULL DEFAULT '',
+    last_name  TEXT      NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
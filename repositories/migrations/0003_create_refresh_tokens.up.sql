@@ -0,0 +1,10 @@
+CREATE TABLE refresh_tokens (
+    token_hash TEXT      PRIMARY KEY,
+    user_id    INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    family_id  TEXT      NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    revoked    BOOLEAN   NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens (family_id);
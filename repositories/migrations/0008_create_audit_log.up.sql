@@ -0,0 +1,13 @@
+CREATE TABLE audit_log (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    actor_id   INTEGER   NOT NULL DEFAULT 0,
+    actor      TEXT      NOT NULL,
+    action     TEXT      NOT NULL,
+    user_id    INTEGER   NOT NULL,
+    changes    TEXT      NOT NULL DEFAULT '',
+    request_id TEXT      NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_audit_log_user_id ON audit_log (user_id, id);
+CREATE INDEX idx_audit_log_created_at ON audit_log (created_at);
@@ -0,0 +1,316 @@
+package repotest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rizqishq/Go-REST/models"
+	"github.com/rizqishq/Go-REST/repositories"
+)
+
+// Store is the set of repositories of one backend that share transactions
+type Store struct {
+	Users repositories.UserRepository
+	Audit repositories.AuditRepository
+	Tx    repositories.Transactor
+}
+
+// StoreFactory returns an empty store for a single test. Register any
+// cleanup with t.Cleanup.
+type StoreFactory func(t *testing.T) Store
+
+// TestAuditRepository checks that a repository implements the
+// repositories.AuditRepository contract and that the Transactor of the same
+// backend commits or rolls back user and audit writes together. Each subtest
+// gets a fresh store from newStore.
+func TestAuditRepository(t *testing.T, newStore StoreFactory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store Store)
+	}{
+		{"CreateAssignsIDs", testAuditCreateAssignsIDs},
+		{"RoundTrip", testAuditRoundTrip},
+		{"QueryFilters", testAuditQueryFilters},
+		{"ReturnedEntriesAreCopies", testAuditReturnedEntriesAreCopies},
+		{"CanceledContext", testAuditCanceledContext},
+		{"TransactionCommits", testTransactionCommits},
+		{"TransactionRollsBack", testTransactionRollsBack},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func testAuditCreateAssignsIDs(t *testing.T, store Store) {
+	var last uint
+	for i := 0; i < 3; i++ {
+		entry := mustAudit(t, store.Audit, newEntry(1, models.AuditUpdate))
+		if entry.ID <= last {
+			t.Errorf("Create assigned ID %d after %d, want a greater one", entry.ID, last)
+		}
+		last = entry.ID
+	}
+}
+
+func testAuditRoundTrip(t *testing.T, store Store) {
+	entry := newEntry(7, models.AuditUpdate)
+	entry.ActorID = 3
+	entry.Actor = "admin"
+	entry.RequestID = "req-1"
+	entry.Changes = []models.FieldChange{
+		{Field: "username", Old: json.RawMessage(`"bob"`), New: json.RawMessage(`"robert"`)},
+		{Field: "password", Redacted: true},
+		{Field: "deleted_at", Old: json.RawMessage(`"2024-01-01T00:00:00Z"`)},
+	}
+	mustAudit(t, store.Audit, entry)
+
+	got, err := firstEntry(store.Audit.Query(context.Background(), repositories.AuditQuery{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSameEntry(t, "Query", got, entry)
+}
+
+func testAuditQueryFilters(t *testing.T, store Store) {
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var ids []uint
+	for i, spec := range []struct {
+		userID uint
+		action models.AuditAction
+	}{
+		{1, models.AuditCreate},
+		{2, models.AuditCreate},
+		{1, models.AuditUpdate},
+		{1, models.AuditDelete},
+		{2, models.AuditUpdate},
+	} {
+		entry := newEntry(spec.userID, spec.action)
+		entry.CreatedAt = base.Add(time.Duration(i) * time.Hour)
+		ids = append(ids, mustAudit(t, store.Audit, entry).ID)
+	}
+
+	tests := []struct {
+		name string
+		q    repositories.AuditQuery
+		want []uint
+	}{
+		{"all", repositories.AuditQuery{}, ids},
+		{"user", repositories.AuditQuery{UserID: 1}, []uint{ids[0], ids[2], ids[3]}},
+		{"action", repositories.AuditQuery{Action: models.AuditUpdate}, []uint{ids[2], ids[4]}},
+		{"since is inclusive", repositories.AuditQuery{Since: base.Add(3 * time.Hour)}, ids[3:]},
+		{"after id", repositories.AuditQuery{AfterID: ids[1]}, ids[2:]},
+		{"limit", repositories.AuditQuery{Limit: 2}, ids[:2]},
+		{"combined", repositories.AuditQuery{UserID: 1, Since: base.Add(time.Hour), Limit: 1}, []uint{ids[2]}},
+		{"no match", repositories.AuditQuery{UserID: 3}, []uint{}},
+	}
+	for _, tt := range tests {
+		entries, err := store.Audit.Query(ctx, tt.q)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := entryIDs(entries); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got IDs %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func testAuditReturnedEntriesAreCopies(t *testing.T, store Store) {
+	entry := newEntry(1, models.AuditUpdate)
+	entry.Changes = []models.FieldChange{{Field: "email", Old: json.RawMessage(`"a@example.com"`), New: json.RawMessage(`"b@example.com"`)}}
+	mustAudit(t, store.Audit, entry)
+	want := *entry
+	want.Changes = []models.FieldChange{entry.Changes[0]}
+	want.Changes[0].New = json.RawMessage(`"b@example.com"`)
+
+	// Neither the entry passed to Create nor the ones returned by Query may
+	// share memory with the store
+	entry.Changes[0].New[1] = 'x'
+	got, _ := firstEntry(store.Audit.Query(context.Background(), repositories.AuditQuery{}))
+	got.Changes[0].Old[1] = 'x'
+	got.Changes[0].Field = "changed"
+
+	again, err := firstEntry(store.Audit.Query(context.Background(), repositories.AuditQuery{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSameEntry(t, "Query after changing entries", again, &want)
+}
+
+func testAuditCanceledContext(t *testing.T, store Store) {
+	mustAudit(t, store.Audit, newEntry(1, models.AuditCreate))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := store.Audit.Create(ctx, newEntry(1, models.AuditUpdate)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Create with a canceled context error = %v, want context.Canceled", err)
+	}
+	if _, err := store.Audit.Query(ctx, repositories.AuditQuery{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Query with a canceled context error = %v, want context.Canceled", err)
+	}
+	if entries, _ := store.Audit.Query(context.Background(), repositories.AuditQuery{}); len(entries) != 1 {
+		t.Errorf("Query after a canceled Create returned %d entries, want 1", len(entries))
+	}
+}
+
+func testTransactionCommits(t *testing.T, store Store) {
+	ctx := context.Background()
+	var user *models.User
+	err := store.Tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		user = newUser("alice", "alice@example.com")
+		if err := store.Users.Create(ctx, user); err != nil {
+			return err
+		}
+		// Nested calls join the outer transaction
+		return store.Tx.WithinTransaction(ctx, func(ctx context.Context) error {
+			return store.Audit.Create(ctx, newEntry(user.ID, models.AuditCreate))
+		})
+	})
+	if err != nil {
+		t.Fatalf("WithinTransaction: %v", err)
+	}
+
+	if _, err := store.Users.FindByID(ctx, user.ID); err != nil {
+		t.Errorf("FindByID after commit: %v", err)
+	}
+	entry, err := firstEntry(store.Audit.Query(ctx, repositories.AuditQuery{}))
+	if err != nil || entry.UserID != user.ID {
+		t.Errorf("Query after commit = %+v, %v; want the entry for user %d", entry, err, user.ID)
+	}
+}
+
+func testTransactionRollsBack(t *testing.T, store Store) {
+	ctx := context.Background()
+	updated := mustCreate(t, store.Users, newUser("bob", "bob@example.com"))
+	deleted := mustCreate(t, store.Users, newUser("carol", "carol@example.com"))
+	restored := mustCreate(t, store.Users, newUser("dave", "dave@example.com"))
+	purged := mustCreate(t, store.Users, newUser("erin", "erin@example.com"))
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, user := range []*models.User{restored, purged} {
+		if err := store.Users.Delete(ctx, user.ID, base); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustAudit(t, store.Audit, newEntry(updated.ID, models.AuditCreate))
+	wantUsers, _ := store.Users.FindAll(ctx)
+	wantDeleted, _ := store.Users.FindDeleted(ctx)
+
+	errBoom := errors.New("boom")
+	err := store.Tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		steps := []func() error{
+			func() error { return store.Users.Create(ctx, newUser("frank", "frank@example.com")) },
+			func() error {
+				change := *updated
+				change.FirstName = "changed"
+				return store.Users.Update(ctx, &change)
+			},
+			func() error { return store.Users.Delete(ctx, deleted.ID, time.Now()) },
+			func() error { return store.Users.Restore(ctx, restored.ID) },
+			func() error {
+				ids, err := store.Users.Purge(ctx, base)
+				if err == nil && !reflect.DeepEqual(ids, []uint{purged.ID}) {
+					err = fmt.Errorf("Purge returned IDs %v, want [%d]", ids, purged.ID)
+				}
+				return err
+			},
+			func() error { return store.Audit.Create(ctx, newEntry(updated.ID, models.AuditUpdate)) },
+		}
+		for i, step := range steps {
+			if err := step(); err != nil {
+				return fmt.Errorf("step %d: %w", i, err)
+			}
+		}
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("WithinTransaction error = %v, want the error returned by fn", err)
+	}
+
+	// Every write is gone, so the store looks exactly as before
+	users, _ := store.Users.FindAll(ctx)
+	if len(users) != len(wantUsers) {
+		t.Fatalf("FindAll after rollback returned IDs %v, want %v", userIDs(users), userIDs(wantUsers))
+	}
+	for i := range users {
+		checkSameUser(t, "FindAll after rollback", &users[i], &wantUsers[i])
+	}
+	deletedUsers, _ := store.Users.FindDeleted(ctx)
+	if len(deletedUsers) != len(wantDeleted) {
+		t.Fatalf("FindDeleted after rollback returned IDs %v, want %v", userIDs(deletedUsers), userIDs(wantDeleted))
+	}
+	for i := range deletedUsers {
+		checkSameUser(t, "FindDeleted after rollback", &deletedUsers[i], &wantDeleted[i])
+	}
+	if _, err := store.Users.FindByUsername(ctx, "frank"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("FindByUsername of a rolled back user error = %v, want ErrNotFound", err)
+	}
+	if entries, _ := store.Audit.Query(ctx, repositories.AuditQuery{}); len(entries) != 1 {
+		t.Errorf("Query after rollback returned %d entries, want 1", len(entries))
+	}
+
+	// The store keeps working afterwards
+	mustCreate(t, store.Users, newUser("frank", "frank@example.com"))
+	mustAudit(t, store.Audit, newEntry(updated.ID, models.AuditUpdate))
+}
+
+// checkSameEntry compares every field of two audit entries
+func checkSameEntry(t *testing.T, context string, got, want *models.AuditEntry) {
+	t.Helper()
+	same := got.ID == want.ID &&
+		got.ActorID == want.ActorID &&
+		got.Actor == want.Actor &&
+		got.Action == want.Action &&
+		got.UserID == want.UserID &&
+		reflect.DeepEqual(got.Changes, want.Changes) &&
+		got.RequestID == want.RequestID &&
+		got.CreatedAt.Equal(want.CreatedAt)
+	if !same {
+		t.Errorf("%s:\n got %+v\nwant %+v", context, got, want)
+	}
+}
+
+// newEntry returns an unsaved audit entry for userID
+func newEntry(userID uint, action models.AuditAction) *models.AuditEntry {
+	return &models.AuditEntry{
+		Actor:     "system",
+		Action:    action,
+		UserID:    userID,
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+}
+
+// mustAudit stores entry and fails the test on error
+func mustAudit(t *testing.T, repo repositories.AuditRepository, entry *models.AuditEntry) *models.AuditEntry {
+	t.Helper()
+	if err := repo.Create(context.Background(), entry); err != nil {
+		t.Fatalf("Create(%s of user %d): %v", entry.Action, entry.UserID, err)
+	}
+	return entry
+}
+
+func firstEntry(entries []models.AuditEntry, err error) (*models.AuditEntry, error) {
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 1 {
+		return nil, fmt.Errorf("got %d entries, want 1", len(entries))
+	}
+	return &entries[0], nil
+}
+
+func entryIDs(entries []models.AuditEntry) []uint {
+	ids := make([]uint, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID
+	}
+	return ids
+}
@@ -0,0 +1,730 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rizqishq/Go-REST/models"
+	"github.com/rizqishq/Go-REST/repositories"
+)
+
+// TestUserRepository checks that a repository implements the
+// repositories.UserRepository contract: CRUD round trips, case-insensitive
+// uniqueness, not-found and stale-version errors, soft deletion, restore and
+// purge, querying, isolation of returned users, context cancellation and
+// concurrent access. Each subtest gets a fresh repository from newRepo.
+func TestUserRepository(t *testing.T, newRepo Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repo repositories.UserRepository)
+	}{
+		{"CreateAssignsIDAndVersion", testCreateAssignsIDAndVersion},
+		{"CreateRejectsDuplicates", testCreateRejectsDuplicates},
+		{"FindReturnsStoredUser", testFindReturnsStoredUser},
+		{"FindMissing", testFindMissing},
+		{"FindAllOrdersByID", testFindAllOrdersByID},
+		{"UpdatePersistsChanges", testUpdatePersistsChanges},
+		{"UpdateRejectsStaleVersion", testUpdateRejectsStaleVersion},
+		{"UpdateRejectsDuplicates", testUpdateRejectsDuplicates},
+		{"UpdateMissing", testUpdateMissing},
+		{"DeleteIsSoft", testDeleteIsSoft},
+		{"FindDeleted", testFindDeleted},
+		{"FindDeletedByID", testFindDeletedByID},
+		{"Restore", testRestore},
+		{"Purge", testPurge},
+		{"QueryFilters", testQueryFilters},
+		{"QueryPaginates", testQueryPaginates},
+		{"QueryRejectsInvalidInput", testQueryRejectsInvalidInput},
+		{"ReturnedUsersAreCopies", testReturnedUsersAreCopies},
+		{"CanceledContext", testCanceledContext},
+		{"ConcurrentAccess", testConcurrentAccess},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newRepo(t))
+		})
+	}
+}
+
+func testCreateAssignsIDAndVersion(t *testing.T, repo repositories.UserRepository) {
+	seen := make(map[uint]bool)
+	for i := 0; i < 3; i++ {
+		user := mustCreate(t, repo, newUser(fmt.Sprintf("user%d", i), fmt.Sprintf("user%d@example.com", i)))
+		if user.ID == 0 || seen[user.ID] {
+			t.Errorf("Create assigned ID %d, want a new non-zero ID", user.ID)
+		}
+		seen[user.ID] = true
+		if user.Version != 1 {
+			t.Errorf("Create set version %d, want 1", user.Version)
+		}
+	}
+}
+
+func testCreateRejectsDuplicates(t *testing.T, repo repositories.UserRepository) {
+	ctx := context.Background()
+	mustCreate(t, repo, newUser("alice", "alice@example.com"))
+
+	tests := []struct {
+		username, email, field string
+	}{
+		{"alice", "other@example.com", "username"},
+		{"ALICE", "other@example.com", "username"},
+		{"other", "alice@example.com", "email"},
+		{"other", "Alice@Example.COM", "email"},
+	}
+	for _, tt := range tests {
+		err := repo.Create(ctx, newUser(tt.username, tt.email))
+		checkConflict(t, err, tt.field, "Create(%q, %q)", tt.username, tt.email)
+	}
+
+	if users, _ := repo.FindAll(ctx); len(users) != 1 {
+		t.Errorf("rejected creates left %d users, want 1", len(users))
+	}
+}
+
+func testFindReturnsStoredUser(t *testing.T, repo repositories.UserRepository) {
+	ctx := context.Background()
+	want := newUser("Alice", "Alice@example.com")
+	want.FirstName = "Alice"
+	want.LastName = "Liddell"
+	want.Role = models.RoleAdmin
+	want.Permissions = []models.Permission{models.PermUsersList, models.PermUsersRead}
+	mustCreate(t, repo, want)
+
+	finds := map[string]func() (*models.User, error){
+		"FindByID":              func() (*models.User, error) { return repo.FindByID(ctx, want.ID) },
+		"FindByUsername":        func() (*models.User, error) { return repo.FindByUsername(ctx, "Alice") },
+		"FindByUsername(lower)": func() (*models.User, error) { return repo.FindByUsername(ctx, "alice") },
+		"FindByEmail":           func() (*models.User, error) { return repo.FindByEmail(ctx, "Alice@example.com") },
+		"FindByEmail(upper)":    func() (*models.User, error) { return repo.FindByEmail(ctx, "ALICE@EXAMPLE.COM") },
+		"FindAll":               func() (*models.User, error) { return first(repo.FindAll(ctx)) },
+		"Query(username=ALICE)": func() (*models.User, error) {
+			return firstOfPage(repo.Query(ctx, repositories.UserQuery{Username: "ALICE"}))
+		},
+		"Query(email=alice@...)": func() (*models.User, error) {
+			return firstOfPage(repo.Query(ctx, repositories.UserQuery{Email: "alice@example.com"}))
+		},
+		"Query(sort=-created_at)": func() (*models.User, error) {
+			return firstOfPage(repo.Query(ctx, repositories.UserQuery{Sort: []repositories.SortField{{Field: "created_at", Desc: true}}}))
+		},
+	}
+	for name, find := range finds {
+		got, err := find()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		checkSameUser(t, name, got, want)
+	}
+}
+
+func testFindMissing(t *testing.T, repo repositories.UserRepository) {
+	ctx := context.Background()
+	mustCreate(t, repo, newUser("alice", "alice@example.com"))
+
+	if _, err := repo.FindByID(ctx, 999); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("FindByID(missing) error = %v, want ErrNotFound", err)
+	}
+	if _, err := repo.FindByUsername(ctx, "bob"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("FindByUsername(missing) error = %v, want ErrNotFound", err)
+	}
+	if _, err := repo.FindByEmail(ctx, "bob@example.com"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("FindByEmail(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+func testFindAllOrdersByID(t *testing.T, repo repositories.UserRepository) {
+	ctx := context.Background()
+	users, err := repo.FindAll(ctx)
+	if err != nil || len(users) != 0 {
+		t.Fatalf("FindAll on an empty repository = %v, %v; want no users", users, err)
+	}
+
+	var ids []uint
+	for _, name := range []string{"carol", "alice", "bob"} {
+		ids = append(ids, mustCreate(t, repo, newUser(name, name+"@example.com")).ID)
+	}
+	users, err = repo.FindAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := userIDs(users); !slices.Equal(got, ids) {
+		t.Errorf("FindAll returned IDs %v, want %v", got, ids)
+	}
+}
+
+func testUpdatePersistsChanges(t *testing.T, repo repositories.UserRepository) {
+	ctx := context.Background()
+	user := mustCreate(t, repo, newUser("alice", "alice@example.com"))
+	mustCreate(t, repo, newUser("bob", "bob@example.com"))
+
+	user.Username = "ALICE"
+	user.Email = "alice@example.org"
+	user.Password = "new hash"
+	user.FirstName = "Alice"
+	user.Role = models.RoleAdmin
+	user.Permissions = []models.Permission{models.PermUsersDelete}
+	user.UpdatedAt = user.UpdatedAt.Add(time.Minute)
+	if err := repo.Update(ctx, user); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if user.Version != 2 {
+		t.Errorf("Update set version %d on its argument, want 2", user.Version)
+	}
+
+	got, err := repo.FindByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSameUser(t, "FindByID after Update", got, user)
+	if _, err := repo.FindByEmail(ctx, "alice@example.com"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("old email still found after Update: %v", err)
+	}
+
+	// Clearing fields is an update like any other
+	got.FirstName = ""
+	got.Permissions = nil
+	if err := repo.Update(ctx, got); err != nil {
+		t.Fatalf("Update clearing fields: %v", err)
+	}
+	cleared, err := repo.FindByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSameUser(t, "FindByID after clearing fields", cleared, got)
+}
+
+func testUpdateRejectsStaleVersion(t *testing.T, repo repositories.UserRepository) {
+	ctx := context.Background()
+	user := mustCreate(t, repo, newUser("alice", "alice@example.com"))
+
+	first, _ := repo.FindByID(ctx, user.ID)
+	second, _ := repo.FindByID(ctx, user.ID)
+	first.FirstName = "First"
+	if err := repo.Update(ctx, first); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	second.FirstName = "Second"
+	if err := repo.Update(ctx, second); !errors.Is(err, repositories.ErrStaleVersion) {
+		t.Fatalf("Update from a stale version error = %v, want ErrStaleVersion", err)
+	}
+	if second.Version != 1 {
+		t.Errorf("rejected Update changed the version of its argument to %d", second.Version)
+	}
+
+	got, _ := repo.FindByID(ctx, user.ID)
+	checkSameUser(t, "FindByID after rejected Update", got, first)
+}
+
+func testUpdateRejectsDuplicates(t *testing.T, repo repositories.UserRepository) {
+	ctx := context.Background()
+	mustCreate(t, repo, newUser("alice", "alice@example.com"))
+	bob := mustCreate(t, repo, newUser("bob", "bob@example.com"))
+
+	tests := []struct {
+		username, email, field string
+	}{
+		{"Alice", "bob@example.com", "username"},
+		{"bob", "ALICE@example.com", "email"},
+	}
+	for _, tt := range tests {
+		update, _ := repo.FindByID(ctx, bob.ID)
+		update.Username = tt.username
+		update.Email = tt.email
+		err := repo.Update(ctx, update)
+		checkConflict(t, err, tt.field, "Update(%q, %q)", tt.username, tt.email)
+	}
+
+	got, _ := repo.FindByID(ctx, bob.ID)
+	checkSameUser(t, "FindByID after rejected Updates", got, bob)
+}
+
+func testUpdateMissing(t *testing.T, repo repositories.UserRepository) {
+	user := newUser("alice", "alice@example.com")
+	user.ID = 999
+	user.Version = 1
+	if err := repo.Update(context.Background(), user); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("Update(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+func testDeleteIsSoft(t *testing.T, repo repositories.UserRepository) {
+	ctx := context.Background()
+	alice := mustCreate(t, repo, newUser("alice", "alice@example.com"))
+	bob := mustCreate(t, repo, newUser("bob", "bob@example.com"))
+
+	if err := repo.Delete(ctx, alice.ID, time.Now()); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := repo.FindByID(ctx, alice.ID); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("FindByID after Delete error = %v, want ErrNotFound", err)
+	}
+	if _, err := repo.FindByUsername(ctx, "alice"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("FindByUsername after Delete error = %v, want ErrNotFound", err)
+	}
+	if _, err := repo.FindByEmail(ctx, "alice@example.com"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("FindByEmail after Delete error = %v, want ErrNotFound", err)
+	}
+	if err := repo.Delete(ctx, alice.ID, time.Now()); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("second Delete error = %v, want ErrNotFound", err)
+	}
+	if err := repo.Delete(ctx, 999, time.Now()); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("Delete(missing) error = %v, want ErrNotFound", err)
+	}
+
+	// Deleted users cannot be updated, even at their current version
+	update := *alice
+	update.Version = 2
+	update.FirstName = "changed"
+	if err := repo.Update(ctx, &update); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("Update after Delete error = %v, want ErrNotFound", err)
+	}
+
+	users, _ := repo.FindAll(ctx)
+	if got := userIDs(users); !slices.Equal(got, []uint{bob.ID}) {
+		t.Errorf("FindAll after Delete returned IDs %v, want [%d]", got, bob.ID)
+	}
+	page, err := repo.Query(ctx, repositories.UserQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := userIDs(page.Users); !slices.Equal(got, []uint{bob.ID}) || page.Total != 1 {
+		t.Errorf("Query after Delete returned IDs %v (total %d), want [%d] (total 1)", got, page.Total, bob.ID)
+	}
+
+	// The username and email stay reserved so the user can be restored
+	checkConflict(t, repo.Create(ctx, newUser("ALICE", "other@example.com")), "username", "Create(deleted username)")
+	checkConflict(t, repo.Create(ctx, newUser("other", "alice@example.com")), "email", "Create(deleted email)")
+	rename := *bob
+	rename.Username = "alice"
+	checkConflict(t, repo.Update(ctx, &rename), "username", "Update(deleted username)")
+}
+
+func testFindDeleted(t *testing.T, repo repositories.UserRepository) {
+	ctx := context.Background()
+	alice := mustCreate(t, repo, newUser("alice", "alice@example.com"))
+	mustCreate(t, repo, newUser("bob", "bob@example.com"))
+	carol := mustCreate(t, repo, newUser("carol", "carol@example.com"))
+
+	deletedAt := time.Now().UTC().Truncate(time.Millisecond)
+	aliceDeletedAt := deletedAt.Add(time.Minute)
+	if err := repo.Delete(ctx, carol.ID, deletedAt); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete(ctx, alice.ID, aliceDeletedAt); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := repo.FindDeleted(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := userIDs(deleted); !slices.Equal(got, []uint{alice.ID, carol.ID}) {
+		t.Fatalf("FindDeleted returned IDs %v, want [%d %d]", got, alice.ID, carol.ID)
+	}
+	want := *alice
+	want.Version = 2
+	want.DeletedAt = &aliceDeletedAt
+	checkSameUser(t, "FindDeleted", &deleted[0], &want)
+
+	// The deletion time is not shared with the store either
+	*deleted[0].DeletedAt = time.Time{}
+	again, _ := repo.FindDeleted(ctx)
+	checkSameUser(t, "FindDeleted after changing a returned user", &again[0], &want)
+}
+
+func testFindDeletedByID(t *testing.T, repo repositories.UserRepository) {
+	ctx := context.Background()
+	alice := mustCreate(t, repo, newUser("alice", "alice@example.com"))
+	bob := mustCreate(t, repo, newUser("bob", "bob@example.com"))
+
+	deletedAt := time.Now().UTC().Truncate(time.Millisecond)
+	if err := repo.Delete(ctx, alice.ID, deletedAt); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := repo.FindDeletedByID(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("FindDeletedByID: %v", err)
+	}
+	want := *alice
+	want.Version = 2
+	want.DeletedAt = &deletedAt
+	checkSameUser(t, "FindDeletedByID", got, &want)
+
+	if _, err := repo.FindDeletedByID(ctx, bob.ID); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("FindDeletedByID(active user) error = %v, want ErrNotFound", err)
+	}
+	if _, err := repo.FindDeletedByID(ctx, 999); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("FindDeletedByID(missing) error = %v, want ErrNotFound", err)
+	}
+	if err := repo.Restore(ctx, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.FindDeletedByID(ctx, alice.ID); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("FindDeletedByID(restored user) error = %v, want ErrNotFound", err)
+	}
+}
+
+func testRestore(t *testing.T, repo repositories.UserRepository) {
+	ctx := context.Background()
+	alice := mustCreate(t, repo, newUser("alice", "alice@example.com"))
+	if err := repo.Delete(ctx, alice.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.Restore(ctx, alice.ID); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	got, err := repo.FindByUsername(ctx, "alice")
+	if err != nil {
+		t.Fatalf("FindByUsername after Restore: %v", err)
+	}
+	want := *alice
+	want.Version = 3
+	checkSameUser(t, "FindByUsername after Restore", got, &want)
+	if deleted, _ := repo.FindDeleted(ctx); len(deleted) != 0 {
+		t.Errorf("FindDeleted after Restore returned %d users, want 0", len(deleted))
+	}
+
+	if err := repo.Restore(ctx, alice.ID); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("Restore(active user) error = %v, want ErrNotFound", err)
+	}
+	if err := repo.Restore(ctx, 999); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("Restore(missing) error = %v, want ErrNotFound", err)
+	}
+
+	got.FirstName = "restored"
+	if err := repo.Update(ctx, got); err != nil {
+		t.Errorf("Update after Restore: %v", err)
+	}
+}
+
+func testPurge(t *testing.T, repo repositories.UserRepository) {
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var users []*models.User
+	for _, name := range []string{"alice", "bob", "carol", "dave"} {
+		users = append(users, mustCreate(t, repo, newUser(name, name+"@example.com")))
+	}
+	for i, user := range users[:3] {
+		if err := repo.Delete(ctx, user.ID, base.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The cutoff is inclusive
+	purged, err := repo.Purge(ctx, base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if want := []uint{users[0].ID, users[1].ID}; !slices.Equal(purged, want) {
+		t.Errorf("Purge returned IDs %v, want %v", purged, want)
+	}
+	deleted, _ := repo.FindDeleted(ctx)
+	if got := userIDs(deleted); !slices.Equal(got, []uint{users[2].ID}) {
+		t.Errorf("FindDeleted after Purge returned IDs %v, want [%d]", got, users[2].ID)
+	}
+	active, _ := repo.FindAll(ctx)
+	if got := userIDs(active); !slices.Equal(got, []uint{users[3].ID}) {
+		t.Errorf("FindAll after Purge returned IDs %v, want [%d]", got, users[3].ID)
+	}
+	if err := repo.Restore(ctx, users[0].ID); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("Restore after Purge error = %v, want ErrNotFound", err)
+	}
+	if purged, err := repo.Purge(ctx, base.Add(time.Hour)); err != nil || len(purged) != 0 {
+		t.Errorf("second Purge = %v, %v; want no IDs", purged, err)
+	}
+
+	// Purged usernames and emails are free again, and IDs are not reused
+	again := mustCreate(t, repo, newUser("alice", "alice@example.com"))
+	for _, user := range users {
+		if again.ID == user.ID {
+			t.Errorf("Create after Purge reused ID %d", again.ID)
+		}
+	}
+}
+
+func testQueryFilters(t *testing.T, repo repositories.UserRepository) {
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, name := range []string{"alice", "bob", "carol", "dave"} {
+		user := newUser(name, name+"@example.com")
+		user.CreatedAt = base.Add(time.Duration(i) * time.Hour)
+		mustCreate(t, repo, user)
+	}
+
+	tests := []struct {
+		name  string
+		query repositories.UserQuery
+		want  []string
+	}{
+		{"NoFilter", repositories.UserQuery{}, []string{"alice", "bob", "carol", "dave"}},
+		{"Username", repositories.UserQuery{Username: "BOB"}, []string{"bob"}},
+		{"Email", repositories.UserQuery{Email: "Carol@Example.com"}, []string{"carol"}},
+		{"CreatedAfter", repositories.UserQuery{CreatedAfter: base.Add(time.Hour)}, []string{"carol", "dave"}},
+		{"Combined", repositories.UserQuery{Username: "alice", CreatedAfter: base}, nil},
+		{"SortDesc", repositories.UserQuery{Sort: []repositories.SortField{{Field: "username", Desc: true}}}, []string{"dave", "carol", "bob", "alice"}},
+	}
+	for _, tt := range tests {
+		page, err := repo.Query(ctx, tt.query)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := usernames(page.Users); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+		if page.Total != len(tt.want) || page.NextCursor != "" {
+			t.Errorf("%s: total %d, cursor %q; want %d and no cursor", tt.name, page.Total, page.NextCursor, len(tt.want))
+		}
+	}
+}
+
+func testQueryPaginates(t *testing.T, repo repositories.UserRepository) {
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 7; i++ {
+		name := fmt.Sprintf("user%d", i)
+		user := newUser(name, name+"@example.com")
+		// Pairs share a timestamp so the ID tiebreaker is exercised
+		user.CreatedAt = base.Add(time.Duration(i/2) * time.Hour)
+		mustCreate(t, repo, user)
+	}
+	// Newest first, then by ascending ID
+	want := []string{"user6", "user4", "user5", "user2", "user3", "user0", "user1"}
+
+	q := repositories.UserQuery{Sort: []repositories.SortField{{Field: "created_at", Desc: true}}, Limit: 3}
+	var got []string
+	for pages := 0; ; pages++ {
+		if pages > len(want) {
+			t.Fatal("pagination did not terminate")
+		}
+		page, err := repo.Query(ctx, q)
+		if err != nil {
+			t.Fatalf("page %d: %v", pages, err)
+		}
+		if page.Total != len(want) {
+			t.Errorf("page %d: total %d, want %d", pages, page.Total, len(want))
+		}
+		if len(page.Users) > q.Limit {
+			t.Errorf("page %d: %d users, limit is %d", pages, len(page.Users), q.Limit)
+		}
+		got = append(got, usernames(page.Users)...)
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("paginated through %v, want %v", got, want)
+	}
+}
+
+func testQueryRejectsInvalidInput(t *testing.T, repo repositories.UserRepository) {
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		mustCreate(t, repo, newUser(fmt.Sprintf("user%d", i), fmt.Sprintf("user%d@example.com", i)))
+	}
+
+	bad := []repositories.UserQuery{
+		{Sort: []repositories.SortField{{Field: "password"}}},
+		{Sort: []repositories.SortField{{Field: "username"}, {Field: "username", Desc: true}}},
+		{Cursor: "not a cursor"},
+	}
+	page, err := repo.Query(ctx, repositories.UserQuery{Limit: 1})
+	if err != nil || page.NextCursor == "" {
+		t.Fatalf("Query(limit 1) = %v, %v; want a next cursor", page, err)
+	}
+	// A cursor only continues the sort it was issued for
+	bad = append(bad, repositories.UserQuery{Cursor: page.NextCursor, Sort: []repositories.SortField{{Field: "email"}}})
+
+	for _, q := range bad {
+		if _, err := repo.Query(ctx, q); !errors.Is(err, repositories.ErrInvalidQuery) {
+			t.Errorf("Query(%+v) error = %v, want ErrInvalidQuery", q, err)
+		}
+	}
+}
+
+func testReturnedUsersAreCopies(t *testing.T, repo repositories.UserRepository) {
+	ctx := context.Background()
+	user := newUser("alice", "alice@example.com")
+	user.Permissions = []models.Permission{models.PermUsersRead}
+	mustCreate(t, repo, user)
+	want := *user
+	want.Permissions = slices.Clone(user.Permissions)
+
+	// Changing the argument after Create must not reach the store
+	user.FirstName = "changed"
+	user.Permissions[0] = models.PermUsersDelete
+
+	got, err := repo.FindByID(ctx, want.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSameUser(t, "FindByID after changing the created user", got, &want)
+
+	// Nor must changing what a read returned
+	got.FirstName = "changed"
+	got.Permissions[0] = models.PermUsersDelete
+	users, _ := repo.FindAll(ctx)
+	users[0].Permissions[0] = models.PermUsersDelete
+
+	got, _ = repo.FindByID(ctx, want.ID)
+	checkSameUser(t, "FindByID after changing read users", got, &want)
+
+	// Or the argument of an Update
+	got.LastName = "updated"
+	if err := repo.Update(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	want = *got
+	want.Permissions = slices.Clone(got.Permissions)
+	got.Permissions[0] = models.PermUsersDelete
+
+	got, _ = repo.FindByID(ctx, want.ID)
+	checkSameUser(t, "FindByID after changing the updated user", got, &want)
+}
+
+func testCanceledContext(t *testing.T, repo repositories.UserRepository) {
+	user := mustCreate(t, repo, newUser("alice", "alice@example.com"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := map[string]func() error{
+		"FindAll":        func() error { _, err := repo.FindAll(ctx); return err },
+		"Query":          func() error { _, err := repo.Query(ctx, repositories.UserQuery{}); return err },
+		"FindByID":       func() error { _, err := repo.FindByID(ctx, user.ID); return err },
+		"FindByUsername": func() error { _, err := repo.FindByUsername(ctx, "alice"); return err },
+		"FindByEmail":    func() error { _, err := repo.FindByEmail(ctx, "alice@example.com"); return err },
+		"Create":         func() error { return repo.Create(ctx, newUser("bob", "bob@example.com")) },
+		"Update": func() error {
+			update := *user
+			update.FirstName = "changed"
+			return repo.Update(ctx, &update)
+		},
+		"Delete":          func() error { return repo.Delete(ctx, user.ID, time.Now()) },
+		"FindDeleted":     func() error { _, err := repo.FindDeleted(ctx); return err },
+		"FindDeletedByID": func() error { _, err := repo.FindDeletedByID(ctx, user.ID); return err },
+		"Restore":         func() error { return repo.Restore(ctx, user.ID) },
+		"Purge":           func() error { _, err := repo.Purge(ctx, time.Now()); return err },
+	}
+	for name, call := range calls {
+		if err := call(); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s with a canceled context error = %v, want context.Canceled", name, err)
+		}
+	}
+
+	// None of the writes may have happened
+	users, err := repo.FindAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 {
+		t.Fatalf("FindAll returned %d users after canceled writes, want 1", len(users))
+	}
+	checkSameUser(t, "FindAll after canceled writes", &users[0], user)
+}
+
+func testConcurrentAccess(t *testing.T, repo repositories.UserRepository) {
+	ctx := context.Background()
+	const perWorker = 10
+
+	// Disjoint creates from every worker must all succeed with distinct IDs
+	runConcurrently(t, stressWorkers, func(i int) error {
+		for n := 0; n < perWorker; n++ {
+			name := fmt.Sprintf("w%dn%d", i, n)
+			if err := repo.Create(ctx, newUser(name, name+"@example.com")); err != nil {
+				return err
+			}
+			if _, err := repo.FindByUsername(ctx, name); err != nil {
+				return fmt.Errorf("FindByUsername(%q) right after Create: %w", name, err)
+			}
+		}
+		return nil
+	}, nil)
+
+	users, err := repo.FindAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != stressWorkers*perWorker {
+		t.Errorf("FindAll returned %d users, want %d", len(users), stressWorkers*perWorker)
+	}
+	checkConsistent(t, repo)
+}
+
+// checkConflict asserts that err is a *repositories.ConflictError for field
+func checkConflict(t *testing.T, err error, field string, format string, args ...any) {
+	t.Helper()
+	call := fmt.Sprintf(format, args...)
+	var conflict *repositories.ConflictError
+	if !errors.As(err, &conflict) || !errors.Is(err, repositories.ErrConflict) {
+		t.Errorf("%s error = %v, want a *ConflictError matching ErrConflict", call, err)
+		return
+	}
+	if conflict.Field != field {
+		t.Errorf("%s conflicted on %q, want %q", call, conflict.Field, field)
+	}
+}
+
+// checkSameUser compares every stored field of two users
+func checkSameUser(t *testing.T, context string, got, want *models.User) {
+	t.Helper()
+	same := got.ID == want.ID &&
+		got.Username == want.Username &&
+		got.Email == want.Email &&
+		got.Password == want.Password &&
+		got.FirstName == want.FirstName &&
+		got.LastName == want.LastName &&
+		got.EffectiveRole() == want.EffectiveRole() &&
+		slices.Equal(got.Permissions, want.Permissions) &&
+		got.Version == want.Version &&
+		got.CreatedAt.Equal(want.CreatedAt) &&
+		got.UpdatedAt.Equal(want.UpdatedAt) &&
+		(got.DeletedAt == nil) == (want.DeletedAt == nil) &&
+		(got.DeletedAt == nil || got.DeletedAt.Equal(*want.DeletedAt))
+	if !same {
+		t.Errorf("%s:\n got %+v\nwant %+v", context, got, want)
+	}
+}
+
+func first(users []models.User, err error) (*models.User, error) {
+	if err != nil {
+		return nil, err
+	}
+	if len(users) != 1 {
+		return nil, fmt.Errorf("got %d users, want 1", len(users))
+	}
+	return &users[0], nil
+}
+
+func firstOfPage(page *repositories.UserPage, err error) (*models.User, error) {
+	if err != nil {
+		return nil, err
+	}
+	return first(page.Users, nil)
+}
+
+func userIDs(users []models.User) []uint {
+	ids := make([]uint, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	return ids
+}
+
+func usernames(users []models.User) []string {
+	var names []string
+	for _, u := range users {
+		names = append(names, strings.ToLower(u.Username))
+	}
+	return names
+}
@@ -0,0 +1,289 @@
+// Package repotest checks repositories.UserRepository implementations against
+// the interface contract. Storage backends call its suites from their own
+// tests with a Factory that opens an empty repository.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rizqishq/Go-REST/models"
+	"github.com/rizqishq/Go-REST/repositories"
+)
+
+// Factory returns an empty repository for a single test. Register any
+// cleanup with t.Cleanup.
+type Factory func(t *testing.T) repositories.UserRepository
+
+// Workload sizes for StressUserRepository
+const (
+	stressWorkers    = 8
+	stressIterations = 25
+)
+
+// StressUserRepository runs concurrent workloads against a repository and
+// checks that no write is lost and no caller shares memory with another. Run
+// it under the race detector (go test -race) so unsynchronized access to
+// stored users is reported.
+func StressUserRepository(t *testing.T, newRepo Factory) {
+	t.Run("ConcurrentCreateSameUsername", func(t *testing.T) {
+		repo := newRepo(t)
+		created := runConcurrently(t, stressWorkers, func(i int) error {
+			return repo.Create(context.Background(), newUser("taken", fmt.Sprintf("taken%d@example.com", i)))
+		}, repositories.ErrConflict)
+		if created != 1 {
+			t.Fatalf("%d concurrent creates with the same username succeeded, want 1", created)
+		}
+	})
+
+	t.Run("ConcurrentCreateSameEmail", func(t *testing.T) {
+		repo := newRepo(t)
+		created := runConcurrently(t, stressWorkers, func(i int) error {
+			return repo.Create(context.Background(), newUser(fmt.Sprintf("taken%d", i), "TAKEN@example.com"))
+		}, repositories.ErrConflict)
+		if created != 1 {
+			t.Fatalf("%d concurrent creates with the same email succeeded, want 1", created)
+		}
+	})
+
+	t.Run("ConcurrentUpdatesAreNotLost", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		user := mustCreate(t, repo, newUser("counter", "counter@example.com"))
+
+		// Each worker increments a counter kept in LastName, retrying on a
+		// stale version; a lost update would leave the total short
+		runConcurrently(t, stressWorkers, func(int) error {
+			for n := 0; n < stressIterations; {
+				current, err := repo.FindByID(ctx, user.ID)
+				if err != nil {
+					return err
+				}
+				var count int
+				fmt.Sscan(current.LastName, &count)
+				current.LastName = fmt.Sprint(count + 1)
+
+				err = repo.Update(ctx, current)
+				if errors.Is(err, repositories.ErrStaleVersion) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				n++
+			}
+			return nil
+		}, nil)
+
+		got, err := repo.FindByID(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := stressWorkers * stressIterations
+		if got.LastName != fmt.Sprint(want) {
+			t.Errorf("counter = %s, want %d", got.LastName, want)
+		}
+		if got.Version != uint64(want)+1 {
+			t.Errorf("version = %d, want %d", got.Version, want+1)
+		}
+	})
+
+	t.Run("ReadersDoNotShareState", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		user := newUser("shared", "shared@example.com")
+		user.Permissions = []models.Permission{models.PermUsersRead}
+		mustCreate(t, repo, user)
+
+		// Every reader scribbles over what it got back; with shared
+		// pointers the race detector sees the writes and the other readers
+		// see the damage
+		runConcurrently(t, stressWorkers, func(i int) error {
+			for n := 0; n < stressIterations; n++ {
+				reads := []func() (*models.User, error){
+					func() (*models.User, error) { return repo.FindByID(ctx, user.ID) },
+					func() (*models.User, error) { return repo.FindByUsername(ctx, "shared") },
+					func() (*models.User, error) { return repo.FindByEmail(ctx, "shared@example.com") },
+					func() (*models.User, error) {
+						users, err := repo.FindAll(ctx)
+						if err != nil || len(users) != 1 {
+							return nil, fmt.Errorf("FindAll returned %d users: %v", len(users), err)
+						}
+						return &users[0], nil
+					},
+					func() (*models.User, error) {
+						page, err := repo.Query(ctx, repositories.UserQuery{Limit: 10})
+						if err != nil || len(page.Users) != 1 {
+							return nil, fmt.Errorf("Query returned %v: %v", page, err)
+						}
+						return &page.Users[0], nil
+					},
+				}
+				got, err := reads[(i+n)%len(reads)]()
+				if err != nil {
+					return err
+				}
+				if got.Username != "shared" || len(got.Permissions) != 1 || got.Permissions[0] != models.PermUsersRead {
+					return fmt.Errorf("read a modified user: %+v", got)
+				}
+				got.Username = fmt.Sprintf("scribble%d", i)
+				got.Permissions[0] = models.PermUsersDelete
+			}
+			return nil
+		}, nil)
+	})
+
+	t.Run("MixedWorkload", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		// Workers share a small pool of names so creates and renames collide,
+		// and deleted names stay taken until a purge frees them
+		runConcurrently(t, stressWorkers, func(i int) error {
+			for n := 0; n < stressIterations; n++ {
+				name := fmt.Sprintf("user%d", (i*7+n)%10)
+				var err error
+				switch n % 4 {
+				case 0, 1:
+					err = repo.Create(ctx, newUser(name, name+"@example.com"))
+				case 2:
+					var user *models.User
+					if user, err = repo.FindByUsername(ctx, name); err == nil {
+						renamed := fmt.Sprintf("user%d", (i+n)%10)
+						user.Username = strings.ToUpper(renamed)
+						user.Email = renamed + "@example.com"
+						err = repo.Update(ctx, user)
+					}
+				case 3:
+					var user *models.User
+					if user, err = repo.FindByEmail(ctx, name+"@example.com"); err == nil {
+						err = repo.Delete(ctx, user.ID, time.Now())
+					}
+					if err == nil && n%8 == 7 {
+						_, err = repo.Purge(ctx, time.Now())
+					}
+				}
+				if err != nil && !errors.Is(err, repositories.ErrNotFound) &&
+					!errors.Is(err, repositories.ErrConflict) && !errors.Is(err, repositories.ErrStaleVersion) {
+					return err
+				}
+			}
+			return nil
+		}, nil)
+
+		checkConsistent(t, repo)
+	})
+}
+
+// runConcurrently calls fn from n goroutines and returns how many calls
+// succeeded. Errors matching allowed are expected; others fail the test.
+func runConcurrently(t *testing.T, n int, fn func(i int) error, allowed error) int {
+	t.Helper()
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+		failures  []error
+	)
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			err := fn(i)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded++
+			case allowed == nil || !errors.Is(err, allowed):
+				failures = append(failures, err)
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	if len(failures) > 0 {
+		t.Fatalf("unexpected errors: %v", errors.Join(failures...))
+	}
+	return succeeded
+}
+
+// checkConsistent verifies that every lookup agrees with FindAll and that no
+// username or email is stored twice, counting soft-deleted users
+func checkConsistent(t *testing.T, repo repositories.UserRepository) {
+	t.Helper()
+	ctx := context.Background()
+
+	users, err := repo.FindAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := repo.FindDeleted(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usernames := make(map[string]uint)
+	emails := make(map[string]uint)
+	for _, user := range append(deleted, users...) {
+		if id, ok := usernames[strings.ToLower(user.Username)]; ok {
+			t.Errorf("username %q is used by users %d and %d", user.Username, id, user.ID)
+		}
+		if id, ok := emails[strings.ToLower(user.Email)]; ok {
+			t.Errorf("email %q is used by users %d and %d", user.Email, id, user.ID)
+		}
+		usernames[strings.ToLower(user.Username)] = user.ID
+		emails[strings.ToLower(user.Email)] = user.ID
+
+		if user.DeletedAt != nil {
+			if _, err := repo.FindByID(ctx, user.ID); !errors.Is(err, repositories.ErrNotFound) {
+				t.Errorf("FindByID(%d) of a deleted user error = %v, want ErrNotFound", user.ID, err)
+			}
+			continue
+		}
+		if found, err := repo.FindByUsername(ctx, user.Username); err != nil || found.ID != user.ID {
+			t.Errorf("FindByUsername(%q) = %v, %v; want user %d", user.Username, found, err, user.ID)
+		}
+		if found, err := repo.FindByEmail(ctx, user.Email); err != nil || found.ID != user.ID {
+			t.Errorf("FindByEmail(%q) = %v, %v; want user %d", user.Email, found, err, user.ID)
+		}
+	}
+
+	page, err := repo.Query(ctx, repositories.UserQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != len(users) {
+		t.Errorf("Query total = %d, FindAll returned %d users", page.Total, len(users))
+	}
+}
+
+// newUser returns an unsaved user with the given unique fields
+func newUser(username, email string) *models.User {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	return &models.User{
+		Username:  username,
+		Email:     email,
+		Password:  "hash",
+		Role:      models.RoleUser,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// mustCreate stores user and fails the test on error
+func mustCreate(t *testing.T, repo repositories.UserRepository, user *models.User) *models.User {
+	t.Helper()
+	if err := repo.Create(context.Background(), user); err != nil {
+		t.Fatalf("Create(%q): %v", user.Username, err)
+	}
+	return user
+}
@@ -0,0 +1,101 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rizqishq/Go-REST/models"
+)
+
+const auditColumns = "id, actor_id, actor, action, user_id, changes, request_id, created_at"
+
+// SQLAuditRepository implements AuditRepository with database/sql. Entries
+// are not tied to the users table, so they outlive purged users. Methods join
+// the SQLTransactor transaction in their context.
+type SQLAuditRepository struct {
+	db *sql.DB
+}
+
+// Create new repository sharing the user repository's database
+func NewSQLAuditRepository(users *SQLUserRepository) *SQLAuditRepository {
+	return &SQLAuditRepository{db: users.db}
+}
+
+func (r *SQLAuditRepository) Create(ctx context.Context, entry *models.AuditEntry) error {
+	var changes string
+	if len(entry.Changes) > 0 {
+		data, err := json.Marshal(entry.Changes)
+		if err != nil {
+			return fmt.Errorf("encode audit changes: %w", err)
+		}
+		changes = string(data)
+	}
+
+	res, err := conn(ctx, r.db).ExecContext(ctx,
+		`INSERT INTO audit_log (actor_id, actor, action, user_id, changes, request_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		entry.ActorID, entry.Actor, entry.Action, entry.UserID, changes, entry.RequestID, entry.CreatedAt.UTC())
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	entry.ID = uint(id)
+	return nil
+}
+
+func (r *SQLAuditRepository) Query(ctx context.Context, q AuditQuery) ([]models.AuditEntry, error) {
+	var where []string
+	var args []any
+	if q.UserID != 0 {
+		where = append(where, "user_id = ?")
+		args = append(args, q.UserID)
+	}
+	if q.Action != "" {
+		where = append(where, "action = ?")
+		args = append(args, q.Action)
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, q.Since.UTC())
+	}
+	if q.AfterID != 0 {
+		where = append(where, "id > ?")
+		args = append(args, q.AfterID)
+	}
+
+	query := "SELECT " + auditColumns + " FROM audit_log" + whereClause(where) + " ORDER BY id"
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]models.AuditEntry, 0)
+	for rows.Next() {
+		var entry models.AuditEntry
+		var changes string
+		err := rows.Scan(&entry.ID, &entry.ActorID, &entry.Actor, &entry.Action, &entry.UserID,
+			&changes, &entry.RequestID, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if changes != "" {
+			if err := json.Unmarshal([]byte(changes), &entry.Changes); err != nil {
+				return nil, fmt.Errorf("decode audit changes of entry %d: %w", entry.ID, err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
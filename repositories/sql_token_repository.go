@@ -0,0 +1,60 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/rizqishq/Go-REST/models"
+)
+
+// SQLRefreshTokenRepository implements RefreshTokenRepository with database/sql
+type SQLRefreshTokenRepository struct {
+	db *sql.DB
+}
+
+// Create new repository sharing the user repository's database
+func NewSQLRefreshTokenRepository(users *SQLUserRepository) *SQLRefreshTokenRepository {
+	return &SQLRefreshTokenRepository{db: users.db}
+}
+
+func (r *SQLRefreshTokenRepository) Create(ctx context.Context, token *models.RefreshToken) error {
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE expires_at < ?", time.Now().UTC()); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO refresh_tokens (token_hash, user_id, family_id, expires_at, created_at, revoked)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		token.TokenHash, token.UserID, token.FamilyID, token.ExpiresAt.UTC(), token.CreatedAt.UTC(), token.Revoked)
+	return mapSQLError(err)
+}
+
+func (r *SQLRefreshTokenRepository) FindByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.db.QueryRowContext(ctx,
+		`SELECT token_hash, user_id, family_id, expires_at, created_at, revoked
+		FROM refresh_tokens WHERE token_hash = ?`, hash).
+		Scan(&token.TokenHash, &token.UserID, &token.FamilyID, &token.ExpiresAt, &token.CreatedAt, &token.Revoked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *SQLRefreshTokenRepository) Revoke(ctx context.Context, hash string) error {
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE refresh_tokens SET revoked = TRUE WHERE token_hash = ? AND revoked = FALSE", hash)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+func (r *SQLRefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked = TRUE WHERE family_id = ?", familyID)
+	return err
+}
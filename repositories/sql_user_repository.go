@@ -0,0 +1,406 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rizqishq/Go-REST/models"
+)
+
+const userColumns = "id, username, email, password, first_name, last_name, role, permissions, version, created_at, updated_at, deleted_at"
+
+// SQLUserRepository implements UserRepository with database/sql. The schema
+// is managed by MigrateUp and targets SQLite. Timestamps are written in UTC so
+// they sort correctly as text. Methods join the SQLTransactor transaction in
+// their context.
+type SQLUserRepository struct {
+	db *sql.DB
+}
+
+// Create new repository on an open database
+func NewSQLUserRepository(db *sql.DB) *SQLUserRepository {
+	return &SQLUserRepository{db: db}
+}
+
+// OpenSQLUserRepository opens the database, applies the connection limit and
+// runs pending migrations.
+func OpenSQLUserRepository(ctx context.Context, driver, dsn string, maxConnections int) (*SQLUserRepository, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if maxConnections > 0 {
+		db.SetMaxOpenConns(maxConnections)
+		db.SetMaxIdleConns(maxConnections)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := MigrateUp(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return NewSQLUserRepository(db), nil
+}
+
+// conn returns the transaction in ctx, if any, or the connection pool
+func (r *SQLUserRepository) conn(ctx context.Context) dbtx {
+	return conn(ctx, r.db)
+}
+
+// Close releases the underlying connection pool
+func (r *SQLUserRepository) Close() error {
+	return r.db.Close()
+}
+
+// Ping checks that the database is reachable
+func (r *SQLUserRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+func (r *SQLUserRepository) FindAll(ctx context.Context) ([]models.User, error) {
+	return r.findMany(ctx, "deleted_at IS NULL")
+}
+
+func (r *SQLUserRepository) Query(ctx context.Context, q UserQuery) (*UserPage, error) {
+	sort, err := normalizedSort(q.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	where := []string{"deleted_at IS NULL"}
+	var args []any
+	if q.Username != "" {
+		where = append(where, "LOWER(username) = LOWER(?)")
+		args = append(args, q.Username)
+	}
+	if q.Email != "" {
+		where = append(where, "LOWER(email) = LOWER(?)")
+		args = append(args, q.Email)
+	}
+	if !q.CreatedAfter.IsZero() {
+		where = append(where, "created_at > ?")
+		args = append(args, q.CreatedAfter.UTC())
+	}
+
+	page := &UserPage{}
+	countQuery := "SELECT COUNT(*) FROM users" + whereClause(where)
+	if err := r.conn(ctx).QueryRowContext(ctx, countQuery, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	if q.Cursor != "" {
+		after, err := decodeCursor(q.Cursor, sort)
+		if err != nil {
+			return nil, err
+		}
+		cond, condArgs := keysetCondition(after, sort)
+		where = append(where, cond)
+		args = append(args, condArgs...)
+	}
+
+	order := make([]string, len(sort))
+	for i, f := range sort {
+		order[i] = f.Field
+		if f.Desc {
+			order[i] += " DESC"
+		}
+	}
+	query := "SELECT " + userColumns + " FROM users" + whereClause(where) + " ORDER BY " + strings.Join(order, ", ")
+	if q.Limit > 0 {
+		// Fetch one extra row to learn whether another page follows
+		query += " LIMIT ?"
+		args = append(args, q.Limit+1)
+	}
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page.Users = make([]models.User, 0)
+	for rows.Next() {
+		var user models.User
+		if err := scanUser(rows, &user); err != nil {
+			return nil, err
+		}
+		page.Users = append(page.Users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if q.Limit > 0 && len(page.Users) > q.Limit {
+		page.Users = page.Users[:q.Limit]
+		page.NextCursor = encodeCursor(&page.Users[q.Limit-1], sort)
+	}
+	return page, nil
+}
+
+func (r *SQLUserRepository) FindByID(ctx context.Context, id uint) (*models.User, error) {
+	return r.findOne(ctx, "deleted_at IS NULL AND id = ?", id)
+}
+
+func (r *SQLUserRepository) FindByUsername(ctx context.Context, username string) (*models.User, error) {
+	return r.findOne(ctx, "deleted_at IS NULL AND LOWER(username) = LOWER(?)", username)
+}
+
+func (r *SQLUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.findOne(ctx, "deleted_at IS NULL AND LOWER(email) = LOWER(?)", email)
+}
+
+func (r *SQLUserRepository) Create(ctx context.Context, user *models.User) error {
+	res, err := r.conn(ctx).ExecContext(ctx,
+		`INSERT INTO users (username, email, password, first_name, last_name, role, permissions, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		user.Username, user.Email, user.Password, user.FirstName, user.LastName,
+		user.EffectiveRole(), joinPermissions(user.Permissions), user.CreatedAt.UTC(), user.UpdatedAt.UTC())
+	if err != nil {
+		return mapSQLError(err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	user.ID = uint(id)
+	user.Version = 1
+	return nil
+}
+
+func (r *SQLUserRepository) Update(ctx context.Context, user *models.User) error {
+	res, err := r.conn(ctx).ExecContext(ctx,
+		`UPDATE users SET username = ?, email = ?, password = ?, first_name = ?, last_name = ?,
+		role = ?, permissions = ?, version = version + 1, updated_at = ?
+		WHERE id = ? AND version = ? AND deleted_at IS NULL`,
+		user.Username, user.Email, user.Password, user.FirstName, user.LastName,
+		user.EffectiveRole(), joinPermissions(user.Permissions), user.UpdatedAt.UTC(), user.ID, user.Version)
+	if err != nil {
+		return mapSQLError(err)
+	}
+
+	err = expectAffected(res)
+	if errors.Is(err, ErrNotFound) {
+		// Nothing matched: either the user is gone or its version moved on
+		var exists bool
+		if err := r.conn(ctx).QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = ? AND deleted_at IS NULL)", user.ID).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return ErrStaleVersion
+		}
+	}
+	if err != nil {
+		return err
+	}
+	user.Version++
+	return nil
+}
+
+func (r *SQLUserRepository) Delete(ctx context.Context, id uint, deletedAt time.Time) error {
+	res, err := r.conn(ctx).ExecContext(ctx,
+		"UPDATE users SET deleted_at = ?, version = version + 1 WHERE id = ? AND deleted_at IS NULL",
+		deletedAt.UTC(), id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+func (r *SQLUserRepository) FindDeleted(ctx context.Context) ([]models.User, error) {
+	return r.findMany(ctx, "deleted_at IS NOT NULL")
+}
+
+func (r *SQLUserRepository) FindDeletedByID(ctx context.Context, id uint) (*models.User, error) {
+	return r.findOne(ctx, "deleted_at IS NOT NULL AND id = ?", id)
+}
+
+func (r *SQLUserRepository) Restore(ctx context.Context, id uint) error {
+	res, err := r.conn(ctx).ExecContext(ctx,
+		"UPDATE users SET deleted_at = NULL, version = version + 1 WHERE id = ? AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+func (r *SQLUserRepository) Purge(ctx context.Context, deletedBefore time.Time) ([]uint, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx,
+		"DELETE FROM users WHERE deleted_at IS NOT NULL AND deleted_at <= ? RETURNING id", deletedBefore.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uint
+	for rows.Next() {
+		var id uint
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// findMany returns the users matching where, ordered by ID
+func (r *SQLUserRepository) findMany(ctx context.Context, where string) ([]models.User, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, "SELECT "+userColumns+" FROM users WHERE "+where+" ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]models.User, 0)
+	for rows.Next() {
+		var user models.User
+		if err := scanUser(rows, &user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// findOne returns the user matching where
+func (r *SQLUserRepository) findOne(ctx context.Context, where string, arg any) (*models.User, error) {
+	row := r.conn(ctx).QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE "+where, arg)
+
+	var user models.User
+	if err := scanUser(row, &user); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row rowScanner, user *models.User) error {
+	var permissions string
+	var deletedAt sql.NullTime
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password,
+		&user.FirstName, &user.LastName, &user.Role, &permissions, &user.Version, &user.CreatedAt, &user.UpdatedAt, &deletedAt)
+	if err != nil {
+		return err
+	}
+	user.Permissions = splitPermissions(permissions)
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Time
+	}
+	return nil
+}
+
+// Permissions are stored as a comma-separated list
+func joinPermissions(perms []models.Permission) string {
+	parts := make([]string, len(perms))
+	for i, p := range perms {
+		parts[i] = string(p)
+	}
+	return strings.Join(parts, ",")
+}
+
+func splitPermissions(s string) []models.Permission {
+	if s == "" {
+		return nil
+	}
+	parts := strings.Split(s, ",")
+	perms := make([]models.Permission, len(parts))
+	for i, p := range parts {
+		perms[i] = models.Permission(p)
+	}
+	return perms
+}
+
+func whereClause(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+// keysetCondition matches rows that sort strictly after the cursor position:
+// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ..., with < for descending keys.
+func keysetCondition(after *models.User, sort []SortField) (string, []any) {
+	var ors []string
+	var args []any
+	for i, f := range sort {
+		var ands []string
+		for _, prev := range sort[:i] {
+			ands = append(ands, prev.Field+" = ?")
+			args = append(args, sqlValue(after, prev.Field))
+		}
+		op := " > ?"
+		if f.Desc {
+			op = " < ?"
+		}
+		ands = append(ands, f.Field+op)
+		args = append(args, sqlValue(after, f.Field))
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", args
+}
+
+// sqlValue returns a field value as stored, with times in UTC so SQLite's
+// textual timestamps compare in chronological order.
+func sqlValue(user *models.User, field string) any {
+	if t, ok := fieldValue(user, field).(time.Time); ok {
+		return t.UTC()
+	}
+	return fieldValue(user, field)
+}
+
+func expectAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// mapSQLError translates unique-constraint violations into a *ConflictError.
+// Drivers do not share an error type for this, so the message is matched
+// instead.
+func mapSQLError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "UNIQUE constraint failed"), // SQLite
+		strings.Contains(msg, "duplicate key value"), // PostgreSQL
+		strings.Contains(msg, "Duplicate entry"):     // MySQL
+		return &ConflictError{Field: conflictField(msg)}
+	}
+	return err
+}
+
+// conflictField finds the user column in a constraint violation message. The
+// column constraints are reported as users.<column> or users_<column>_key and
+// the case-insensitive indexes are named idx_users_<column>_lower.
+func conflictField(msg string) string {
+	for _, field := range []string{"username", "email"} {
+		if strings.Contains(msg, "users."+field) || strings.Contains(msg, "users_"+field+"_") {
+			return field
+		}
+	}
+	return ""
+}
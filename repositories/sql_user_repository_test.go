@@ -0,0 +1,55 @@
+package repositories_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/rizqishq/Go-REST/repositories"
+	"github.com/rizqishq/Go-REST/repositories/repotest"
+	_ "modernc.org/sqlite"
+)
+
+func openSQLiteRepository(t *testing.T) *repositories.SQLUserRepository {
+	dsn := "file:" + filepath.Join(t.TempDir(), "users.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	repo, err := repositories.OpenSQLUserRepository(context.Background(), "sqlite", dsn, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func newSQLiteRepository(t *testing.T) repositories.UserRepository {
+	return openSQLiteRepository(t)
+}
+
+func TestSQLUserRepositoryStress(t *testing.T) {
+	repotest.StressUserRepository(t, newSQLiteRepository)
+}
+
+func TestSQLUserRepository(t *testing.T) {
+	repotest.TestUserRepository(t, newSQLiteRepository)
+}
+
+func TestSQLAuditRepository(t *testing.T) {
+	repotest.TestAuditRepository(t, func(t *testing.T) repotest.Store {
+		users := openSQLiteRepository(t)
+		return repotest.Store{
+			Users: users,
+			Audit: repositories.NewSQLAuditRepository(users),
+			Tx:    repositories.NewSQLTransactor(users),
+		}
+	})
+}
+
+func TestSQLUserRepositoryPing(t *testing.T) {
+	repo := openSQLiteRepository(t)
+	if err := repo.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping() = %v", err)
+	}
+	repo.Close()
+	if err := repo.Ping(context.Background()); err == nil {
+		t.Error("Ping() succeeded after Close")
+	}
+}
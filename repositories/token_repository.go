@@ -0,0 +1,105 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rizqishq/Go-REST/models"
+)
+
+// RefreshTokenRepository stores issued refresh tokens by hash
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token *models.RefreshToken) error
+	FindByHash(ctx context.Context, hash string) (*models.RefreshToken, error)
+	// Revoke marks an active token as used. It returns ErrNotFound if the
+	// token does not exist or was already revoked, so that exactly one of
+	// several concurrent refreshes with the same token can succeed.
+	Revoke(ctx context.Context, hash string) error
+	RevokeFamily(ctx context.Context, familyID string) error
+}
+
+// InMemoryRefreshTokenRepository implements RefreshTokenRepository in memory
+type InMemoryRefreshTokenRepository struct {
+	tokens map[string]*models.RefreshToken
+	mutex  sync.Mutex
+}
+
+// Create new empty repository
+func NewInMemoryRefreshTokenRepository() *InMemoryRefreshTokenRepository {
+	return &InMemoryRefreshTokenRepository{
+		tokens: make(map[string]*models.RefreshToken),
+	}
+}
+
+func (r *InMemoryRefreshTokenRepository) Create(ctx context.Context, token *models.RefreshToken) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Drop expired tokens so the map does not grow without bound
+	now := time.Now()
+	for hash, t := range r.tokens {
+		if now.After(t.ExpiresAt) {
+			delete(r.tokens, hash)
+		}
+	}
+
+	if _, ok := r.tokens[token.TokenHash]; ok {
+		return ErrConflict
+	}
+	stored := *token
+	r.tokens[token.TokenHash] = &stored
+	return nil
+}
+
+func (r *InMemoryRefreshTokenRepository) FindByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	token, ok := r.tokens[hash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *token
+	return &found, nil
+}
+
+func (r *InMemoryRefreshTokenRepository) Revoke(ctx context.Context, hash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	token, ok := r.tokens[hash]
+	if !ok || token.Revoked {
+		return ErrNotFound
+	}
+	token.Revoked = true
+	return nil
+}
+
+func (r *InMemoryRefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, token := range r.tokens {
+		if token.FamilyID == familyID {
+			token.Revoked = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// Transactor runs a function as one unit of work. Writes that repositories of
+// the same backend make with the context passed to fn take effect together,
+// or not at all when fn returns an error. Nested calls join the outer
+// transaction.
+type Transactor interface {
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type journalKey struct{}
+
+// journal collects the compensating actions of the in-memory writes made in
+// a transaction
+type journal struct {
+	undo []func()
+}
+
+// onRollback registers undo with the transaction in ctx, if there is one
+func onRollback(ctx context.Context, undo func()) {
+	if j, _ := ctx.Value(journalKey{}).(*journal); j != nil {
+		j.undo = append(j.undo, undo)
+	}
+}
+
+// withoutJournal hides the transaction in ctx from a repository another one
+// delegates to, so only the outer repository registers an undo
+func withoutJournal(ctx context.Context) context.Context {
+	return context.WithValue(ctx, journalKey{}, (*journal)(nil))
+}
+
+// InMemoryTransactor implements Transactor for the in-memory repositories.
+// Writes are applied right away and undone in reverse order if fn fails, so
+// transactions run one at a time.
+type InMemoryTransactor struct {
+	mutex sync.Mutex
+}
+
+// Create new InMemoryTransactor
+func NewInMemoryTransactor() *InMemoryTransactor {
+	return &InMemoryTransactor{}
+}
+
+func (t *InMemoryTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if j, _ := ctx.Value(journalKey{}).(*journal); j != nil {
+		return fn(ctx)
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	j := &journal{}
+	if err := fn(context.WithValue(ctx, journalKey{}, j)); err != nil {
+		for i := len(j.undo) - 1; i >= 0; i-- {
+			j.undo[i]()
+		}
+		return err
+	}
+	return nil
+}
+
+type fileTxKey struct{}
+
+// fileTx collects the log records of a FileTransactor transaction
+type fileTx struct {
+	users   *FileUserRepository
+	records []walRecord
+	// undo reverts the in-memory change of each record
+	undo []func()
+	// committed run once the records are durable
+	committed []func()
+}
+
+// FileTransactor implements Transactor for the file-backed repositories. The
+// log records of a transaction are written and fsynced as one record when it
+// commits, so a crash keeps all of its writes or none. Writes are applied in
+// memory right away and undone in reverse order if fn fails. A transaction
+// holds the writer lock of the user repository, so writes run one at a time.
+type FileTransactor struct {
+	users *FileUserRepository
+}
+
+// Create new transactor on the file user repository's log
+func NewFileTransactor(users *FileUserRepository) *FileTransactor {
+	return &FileTransactor{users: users}
+}
+
+func (t *FileTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if t.users.txFrom(ctx) != nil {
+		return fn(ctx)
+	}
+
+	t.users.mutex.Lock()
+	defer t.users.mutex.Unlock()
+
+	tx := &fileTx{users: t.users}
+	err := fn(context.WithValue(ctx, fileTxKey{}, tx))
+	if err == nil {
+		err = t.users.commit(tx)
+	}
+	if err != nil {
+		for i := len(tx.undo) - 1; i >= 0; i-- {
+			tx.undo[i]()
+		}
+		return err
+	}
+	return nil
+}
+
+type sqlTxKey struct{}
+
+// dbtx is satisfied by both *sql.DB and *sql.Tx
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn returns the transaction in ctx, or db outside of one
+func conn(ctx context.Context, db *sql.DB) dbtx {
+	if tx, ok := ctx.Value(sqlTxKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+// SQLTransactor implements Transactor with database transactions
+type SQLTransactor struct {
+	db *sql.DB
+}
+
+// Create new transactor on the user repository's database
+func NewSQLTransactor(users *SQLUserRepository) *SQLTransactor {
+	return &SQLTransactor{db: users.db}
+}
+
+func (t *SQLTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(sqlTxKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(context.WithValue(ctx, sqlTxKey{}, tx)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,201 @@
+package repositories
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rizqishq/Go-REST/models"
+)
+
+// ErrInvalidQuery is returned for unknown sort fields or malformed cursors
+var ErrInvalidQuery = errors.New("invalid query")
+
+// SortField orders results by one user field
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// UserQuery selects a filtered, sorted page of users. Filters on username and
+// email are case-insensitive exact matches; zero values disable a filter.
+type UserQuery struct {
+	Username     string
+	Email        string
+	CreatedAfter time.Time
+	Sort         []SortField
+	// Limit caps the page size; 0 returns every remaining match
+	Limit int
+	// Cursor is the NextCursor of the previous page
+	Cursor string
+}
+
+// UserPage is one page of a UserQuery result
+type UserPage struct {
+	Users []models.User
+	// Total counts every match of the filters, across all pages
+	Total int
+	// NextCursor is empty on the last page
+	NextCursor string
+}
+
+// sortColumns lists the user fields that can be sorted on
+var sortColumns = map[string]bool{
+	"id":         true,
+	"username":   true,
+	"email":      true,
+	"first_name": true,
+	"last_name":  true,
+	"created_at": true,
+	"updated_at": true,
+}
+
+// normalizedSort validates the requested order and appends id as a tiebreaker
+// so that every ordering is total and cursors are stable.
+func normalizedSort(fields []SortField) ([]SortField, error) {
+	sort := make([]SortField, 0, len(fields)+1)
+	seen := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		if !sortColumns[f.Field] {
+			return nil, fmt.Errorf("%w: cannot sort by %q", ErrInvalidQuery, f.Field)
+		}
+		if seen[f.Field] {
+			return nil, fmt.Errorf("%w: %q sorted more than once", ErrInvalidQuery, f.Field)
+		}
+		seen[f.Field] = true
+		sort = append(sort, f)
+	}
+	if !seen["id"] {
+		sort = append(sort, SortField{Field: "id"})
+	}
+	return sort, nil
+}
+
+// matchesQuery reports whether user passes the filters of q
+func matchesQuery(user *models.User, q UserQuery) bool {
+	if q.Username != "" && !strings.EqualFold(user.Username, q.Username) {
+		return false
+	}
+	if q.Email != "" && !strings.EqualFold(user.Email, q.Email) {
+		return false
+	}
+	if !q.CreatedAfter.IsZero() && !user.CreatedAt.After(q.CreatedAfter) {
+		return false
+	}
+	return true
+}
+
+// compareUsers orders a and b by the given sort fields
+func compareUsers(a, b *models.User, sort []SortField) int {
+	for _, f := range sort {
+		c := compareField(a, b, f.Field)
+		if f.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareField(a, b *models.User, field string) int {
+	switch field {
+	case "id":
+		switch {
+		case a.ID < b.ID:
+			return -1
+		case a.ID > b.ID:
+			return 1
+		}
+		return 0
+	case "created_at":
+		return a.CreatedAt.Compare(b.CreatedAt)
+	case "updated_at":
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	default:
+		return strings.Compare(fieldValue(a, field).(string), fieldValue(b, field).(string))
+	}
+}
+
+// fieldValue returns the value of a sortable field
+func fieldValue(user *models.User, field string) any {
+	switch field {
+	case "id":
+		return user.ID
+	case "username":
+		return user.Username
+	case "email":
+		return user.Email
+	case "first_name":
+		return user.FirstName
+	case "last_name":
+		return user.LastName
+	case "created_at":
+		return user.CreatedAt
+	case "updated_at":
+		return user.UpdatedAt
+	}
+	return nil
+}
+
+// cursor is the decoded form of UserPage.NextCursor. It records the sort it
+// was issued for so it cannot be replayed against a different ordering.
+type cursor struct {
+	Sort string      `json:"s"`
+	Last models.User `json:"l"`
+}
+
+func sortKey(sort []SortField) string {
+	parts := make([]string, len(sort))
+	for i, f := range sort {
+		parts[i] = f.Field
+		if f.Desc {
+			parts[i] = "-" + f.Field
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// encodeCursor captures the sort values of the last user on a page
+func encodeCursor(last *models.User, sort []SortField) string {
+	c := cursor{Sort: sortKey(sort)}
+	c.Last.ID = last.ID
+	for _, f := range sort {
+		switch f.Field {
+		case "username":
+			c.Last.Username = last.Username
+		case "email":
+			c.Last.Email = last.Email
+		case "first_name":
+			c.Last.FirstName = last.FirstName
+		case "last_name":
+			c.Last.LastName = last.LastName
+		case "created_at":
+			c.Last.CreatedAt = last.CreatedAt
+		case "updated_at":
+			c.Last.UpdatedAt = last.UpdatedAt
+		}
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor returns the position a page continues after
+func decodeCursor(s string, sort []SortField) (*models.User, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	if c.Sort != sortKey(sort) {
+		return nil, fmt.Errorf("%w: cursor was issued for a different sort", ErrInvalidQuery)
+	}
+	return &c.Last, nil
+}
@@ -1,133 +1,481 @@
 package repositories
 
 import (
+	"cmp"
 	"context"
 	"errors"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/rizqishq/Go-REST/models"
 )
 
 // Respository errors
 var (
-	ErrNotFound = errors.New("record not found")
-	ErrConflict = errors.New("record already exists")
+	ErrNotFound     = errors.New("record not found")
+	ErrConflict     = errors.New("record already exists")
+	ErrStaleVersion = errors.New("record was modified by another write")
 )
 
-// UserRepository interface to abstract storage implementation
+// ConflictError reports which unique field a write collided on. It matches
+// ErrConflict; Field is empty if the store cannot tell.
+type ConflictError struct {
+	Field string
+}
+
+func (e *ConflictError) Error() string {
+	if e.Field == "" {
+		return ErrConflict.Error()
+	}
+	return e.Field + " already exists"
+}
+
+func (e *ConflictError) Unwrap() error { return ErrConflict }
+
+// Pinger is implemented by repositories that depend on something outside the
+// process, such as a database or a data directory. Ping reports whether it is
+// still usable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// UserRepository interface to abstract storage implementation. Usernames and
+// emails are unique ignoring case, and FindByUsername/FindByEmail match them
+// the same way; a write that breaks this returns a *ConflictError.
+//
+// Create sets the ID and Version (1) of the new user. Update only succeeds if
+// user.Version still equals the stored version, which it then increments in
+// both the store and user; otherwise it returns ErrStaleVersion.
+//
+// Delete only soft-deletes a user by setting DeletedAt. Soft-deleted users are
+// left out of FindAll, Query and the Find methods and cannot be updated, but
+// their username and email stay reserved so they can always be restored.
+// FindDeleted and FindDeletedByID only return soft-deleted users.
+// Purge removes them for good and returns their IDs in ascending order.
+// Delete and Restore increment the version.
 type UserRepository interface {
 	FindAll(ctx context.Context) ([]models.User, error)
+	Query(ctx context.Context, q UserQuery) (*UserPage, error)
 	FindByID(ctx context.Context, id uint) (*models.User, error)
 	FindByUsername(ctx context.Context, username string) (*models.User, error)
 	FindByEmail(ctx context.Context, email string) (*models.User, error)
 	Create(ctx context.Context, user *models.User) error
 	Update(ctx context.Context, user *models.User) error
-	Delete(ctx context.Context, id uint) error
+	Delete(ctx context.Context, id uint, deletedAt time.Time) error
+	FindDeleted(ctx context.Context) ([]models.User, error)
+	FindDeletedByID(ctx context.Context, id uint) (*models.User, error)
+	Restore(ctx context.Context, id uint) error
+	Purge(ctx context.Context, deletedBefore time.Time) ([]uint, error)
 }
 
-// InMemoryUserRepository implements UserRepository in memory
+// InMemoryUserRepository implements UserRepository in memory. Usernames and
+// emails are indexed by their lowercase form, which also enforces uniqueness.
+// Users are copied on the way in and out, so callers never share memory with
+// the stored records. Every method fails with ctx.Err() once ctx is done.
+// Writes made within an InMemoryTransactor transaction are undone when it
+// fails.
 type InMemoryUserRepository struct {
-	users  map[uint]*models.User
-	mutex  sync.RWMutex
-	nextID uint
+	users      map[uint]*models.User
+	byUsername map[string]uint
+	byEmail    map[string]uint
+	mutex      sync.RWMutex
+	nextID     uint
 }
 
 // Create new empty repository
 func NewInMemoryUserRepository() *InMemoryUserRepository {
 	return &InMemoryUserRepository{
-		users:  make(map[uint]*models.User),
-		nextID: 1,
+		users:      make(map[uint]*models.User),
+		byUsername: make(map[string]uint),
+		byEmail:    make(map[string]uint),
+		nextID:     1,
+	}
+}
+
+// cloneUser returns a deep copy of user
+func cloneUser(user *models.User) *models.User {
+	clone := *user
+	clone.Permissions = slices.Clone(user.Permissions)
+	if user.DeletedAt != nil {
+		deletedAt := *user.DeletedAt
+		clone.DeletedAt = &deletedAt
 	}
+	return &clone
+}
+
+// indexKey normalizes a username or email for the unique indexes
+func indexKey(s string) string {
+	return strings.ToLower(s)
 }
 
 func (r *InMemoryUserRepository) FindAll(ctx context.Context) ([]models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
 	users := make([]models.User, 0, len(r.users))
 	for _, user := range r.users {
-		users = append(users, *user)
+		if user.DeletedAt == nil {
+			users = append(users, *cloneUser(user))
+		}
 	}
+	sortByID(users)
 	return users, nil
 }
 
+func (r *InMemoryUserRepository) Query(ctx context.Context, q UserQuery) (*UserPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort, err := normalizedSort(q.Sort)
+	if err != nil {
+		return nil, err
+	}
+	var after *models.User
+	if q.Cursor != "" {
+		if after, err = decodeCursor(q.Cursor, sort); err != nil {
+			return nil, err
+		}
+	}
+
+	r.mutex.RLock()
+	matches := make([]models.User, 0)
+	for _, user := range r.users {
+		if user.DeletedAt == nil && matchesQuery(user, q) {
+			matches = append(matches, *cloneUser(user))
+		}
+	}
+	r.mutex.RUnlock()
+
+	slices.SortFunc(matches, func(a, b models.User) int {
+		return compareUsers(&a, &b, sort)
+	})
+
+	page := &UserPage{Total: len(matches)}
+	rest := matches
+	if after != nil {
+		start, _ := slices.BinarySearchFunc(matches, after, func(u models.User, key *models.User) int {
+			if compareUsers(&u, key, sort) <= 0 {
+				return -1
+			}
+			return 1
+		})
+		rest = matches[start:]
+	}
+	if q.Limit > 0 && len(rest) > q.Limit {
+		rest = rest[:q.Limit]
+		page.NextCursor = encodeCursor(&rest[len(rest)-1], sort)
+	}
+	page.Users = rest
+	return page, nil
+}
+
 func (r *InMemoryUserRepository) FindByID(ctx context.Context, id uint) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
 	user, ok := r.users[id]
-	if !ok {
+	if !ok || user.DeletedAt != nil {
 		return nil, ErrNotFound
 	}
-	return user, nil
+	return cloneUser(user), nil
 }
 
 func (r *InMemoryUserRepository) FindByUsername(ctx context.Context, username string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
-	for _, u := range r.users {
-		if u.Username == username {
-			return u, nil
-		}
+
+	id, ok := r.byUsername[indexKey(username)]
+	if !ok || r.users[id].DeletedAt != nil {
+		return nil, ErrNotFound
 	}
-	return nil, ErrNotFound
+	return cloneUser(r.users[id]), nil
 }
 
 func (r *InMemoryUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
-	for _, u := range r.users {
-		if u.Email == email {
-			return u, nil
-		}
+
+	id, ok := r.byEmail[indexKey(email)]
+	if !ok || r.users[id].DeletedAt != nil {
+		return nil, ErrNotFound
 	}
-	return nil, ErrNotFound
+	return cloneUser(r.users[id]), nil
 }
 
 func (r *InMemoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	for _, existing := range r.users {
-		if existing.Username == user.Username || existing.Email == user.Email {
-			return ErrConflict
-		}
+	if err := r.checkUnique(user, 0); err != nil {
+		return err
 	}
 
 	user.ID = r.nextID
+	user.Version = 1
+	user.DeletedAt = nil
 	r.nextID++
-	r.users[user.ID] = user
+	r.store(cloneUser(user))
+
+	id := user.ID
+	onRollback(ctx, func() { r.remove(id) })
 	return nil
 }
 
 func (r *InMemoryUserRepository) Update(ctx context.Context, user *models.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	if _, ok := r.users[user.ID]; !ok {
+	current, ok := r.users[user.ID]
+	if !ok || current.DeletedAt != nil {
 		return ErrNotFound
 	}
+	if current.Version != user.Version {
+		return ErrStaleVersion
+	}
+	if err := r.checkUnique(user, user.ID); err != nil {
+		return err
+	}
 
-	for id, existing := range r.users {
-		if id == user.ID {
-			continue
-		}
-		if existing.Username == user.Username || existing.Email == user.Email {
-			return ErrConflict
-		}
+	user.Version++
+	user.DeletedAt = nil
+	r.store(cloneUser(user))
+
+	version := user.Version
+	onRollback(ctx, func() { r.revert(current, version) })
+	return nil
+}
+
+func (r *InMemoryUserRepository) Delete(ctx context.Context, id uint, deletedAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	r.users[user.ID] = user
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return ErrNotFound
+	}
+	prev := cloneUser(user)
+	user.DeletedAt = &deletedAt
+	user.Version++
+
+	version := user.Version
+	onRollback(ctx, func() { r.revert(prev, version) })
 	return nil
 }
 
-func (r *InMemoryUserRepository) Delete(ctx context.Context, id uint) error {
+func (r *InMemoryUserRepository) FindDeleted(ctx context.Context) ([]models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	users := make([]models.User, 0)
+	for _, user := range r.users {
+		if user.DeletedAt != nil {
+			users = append(users, *cloneUser(user))
+		}
+	}
+	sortByID(users)
+	return users, nil
+}
+
+func (r *InMemoryUserRepository) FindDeletedByID(ctx context.Context, id uint) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt == nil {
+		return nil, ErrNotFound
+	}
+	return cloneUser(user), nil
+}
+
+func (r *InMemoryUserRepository) Restore(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	if _, ok := r.users[id]; !ok {
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt == nil {
 		return ErrNotFound
 	}
-	delete(r.users, id)
+	prev := cloneUser(user)
+	user.DeletedAt = nil
+	user.Version++
+
+	version := user.Version
+	onRollback(ctx, func() { r.revert(prev, version) })
 	return nil
 }
+
+func (r *InMemoryUserRepository) Purge(ctx context.Context, deletedBefore time.Time) ([]uint, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var ids []uint
+	for id, user := range r.users {
+		if purgeable(user, deletedBefore) {
+			r.unstore(id)
+			ids = append(ids, id)
+			onRollback(ctx, func() { r.put(user) })
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// purgeable reports whether user was soft-deleted no later than deletedBefore
+func purgeable(user *models.User, deletedBefore time.Time) bool {
+	return user.DeletedAt != nil && !user.DeletedAt.After(deletedBefore)
+}
+
+// sortByID orders users by ascending ID
+func sortByID(users []models.User) {
+	slices.SortFunc(users, func(a, b models.User) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+}
+
+// checkUnique reports a username or email taken by a user other than self.
+// Callers must hold r.mutex.
+func (r *InMemoryUserRepository) checkUnique(user *models.User, self uint) error {
+	if id, ok := r.byUsername[indexKey(user.Username)]; ok && id != self {
+		return &ConflictError{Field: "username"}
+	}
+	if id, ok := r.byEmail[indexKey(user.Email)]; ok && id != self {
+		return &ConflictError{Field: "email"}
+	}
+	return nil
+}
+
+// store saves user and indexes it, replacing any user with the same ID.
+// Callers must hold r.mutex.
+func (r *InMemoryUserRepository) store(user *models.User) {
+	r.unstore(user.ID)
+	r.users[user.ID] = user
+	r.byUsername[indexKey(user.Username)] = user.ID
+	r.byEmail[indexKey(user.Email)] = user.ID
+}
+
+// unstore removes a user and its index entries. Callers must hold r.mutex.
+func (r *InMemoryUserRepository) unstore(id uint) {
+	user, ok := r.users[id]
+	if !ok {
+		return
+	}
+	delete(r.users, id)
+	if r.byUsername[indexKey(user.Username)] == id {
+		delete(r.byUsername, indexKey(user.Username))
+	}
+	if r.byEmail[indexKey(user.Email)] == id {
+		delete(r.byEmail, indexKey(user.Email))
+	}
+}
+
+// put stores user as-is, keeping nextID ahead of every known ID.
+func (r *InMemoryUserRepository) put(user *models.User) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.store(user)
+	if user.ID >= r.nextID {
+		r.nextID = user.ID + 1
+	}
+}
+
+// revert puts back prev, the user before a write that stored it at version.
+// If the user has been written again since, e.g. outside of the transaction
+// being rolled back, that later write is kept.
+func (r *InMemoryUserRepository) revert(prev *models.User, version uint64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if current, ok := r.users[prev.ID]; ok && current.Version == version {
+		r.store(prev)
+	}
+}
+
+// get returns a copy of a user whether or not it is soft-deleted.
+func (r *InMemoryUserRepository) get(id uint) (*models.User, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, false
+	}
+	return cloneUser(user), true
+}
+
+// remove deletes a user without reporting whether it existed.
+func (r *InMemoryUserRepository) remove(id uint) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.unstore(id)
+}
+
+// state returns a copy of every stored user together with the next ID.
+func (r *InMemoryUserRepository) state() ([]models.User, uint) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	users := make([]models.User, 0, len(r.users))
+	for _, user := range r.users {
+		users = append(users, *cloneUser(user))
+	}
+	return users, r.nextID
+}
+
+// setNextID restores the ID sequence, e.g. from a snapshot.
+func (r *InMemoryUserRepository) setNextID(id uint) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if id > r.nextID {
+		r.nextID = id
+	}
+}
@@ -0,0 +1,106 @@
+package repositories_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rizqishq/Go-REST/models"
+	"github.com/rizqishq/Go-REST/repositories"
+	"github.com/rizqishq/Go-REST/repositories/repotest"
+)
+
+func newInMemoryRepository(t *testing.T) repositories.UserRepository {
+	return repositories.NewInMemoryUserRepository()
+}
+
+func TestInMemoryUserRepositoryStress(t *testing.T) {
+	repotest.StressUserRepository(t, newInMemoryRepository)
+}
+
+func TestInMemoryUserRepository(t *testing.T) {
+	repotest.TestUserRepository(t, newInMemoryRepository)
+}
+
+func TestInMemoryAuditRepository(t *testing.T) {
+	repotest.TestAuditRepository(t, func(t *testing.T) repotest.Store {
+		return repotest.Store{
+			Users: repositories.NewInMemoryUserRepository(),
+			Audit: repositories.NewInMemoryAuditRepository(),
+			Tx:    repositories.NewInMemoryTransactor(),
+		}
+	})
+}
+
+func TestInMemoryRollbackKeepsLaterWrites(t *testing.T) {
+	rename := func(ctx context.Context, repo repositories.UserRepository, id uint, name string) error {
+		user, err := repo.FindByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		user.FirstName = name
+		return repo.Update(ctx, user)
+	}
+	tests := []struct {
+		name    string
+		deleted bool
+		// inTx is rolled back after outside wrote to the same user
+		inTx, outside func(ctx context.Context, repo repositories.UserRepository, id uint) error
+		firstName     string
+		version       uint64
+	}{
+		{"update", false, func(ctx context.Context, repo repositories.UserRepository, id uint) error {
+			return rename(ctx, repo, id, "InTx")
+		}, func(ctx context.Context, repo repositories.UserRepository, id uint) error {
+			return rename(ctx, repo, id, "Outside")
+		}, "Outside", 3},
+		{"delete", false, func(ctx context.Context, repo repositories.UserRepository, id uint) error {
+			return repo.Delete(ctx, id, time.Now())
+		}, func(ctx context.Context, repo repositories.UserRepository, id uint) error {
+			return repo.Restore(ctx, id)
+		}, "First", 3},
+		{"restore", true, func(ctx context.Context, repo repositories.UserRepository, id uint) error {
+			return repo.Restore(ctx, id)
+		}, func(ctx context.Context, repo repositories.UserRepository, id uint) error {
+			return rename(ctx, repo, id, "Outside")
+		}, "Outside", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := repositories.NewInMemoryUserRepository()
+			user := &models.User{Username: "john", Email: "john@example.com", FirstName: "First"}
+			if err := repo.Create(ctx, user); err != nil {
+				t.Fatal(err)
+			}
+			if tt.deleted {
+				if err := repo.Delete(ctx, user.ID, time.Now()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			rollback := errors.New("rollback")
+			err := repositories.NewInMemoryTransactor().WithinTransaction(ctx, func(txCtx context.Context) error {
+				if err := tt.inTx(txCtx, repo, user.ID); err != nil {
+					t.Fatal(err)
+				}
+				if err := tt.outside(ctx, repo, user.ID); err != nil {
+					t.Fatal(err)
+				}
+				return rollback
+			})
+			if !errors.Is(err, rollback) {
+				t.Fatalf("WithinTransaction() = %v", err)
+			}
+
+			got, err := repo.FindByID(ctx, user.ID)
+			if err != nil {
+				t.Fatalf("user after rollback: %v", err)
+			}
+			if got.FirstName != tt.firstName || got.Version != tt.version {
+				t.Errorf("user after rollback = %+v, want the write made outside the transaction", got)
+			}
+		})
+	}
+}
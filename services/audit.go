@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/rizqishq/Go-REST/models"
+	"github.com/rizqishq/Go-REST/repositories"
+	"github.com/rizqishq/Go-REST/tracing"
+)
+
+// Actor names recorded for changes that no signed-in user made
+const (
+	ActorAnonymous = "anonymous"
+	ActorSystem    = "system"
+)
+
+// AuditInfo describes who makes the changes of a request
+type AuditInfo struct {
+	// ActorID is the signed-in user, or 0
+	ActorID   uint
+	Actor     string
+	RequestID string
+}
+
+type auditInfoKey struct{}
+
+// WithAuditInfo returns a context whose user changes are attributed to info
+func WithAuditInfo(ctx context.Context, info AuditInfo) context.Context {
+	return context.WithValue(ctx, auditInfoKey{}, info)
+}
+
+// auditInfoFrom returns the AuditInfo of ctx, or an anonymous actor
+func auditInfoFrom(ctx context.Context) AuditInfo {
+	info, _ := ctx.Value(auditInfoKey{}).(AuditInfo)
+	if info.Actor == "" {
+		info.Actor = ActorAnonymous
+	}
+	return info
+}
+
+// newAuditEntry builds the entry for an action on a user by the actor of ctx
+func newAuditEntry(ctx context.Context, action models.AuditAction, userID uint, changes []models.FieldChange) *models.AuditEntry {
+	info := auditInfoFrom(ctx)
+	return &models.AuditEntry{
+		ActorID:   info.ActorID,
+		Actor:     info.Actor,
+		Action:    action,
+		UserID:    userID,
+		Changes:   changes,
+		RequestID: info.RequestID,
+		CreatedAt: time.Now(),
+	}
+}
+
+// auditedFields are the user fields compared by userChanges, in the order
+// they are reported
+var auditedFields = []string{"username", "email", "first_name", "last_name", "role", "permissions", "deleted_at"}
+
+// userChanges lists the fields that differ between before and after. A nil
+// before stands for a user that did not exist yet. Password hashes are never
+// recorded; a changed one is reported as a redacted change.
+func userChanges(before, after *models.User) []models.FieldChange {
+	old := userFields(before)
+	updated := userFields(after)
+
+	var changes []models.FieldChange
+	for _, field := range auditedFields {
+		if string(old[field]) == string(updated[field]) {
+			continue
+		}
+		changes = append(changes, models.FieldChange{Field: field, Old: old[field], New: updated[field]})
+	}
+	if before == nil || before.Password != after.Password {
+		changes = append(changes, models.FieldChange{Field: "password", Redacted: true})
+	}
+	return changes
+}
+
+// userFields returns the JSON value of every non-empty audited field of user
+func userFields(user *models.User) map[string]json.RawMessage {
+	fields := make(map[string]json.RawMessage)
+	if user == nil {
+		return fields
+	}
+	data, err := json.Marshal(user)
+	if err != nil {
+		return fields
+	}
+	json.Unmarshal(data, &fields)
+	for field, value := range fields {
+		switch string(value) {
+		case `""`, "null", "[]":
+			delete(fields, field)
+		}
+	}
+	return fields
+}
+
+// jsonValue encodes v for a FieldChange
+func jsonValue(v any) json.RawMessage {
+	data, _ := json.Marshal(v)
+	return data
+}
+
+// AuditService gives read access to the audit log
+type AuditService struct {
+	auditRepo repositories.AuditRepository
+}
+
+// Create new AuditService
+func NewAuditService(auditRepo repositories.AuditRepository) *AuditService {
+	return &AuditService{auditRepo: auditRepo}
+}
+
+// ListEntries returns the audit entries matching q in the order they were
+// recorded
+func (s *AuditService) ListEntries(ctx context.Context, q repositories.AuditQuery) (_ *models.AuditListResponse, err error) {
+	ctx, span := tracing.Start(ctx, "AuditService.ListEntries")
+	defer span.EndWithError(&err)
+
+	entries, err := s.auditRepo.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return &models.AuditListResponse{Data: entries}, nil
+}
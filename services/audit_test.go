@@ -0,0 +1,85 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rizqishq/Go-REST/models"
+	"github.com/rizqishq/Go-REST/repositories"
+	"github.com/rizqishq/Go-REST/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUpdateAuditChanges(t *testing.T) {
+	unchanged := models.UpdateUserRequest{Username: "john", Email: "john@example.com", FirstName: "First", LastName: "Last"}
+	tests := []struct {
+		name   string
+		change func(*models.UpdateUserRequest)
+		want   []models.FieldChange
+	}{
+		{"nothing", func(r *models.UpdateUserRequest) {}, nil},
+		{"name set and cleared", func(r *models.UpdateUserRequest) { r.FirstName, r.LastName = "Changed", "" }, []models.FieldChange{
+			{Field: "first_name", Old: json.RawMessage(`"First"`), New: json.RawMessage(`"Changed"`)},
+			{Field: "last_name", Old: json.RawMessage(`"Last"`)},
+		}},
+		{"email case", func(r *models.UpdateUserRequest) { r.Email = "John@example.com" }, []models.FieldChange{
+			{Field: "email", Old: json.RawMessage(`"john@example.com"`), New: json.RawMessage(`"John@example.com"`)},
+		}},
+		{"password", func(r *models.UpdateUserRequest) { r.Password = "password2" }, []models.FieldChange{
+			{Field: "password", Redacted: true},
+		}},
+		{"password and username", func(r *models.UpdateUserRequest) { r.Username, r.Password = "johnny", "password2" }, []models.FieldChange{
+			{Field: "username", Old: json.RawMessage(`"john"`), New: json.RawMessage(`"johnny"`)},
+			{Field: "password", Redacted: true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := repositories.NewInMemoryUserRepository()
+			audit := repositories.NewInMemoryAuditRepository()
+			users := newUserServiceOn(t, repo, audit, utils.NewBcryptHasher(bcrypt.MinCost))
+			john, err := users.CreateUser(ctx, models.CreateUserRequest{Username: "john", Email: "john@example.com", Password: "password1", FirstName: "First", LastName: "Last"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := unchanged
+			tt.change(&req)
+			if _, err := users.UpdateUser(ctx, john.ID, req, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := audit.Query(ctx, repositories.AuditQuery{Action: models.AuditUpdate})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("got %d update entries, want 1", len(entries))
+			}
+			if !reflect.DeepEqual(entries[0].Changes, tt.want) {
+				t.Errorf("changes = %s, want %s", jsonString(entries[0].Changes), jsonString(tt.want))
+			}
+
+			stored, err := repo.FindByID(ctx, john.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			all, err := audit.Query(ctx, repositories.AuditQuery{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data := jsonString(all); strings.Contains(data, "$2a$") || strings.Contains(data, stored.Password) {
+				t.Errorf("audit log contains a password hash: %s", data)
+			}
+		})
+	}
+}
+
+func jsonString(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rizqishq/Go-REST/config"
+	"github.com/rizqishq/Go-REST/models"
+	"github.com/rizqishq/Go-REST/repositories"
+	"github.com/rizqishq/Go-REST/tracing"
+	"github.com/rizqishq/Go-REST/utils"
+)
+
+// minSecretLength is the HMAC key size recommended for HS256
+const minSecretLength = 32
+
+// AuthService issues and validates access and refresh tokens
+type AuthService struct {
+	users      *UserService
+	tokenRepo  repositories.RefreshTokenRepository
+	secret     []byte
+	issuer     string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	now        func() time.Time
+}
+
+// Create new AuthService. The secret must be at least 32 bytes.
+func NewAuthService(users *UserService, tokenRepo repositories.RefreshTokenRepository, cfg config.AuthConfig) (*AuthService, error) {
+	if len(cfg.JWTSecret) < minSecretLength {
+		return nil, fmt.Errorf("JWT secret must be at least %d bytes", minSecretLength)
+	}
+	return &AuthService{
+		users:      users,
+		tokenRepo:  tokenRepo,
+		secret:     []byte(cfg.JWTSecret),
+		issuer:     cfg.Issuer,
+		accessTTL:  cfg.AccessTokenTTL,
+		refreshTTL: cfg.RefreshTokenTTL,
+		now:        time.Now,
+	}, nil
+}
+
+// Login verifies credentials and starts a new token family
+func (s *AuthService) Login(ctx context.Context, req models.LoginRequest) (_ *models.TokenResponse, err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Login")
+	defer span.EndWithError(&err)
+
+	user, err := s.users.Authenticate(ctx, req.Username, req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	family, err := utils.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	return s.issueTokens(ctx, user.ID, family)
+}
+
+// Refresh exchanges a refresh token for a new token pair. Each refresh token
+// can be used once; presenting a used token again is treated as theft and
+// revokes every token descended from the same login.
+func (s *AuthService) Refresh(ctx context.Context, req models.RefreshRequest) (_ *models.TokenResponse, err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Refresh")
+	defer span.EndWithError(&err)
+
+	token, err := s.tokenRepo.FindByHash(ctx, utils.HashToken(req.RefreshToken))
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if token.Revoked {
+		if err := s.tokenRepo.RevokeFamily(ctx, token.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidToken
+	}
+	if !s.now().Before(token.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	if err := s.tokenRepo.Revoke(ctx, token.TokenHash); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			// Lost a race with a concurrent refresh of the same token
+			if err := s.tokenRepo.RevokeFamily(ctx, token.FamilyID); err != nil {
+				return nil, err
+			}
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	if _, err := s.users.FindUser(ctx, token.UserID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	return s.issueTokens(ctx, token.UserID, token.FamilyID)
+}
+
+// Logout revokes the session the refresh token belongs to. Unknown tokens are
+// ignored so logout is idempotent.
+func (s *AuthService) Logout(ctx context.Context, req models.RefreshRequest) (err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Logout")
+	defer span.EndWithError(&err)
+
+	token, err := s.tokenRepo.FindByHash(ctx, utils.HashToken(req.RefreshToken))
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.tokenRepo.RevokeFamily(ctx, token.FamilyID)
+}
+
+// VerifyAccessToken validates a bearer token and loads the user it was issued to
+func (s *AuthService) VerifyAccessToken(ctx context.Context, token string) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.VerifyAccessToken")
+	defer span.EndWithError(&err)
+
+	claims, err := utils.ParseJWT(token, s.secret, s.now())
+	if err != nil || claims.Issuer != s.issuer {
+		return nil, ErrInvalidToken
+	}
+	id, err := strconv.ParseUint(claims.Subject, 10, 32)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := s.users.FindUser(ctx, uint(id))
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *AuthService) issueTokens(ctx context.Context, userID uint, family string) (*models.TokenResponse, error) {
+	now := s.now()
+
+	jti, err := utils.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	access, err := utils.SignJWT(utils.TokenClaims{
+		Subject:   strconv.FormatUint(uint64(userID), 10),
+		Issuer:    s.issuer,
+		ID:        jti,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(s.accessTTL).Unix(),
+	}, s.secret)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	err = s.tokenRepo.Create(ctx, &models.RefreshToken{
+		TokenHash: utils.HashToken(refresh),
+		UserID:    userID,
+		FamilyID:  family,
+		ExpiresAt: now.Add(s.refreshTTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenResponse{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.accessTTL.Seconds()),
+		RefreshToken: refresh,
+	}, nil
+}
@@ -0,0 +1,253 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rizqishq/Go-REST/config"
+	"github.com/rizqishq/Go-REST/models"
+	"github.com/rizqishq/Go-REST/repositories"
+	"github.com/rizqishq/Go-REST/services"
+	"github.com/rizqishq/Go-REST/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var authConfig = config.AuthConfig{
+	JWTSecret:       "0123456789abcdef0123456789abcdef",
+	Issuer:          "go-rest",
+	AccessTokenTTL:  15 * time.Minute,
+	RefreshTokenTTL: 24 * time.Hour,
+}
+
+// newAuthService returns an AuthService with user "john", password "password1"
+func newAuthService(t *testing.T) (*services.AuthService, *repositories.InMemoryRefreshTokenRepository, *models.User) {
+	t.Helper()
+	users, repo := newUserService(t, utils.NewBcryptHasher(bcrypt.MinCost))
+	tokens := repositories.NewInMemoryRefreshTokenRepository()
+	auth, err := services.NewAuthService(users, tokens, authConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := users.CreateUser(context.Background(), models.CreateUserRequest{
+		Username: "john", Email: "john@example.com", Password: "password1", FirstName: "John",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	user, err := repo.FindByUsername(context.Background(), "john")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth, tokens, user
+}
+
+func login(t *testing.T, auth *services.AuthService) *models.TokenResponse {
+	t.Helper()
+	resp, err := auth.Login(context.Background(), models.LoginRequest{Username: "john", Password: "password1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func refresh(auth *services.AuthService, token string) (*models.TokenResponse, error) {
+	return auth.Refresh(context.Background(), models.RefreshRequest{RefreshToken: token})
+}
+
+func TestNewAuthServiceRejectsShortSecret(t *testing.T) {
+	cfg := authConfig
+	cfg.JWTSecret = "too short"
+	if _, err := services.NewAuthService(nil, nil, cfg); err == nil {
+		t.Error("NewAuthService accepted a 9 byte secret")
+	}
+}
+
+func TestLogin(t *testing.T) {
+	ctx := context.Background()
+	auth, _, john := newAuthService(t)
+
+	resp := login(t, auth)
+	if resp.TokenType != "Bearer" || resp.ExpiresIn != 900 || resp.RefreshToken == "" {
+		t.Errorf("response = %+v", resp)
+	}
+	user, err := auth.VerifyAccessToken(ctx, resp.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != john.ID {
+		t.Errorf("access token is for user %d, want %d", user.ID, john.ID)
+	}
+
+	for _, req := range []models.LoginRequest{
+		{Username: "john", Password: "wrong password"},
+		{Username: "jane", Password: "password1"},
+	} {
+		if _, err := auth.Login(ctx, req); !errors.Is(err, services.ErrInvalidCredentials) {
+			t.Errorf("Login(%s, %s) error = %v, want ErrInvalidCredentials", req.Username, req.Password, err)
+		}
+	}
+}
+
+func TestVerifyAccessToken(t *testing.T) {
+	auth, _, john := newAuthService(t)
+	resp := login(t, auth)
+
+	sign := func(claims utils.TokenClaims, secret string) string {
+		token, err := utils.SignJWT(claims, []byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	now := time.Now()
+	valid := utils.TokenClaims{
+		Subject:   strconv.FormatUint(uint64(john.ID), 10),
+		Issuer:    authConfig.Issuer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Minute).Unix(),
+	}
+	with := func(change func(*utils.TokenClaims)) utils.TokenClaims {
+		claims := valid
+		change(&claims)
+		return claims
+	}
+
+	if _, err := auth.VerifyAccessToken(context.Background(), sign(valid, authConfig.JWTSecret)); err != nil {
+		t.Fatalf("valid token error = %v", err)
+	}
+	tests := []struct {
+		name, token string
+	}{
+		{"refresh token", resp.RefreshToken},
+		{"other secret", sign(valid, "abcdef0123456789abcdef0123456789")},
+		{"expired", sign(with(func(c *utils.TokenClaims) { c.ExpiresAt = now.Add(-time.Second).Unix() }), authConfig.JWTSecret)},
+		{"other issuer", sign(with(func(c *utils.TokenClaims) { c.Issuer = "someone-else" }), authConfig.JWTSecret)},
+		{"unknown user", sign(with(func(c *utils.TokenClaims) { c.Subject = "999" }), authConfig.JWTSecret)},
+		{"subject not an ID", sign(with(func(c *utils.TokenClaims) { c.Subject = "john" }), authConfig.JWTSecret)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := auth.VerifyAccessToken(context.Background(), tt.token); !errors.Is(err, services.ErrInvalidToken) {
+				t.Errorf("error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestRefreshRotatesTokens(t *testing.T) {
+	ctx := context.Background()
+	auth, tokens, john := newAuthService(t)
+	first := login(t, auth)
+
+	second, err := refresh(auth, first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == first.AccessToken {
+		t.Error("refresh returned the tokens it was given")
+	}
+	if user, err := auth.VerifyAccessToken(ctx, second.AccessToken); err != nil || user.ID != john.ID {
+		t.Errorf("refreshed access token = %v, %v; want user %d", user, err, john.ID)
+	}
+
+	old, _ := tokens.FindByHash(ctx, utils.HashToken(first.RefreshToken))
+	current, _ := tokens.FindByHash(ctx, utils.HashToken(second.RefreshToken))
+	if !old.Revoked || current.Revoked || current.FamilyID != old.FamilyID {
+		t.Errorf("old token = %+v, new token = %+v; want the old one revoked and both in one family", old, current)
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	auth, _, _ := newAuthService(t)
+	first := login(t, auth)
+	other := login(t, auth)
+
+	second, err := refresh(auth, first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := refresh(auth, second.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replaying a rotated token must end the session it came from
+	if _, err := refresh(auth, first.RefreshToken); !errors.Is(err, services.ErrInvalidToken) {
+		t.Fatalf("replayed token error = %v, want ErrInvalidToken", err)
+	}
+	if _, err := refresh(auth, third.RefreshToken); !errors.Is(err, services.ErrInvalidToken) {
+		t.Errorf("latest token of the family error = %v, want ErrInvalidToken", err)
+	}
+
+	// Other logins are separate families and keep working
+	if _, err := refresh(auth, other.RefreshToken); err != nil {
+		t.Errorf("token from another login error = %v", err)
+	}
+}
+
+func TestRefreshRejectsInvalidTokens(t *testing.T) {
+	ctx := context.Background()
+	auth, tokens, john := newAuthService(t)
+	resp := login(t, auth)
+
+	expired := "expired-refresh-token"
+	if err := tokens.Create(ctx, &models.RefreshToken{
+		TokenHash: utils.HashToken(expired),
+		UserID:    john.ID,
+		FamilyID:  "expired-family",
+		ExpiresAt: time.Now().Add(-time.Second),
+		CreatedAt: time.Now().Add(-time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, token string
+	}{
+		{"access token", resp.AccessToken},
+		{"unknown token", "not-a-refresh-token"},
+		{"empty", ""},
+		{"expired", expired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := refresh(auth, tt.token); !errors.Is(err, services.ErrInvalidToken) {
+				t.Errorf("error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+
+	if _, err := refresh(auth, resp.RefreshToken); err != nil {
+		t.Errorf("valid token error after rejected attempts = %v", err)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	ctx := context.Background()
+	auth, _, _ := newAuthService(t)
+	first := login(t, auth)
+	other := login(t, auth)
+
+	second, err := refresh(auth, first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Logging out with an already rotated token still ends the session
+	if err := auth.Logout(ctx, models.RefreshRequest{RefreshToken: first.RefreshToken}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := refresh(auth, second.RefreshToken); !errors.Is(err, services.ErrInvalidToken) {
+		t.Errorf("refresh after logout error = %v, want ErrInvalidToken", err)
+	}
+	if _, err := refresh(auth, other.RefreshToken); err != nil {
+		t.Errorf("token from another login error = %v", err)
+	}
+
+	if err := auth.Logout(ctx, models.RefreshRequest{RefreshToken: "unknown"}); err != nil {
+		t.Errorf("logout with an unknown token error = %v, want nil", err)
+	}
+}
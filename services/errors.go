@@ -0,0 +1,99 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rizqishq/Go-REST/repositories"
+)
+
+// Error categories returned by the services. Match them with errors.Is; the
+// concrete errors below carry the details.
+var (
+	ErrNotFound           error = &serviceError{msg: "user not found", cause: repositories.ErrNotFound}
+	ErrConflict                 = errors.New("conflict")
+	ErrValidation               = errors.New("validation failed")
+	ErrUnauthorized             = errors.New("unauthorized")
+	ErrPreconditionFailed       = errors.New("precondition failed")
+)
+
+// ErrVersionMismatch reports an update based on an outdated version of a user
+var ErrVersionMismatch error = &serviceError{msg: "user has been modified since it was read", cause: ErrPreconditionFailed}
+
+// Authentication errors, both matching ErrUnauthorized
+var (
+	ErrInvalidCredentials error = &serviceError{msg: "invalid username or password", cause: ErrUnauthorized}
+	ErrInvalidToken       error = &serviceError{msg: "invalid or expired token", cause: ErrUnauthorized}
+)
+
+// serviceError is a sentinel with a client-facing message that still matches
+// the error it refines
+type serviceError struct {
+	msg   string
+	cause error
+}
+
+func (e *serviceError) Error() string { return e.msg }
+func (e *serviceError) Unwrap() error { return e.cause }
+
+// ConflictError reports a unique field that is already taken by another user
+type ConflictError struct {
+	Field string
+}
+
+func (e *ConflictError) Error() string {
+	if e.Field == "" {
+		return "user already exists"
+	}
+	return e.Field + " already exists"
+}
+
+// Unwrap lets errors.Is match both ErrConflict and repositories.ErrConflict
+func (e *ConflictError) Unwrap() []error {
+	return []error{ErrConflict, repositories.ErrConflict}
+}
+
+// FieldError describes why one field of a request was rejected
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// ValidationError collects every problem found in a request
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		parts[i] = fmt.Sprintf("%s %s", f.Field, f.Message)
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+func (e *ValidationError) Unwrap() error { return ErrValidation }
+
+// newValidationError builds a ValidationError for a single field
+func newValidationError(field, message string) *ValidationError {
+	return &ValidationError{Fields: []FieldError{{Field: field, Message: message}}}
+}
+
+// mapRepoError translates repository errors into service errors
+func mapRepoError(err error) error {
+	var conflict *repositories.ConflictError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, repositories.ErrNotFound):
+		return ErrNotFound
+	case errors.As(err, &conflict):
+		return &ConflictError{Field: conflict.Field}
+	case errors.Is(err, repositories.ErrConflict):
+		return &ConflictError{}
+	case errors.Is(err, repositories.ErrStaleVersion):
+		return ErrVersionMismatch
+	}
+	return err
+}
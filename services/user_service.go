@@ -3,28 +3,54 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
 	"time"
 
 	"github.com/rizqishq/Go-REST/models"
 	"github.com/rizqishq/Go-REST/repositories"
+	"github.com/rizqishq/Go-REST/tracing"
 	"github.com/rizqishq/Go-REST/utils"
 )
 
+// UserService implements user management on top of a UserRepository. Its
+// methods stop with ctx.Err() once ctx is done, before any expensive work such
+// as password hashing. Every change is recorded in the audit log within the
+// same transaction, attributed to the actor set with WithAuditInfo.
 type UserService struct {
-	userRepo repositories.UserRepository
+	userRepo  repositories.UserRepository
+	auditRepo repositories.AuditRepository
+	tx        repositories.Transactor
+	hasher    utils.PasswordHasher
+	// dummyHash is verified for unknown usernames so that login takes the
+	// same time whether or not the account exists
+	dummyHash string
 }
 
-// Create new UserService
-func NewUserService(userRepo repositories.UserRepository) *UserService {
-	return &UserService{
-		userRepo: userRepo,
+// Create new UserService. It fails if hasher cannot hash the password
+// verified for unknown usernames.
+func NewUserService(userRepo repositories.UserRepository, auditRepo repositories.AuditRepository, tx repositories.Transactor, hasher utils.PasswordHasher) (*UserService, error) {
+	dummyHash, err := hasher.Hash("dummy password")
+	if err != nil {
+		return nil, fmt.Errorf("hash dummy password: %w", err)
 	}
+	return &UserService{
+		userRepo:  userRepo,
+		auditRepo: auditRepo,
+		tx:        tx,
+		hasher:    hasher,
+		dummyHash: dummyHash,
+	}, nil
 }
 
-func (s *UserService) GetAllUsers(ctx context.Context) ([]models.UserResponse, error) {
+func (s *UserService) GetAllUsers(ctx context.Context) (_ []models.UserResponse, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetAllUsers")
+	defer span.EndWithError(&err)
+
 	users, err := s.userRepo.FindAll(ctx)
 	if err != nil {
-		return nil, err
+		return nil, mapRepoError(err)
 	}
 
 	res := make([]models.UserResponse, len(users))
@@ -34,82 +60,436 @@ func (s *UserService) GetAllUsers(ctx context.Context) ([]models.UserResponse, e
 	return res, nil
 }
 
-func (s *UserService) GetUserByID(ctx context.Context, id uint) (*models.UserResponse, error) {
+func (s *UserService) ListUsers(ctx context.Context, q repositories.UserQuery) (_ *models.UserListResponse, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.ListUsers")
+	defer span.EndWithError(&err)
+
+	page, err := s.userRepo.Query(ctx, q)
+	if err != nil {
+		return nil, mapRepoError(err)
+	}
+
+	res := &models.UserListResponse{
+		Data:       make([]models.UserResponse, len(page.Users)),
+		Total:      page.Total,
+		NextCursor: page.NextCursor,
+	}
+	for i, user := range page.Users {
+		res.Data[i] = user.ToResponse()
+	}
+	return res, nil
+}
+
+func (s *UserService) GetUserByID(ctx context.Context, id uint) (_ *models.UserResponse, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUserByID")
+	defer span.EndWithError(&err)
+
 	user, err := s.userRepo.FindByID(ctx, id)
 	if err != nil {
-		return nil, err
+		return nil, mapRepoError(err)
 	}
 	result := user.ToResponse()
 	return &result, nil
 }
 
-func (s *UserService) CreateUser(ctx context.Context, req models.CreateUserRequest) (*models.UserResponse, error) {
-	if u, _ := s.userRepo.FindByUsername(ctx, req.Username); u != nil {
-		return nil, errors.New("username already exists")
+// FindUser returns the stored user with the given ID, including its role and
+// permissions, for services that act on behalf of users
+func (s *UserService) FindUser(ctx context.Context, id uint) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.FindUser")
+	defer span.EndWithError(&err)
+
+	user, err := s.userRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, mapRepoError(err)
+	}
+	return user, nil
+}
+
+// CreateUser registers a new user. A taken username or email, compared
+// ignoring case, is reported as a *ConflictError by the repository.
+func (s *UserService) CreateUser(ctx context.Context, req models.CreateUserRequest) (_ *models.UserResponse, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.CreateUser")
+	defer span.EndWithError(&err)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	if u, _ := s.userRepo.FindByEmail(ctx, req.Email); u != nil {
-		return nil, errors.New("email already exists")
+	hash, err := s.hasher.Hash(req.Password)
+	if err != nil {
+		return nil, err
 	}
 
 	now := time.Now()
 	user := &models.User{
 		Username:  req.Username,
 		Email:     req.Email,
-		Password:  utils.HashPassword(req.Password),
+		Password:  hash,
 		FirstName: req.FirstName,
 		LastName:  req.LastName,
+		Role:      models.RoleUser,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
 
-	if err := s.userRepo.Create(ctx, user); err != nil {
+	if err := s.createAudited(ctx, user); err != nil {
+		return nil, mapRepoError(err)
+	}
+	res := user.ToResponse()
+	return &res, nil
+}
+
+// maxUpdateAttempts bounds how often an unconditional update is retried when
+// a concurrent write to the same user wins the race
+const maxUpdateAttempts = 3
+
+// UpdateUser replaces the profile of a user with req. Empty names clear the
+// stored ones; the password is only changed when req.Password is set. If
+// versions is not empty the user must currently be at one of them, otherwise
+// ErrVersionMismatch is returned.
+func (s *UserService) UpdateUser(ctx context.Context, id uint, req models.UpdateUserRequest, versions []uint64) (_ *models.UserResponse, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateUser")
+	defer span.EndWithError(&err)
+
+	var hash string
+	if req.Password != "" {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var err error
+		if hash, err = s.hasher.Hash(req.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	user, err := s.modifyUser(ctx, id, versions, func(user *models.User) error {
+		applyUpdate(user, req, hash)
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 	res := user.ToResponse()
 	return &res, nil
 }
 
-func (s *UserService) UpdateUser(ctx context.Context, id uint, req models.UpdateUserRequest) (*models.UserResponse, error) {
-	user, err := s.userRepo.FindByID(ctx, id)
+// PatchUser updates a user like UpdateUser, with the request built by patch
+// from the user's current profile. patch is called again with fresh data if
+// the user changes concurrently, so it must not have side effects.
+func (s *UserService) PatchUser(ctx context.Context, id uint, versions []uint64, patch func(models.UpdateUserRequest) (models.UpdateUserRequest, error)) (_ *models.UserResponse, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.PatchUser")
+	defer span.EndWithError(&err)
+
+	user, err := s.modifyUser(ctx, id, versions, func(user *models.User) error {
+		req, err := patch(models.UpdateUserRequest{
+			Username:  user.Username,
+			Email:     user.Email,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+		})
+		if err != nil {
+			return err
+		}
+
+		var hash string
+		if req.Password != "" {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if hash, err = s.hasher.Hash(req.Password); err != nil {
+				return err
+			}
+		}
+		applyUpdate(user, req, hash)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	res := user.ToResponse()
+	return &res, nil
+}
+
+// applyUpdate copies req onto user; hash replaces the password when set.
+// Uniqueness is left to the repository's Update.
+func applyUpdate(user *models.User, req models.UpdateUserRequest, hash string) {
+	user.Username = req.Username
+	user.Email = req.Email
+	user.FirstName = req.FirstName
+	user.LastName = req.LastName
+	if hash != "" {
+		user.Password = hash
+	}
+}
 
-	if req.Username != "" && req.Username != user.Username {
-		if u, _ := s.userRepo.FindByUsername(ctx, req.Username); u != nil && u.ID != id {
-			return nil, errors.New("username already exists")
+// SetRole replaces the role and explicit permissions of a user
+func (s *UserService) SetRole(ctx context.Context, id uint, req models.UpdateRoleRequest) (_ *models.UserResponse, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.SetRole")
+	defer span.EndWithError(&err)
+
+	if !req.Role.Valid() {
+		return nil, newValidationError("role", fmt.Sprintf("unknown role %q", req.Role))
+	}
+	for _, p := range req.Permissions {
+		if !p.Valid() {
+			return nil, newValidationError("permissions", fmt.Sprintf("unknown permission %q", p))
 		}
 	}
-	if req.Email != "" && req.Email != user.Email {
-		if u, _ := s.userRepo.FindByEmail(ctx, req.Email); u != nil && u.ID != id {
-			return nil, errors.New("email already exists")
+
+	user, err := s.modifyUser(ctx, id, nil, func(user *models.User) error {
+		user.Role = req.Role
+		user.Permissions = req.Permissions
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := user.ToResponse()
+	return &res, nil
+}
+
+// modifyUser loads a user, applies change and writes the result back, which
+// the repository refuses if another write got in between. With versions
+// given the loaded user must be at one of them and a lost race is reported as
+// ErrVersionMismatch; without, the update is retried on a fresh copy.
+func (s *UserService) modifyUser(ctx context.Context, id uint, versions []uint64, change func(*models.User) error) (*models.User, error) {
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		user, err := s.userRepo.FindByID(ctx, id)
+		if err != nil {
+			return nil, mapRepoError(err)
+		}
+		if len(versions) > 0 && !slices.Contains(versions, user.Version) {
+			return nil, ErrVersionMismatch
+		}
+		before := *user
+		before.Permissions = slices.Clone(user.Permissions)
+		if err := change(user); err != nil {
+			return nil, err
+		}
+		user.UpdatedAt = time.Now()
+
+		err = s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+			if err := s.userRepo.Update(ctx, user); err != nil {
+				return err
+			}
+			return s.auditRepo.Create(ctx, newAuditEntry(ctx, models.AuditUpdate, id, userChanges(&before, user)))
+		})
+		if errors.Is(err, repositories.ErrStaleVersion) && len(versions) == 0 && attempt < maxUpdateAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, mapRepoError(err)
 		}
+		return user, nil
+	}
+}
+
+// EnsureAdmin creates an admin account with the given credentials unless a
+// user with that username already exists. It reports whether one was created.
+func (s *UserService) EnsureAdmin(ctx context.Context, username, email, password string) (_ bool, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.EnsureAdmin")
+	defer span.EndWithError(&err)
+
+	if email == "" || password == "" {
+		return false, errors.New("admin email and password are required")
 	}
 
-	if req.Username != "" {
-		user.Username = req.Username
+	_, err = s.userRepo.FindByUsername(ctx, username)
+	if err == nil {
+		return false, nil
 	}
-	if req.Email != "" {
-		user.Email = req.Email
+	if !errors.Is(err, repositories.ErrNotFound) {
+		return false, err
 	}
-	if req.Password != "" {
-		user.Password = utils.HashPassword(req.Password)
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	admin := &models.User{
+		Username:  username,
+		Email:     email,
+		Password:  hash,
+		Role:      models.RoleAdmin,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err = s.createAudited(WithAuditInfo(ctx, AuditInfo{Actor: ActorSystem}), admin)
+	var conflict *repositories.ConflictError
+	if errors.As(err, &conflict) && conflict.Field == "username" {
+		// The account exists but was soft-deleted; leave restoring it to an admin
+		return false, nil
 	}
-	if req.FirstName != "" {
-		user.FirstName = req.FirstName
+	if err != nil {
+		return false, mapRepoError(err)
+	}
+	return true, nil
+}
+
+// createAudited stores a new user together with its audit entry
+func (s *UserService) createAudited(ctx context.Context, user *models.User) error {
+	return s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.Create(ctx, user); err != nil {
+			return err
+		}
+		return s.auditRepo.Create(ctx, newAuditEntry(ctx, models.AuditCreate, user.ID, userChanges(nil, user)))
+	})
+}
+
+// Authenticate checks a username and password and returns the matching user.
+// Unknown users and wrong passwords both yield ErrInvalidCredentials. A hash
+// in a legacy or outdated format is replaced after a successful check; the
+// upgrade is not recorded in the audit log since no field visibly changes.
+func (s *UserService) Authenticate(ctx context.Context, username, password string) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.Authenticate")
+	defer span.EndWithError(&err)
+
+	user, err := s.userRepo.FindByUsername(ctx, username)
+	if errors.Is(err, repositories.ErrNotFound) {
+		s.hasher.Verify(s.dummyHash, password)
+		return nil, ErrInvalidCredentials
 	}
-	if req.LastName != "" {
-		user.LastName = req.LastName
+	if err != nil {
+		return nil, err
 	}
-	user.UpdatedAt = time.Now()
 
-	if err := s.userRepo.Update(ctx, user); err != nil {
+	ok, needsRehash := s.hasher.Verify(user.Password, password)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
-	res := user.ToResponse()
+	if needsRehash {
+		// Best effort: the old hash still verifies, so a failed upgrade is
+		// retried on the next login instead of failing this one
+		if hash, err := s.hasher.Hash(password); err == nil {
+			upgraded := *user
+			upgraded.Password = hash
+			if err := s.userRepo.Update(ctx, &upgraded); err == nil {
+				user = &upgraded
+			}
+		}
+	}
+	return user, nil
+}
+
+// DeleteUser soft-deletes a user. It can no longer sign in or be found, but
+// keeps its username and email until it is restored or purged.
+func (s *UserService) DeleteUser(ctx context.Context, id uint) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.DeleteUser")
+	defer span.EndWithError(&err)
+
+	err = s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		now := time.Now()
+		if err := s.userRepo.Delete(ctx, id, now); err != nil {
+			return err
+		}
+		changes := []models.FieldChange{{Field: "deleted_at", New: jsonValue(now)}}
+		return s.auditRepo.Create(ctx, newAuditEntry(ctx, models.AuditDelete, id, changes))
+	})
+	return mapRepoError(err)
+}
+
+// ListDeletedUsers returns every soft-deleted user as a single page
+func (s *UserService) ListDeletedUsers(ctx context.Context) (_ *models.UserListResponse, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.ListDeletedUsers")
+	defer span.EndWithError(&err)
+
+	users, err := s.userRepo.FindDeleted(ctx)
+	if err != nil {
+		return nil, mapRepoError(err)
+	}
+
+	res := &models.UserListResponse{
+		Data:  make([]models.UserResponse, len(users)),
+		Total: len(users),
+	}
+	for i, user := range users {
+		res.Data[i] = user.ToResponse()
+	}
+	return res, nil
+}
+
+// RestoreUser undoes the soft deletion of a user
+func (s *UserService) RestoreUser(ctx context.Context, id uint) (_ *models.UserResponse, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.RestoreUser")
+	defer span.EndWithError(&err)
+
+	var restored *models.User
+	err = s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		deleted, err := s.userRepo.FindDeletedByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := s.userRepo.Restore(ctx, id); err != nil {
+			return err
+		}
+		if restored, err = s.userRepo.FindByID(ctx, id); err != nil {
+			return err
+		}
+		changes := userChanges(deleted, restored)
+		return s.auditRepo.Create(ctx, newAuditEntry(ctx, models.AuditRestore, id, changes))
+	})
+	if err != nil {
+		return nil, mapRepoError(err)
+	}
+	res := restored.ToResponse()
 	return &res, nil
 }
 
-func (s *UserService) DeleteUser(ctx context.Context, id uint) error {
-	return s.userRepo.Delete(ctx, id)
+// PurgeDeletedUsers permanently removes users that were soft-deleted more
+// than retention ago and returns how many were removed
+func (s *UserService) PurgeDeletedUsers(ctx context.Context, retention time.Duration) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.PurgeDeletedUsers")
+	defer span.EndWithError(&err)
+
+	var purged []uint
+	err = s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if purged, err = s.userRepo.Purge(ctx, time.Now().Add(-retention)); err != nil {
+			return err
+		}
+		for _, id := range purged {
+			if err := s.auditRepo.Create(ctx, newAuditEntry(ctx, models.AuditPurge, id, nil)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, mapRepoError(err)
+	}
+	return len(purged), nil
+}
+
+// RunPurgeJob calls PurgeDeletedUsers right away and then every interval
+// until ctx is done
+func (s *UserService) RunPurgeJob(ctx context.Context, retention, interval time.Duration) {
+	ctx = WithAuditInfo(ctx, AuditInfo{Actor: ActorSystem})
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.PurgeDeletedUsers(ctx, retention)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			slog.ErrorContext(ctx, "Could not purge deleted users", "error", err)
+		case n > 0:
+			slog.InfoContext(ctx, "Purged deleted users", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
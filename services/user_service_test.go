@@ -0,0 +1,436 @@
+package services_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rizqishq/Go-REST/models"
+	"github.com/rizqishq/Go-REST/repositories"
+	"github.com/rizqishq/Go-REST/services"
+	"github.com/rizqishq/Go-REST/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newUserService(t *testing.T, hasher utils.PasswordHasher) (*services.UserService, repositories.UserRepository) {
+	t.Helper()
+	repo := repositories.NewInMemoryUserRepository()
+	return newUserServiceOn(t, repo, repositories.NewInMemoryAuditRepository(), hasher), repo
+}
+
+// newUserServiceOn returns a UserService on the given repositories
+func newUserServiceOn(t *testing.T, repo repositories.UserRepository, audit repositories.AuditRepository, hasher utils.PasswordHasher) *services.UserService {
+	t.Helper()
+	users, err := services.NewUserService(repo, audit, repositories.NewInMemoryTransactor(), hasher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return users
+}
+
+// brokenHasher fails every Hash call
+type brokenHasher struct {
+	utils.PasswordHasher
+}
+
+func (brokenHasher) Hash(password string) (string, error) {
+	return "", errors.New("out of memory")
+}
+
+func TestNewUserServiceReportsHashError(t *testing.T) {
+	users, err := services.NewUserService(repositories.NewInMemoryUserRepository(), repositories.NewInMemoryAuditRepository(), repositories.NewInMemoryTransactor(), brokenHasher{})
+	if err == nil || users != nil {
+		t.Errorf("NewUserService() = %v, %v; want an error", users, err)
+	}
+}
+
+func TestAuthenticateRehashesLegacyPasswords(t *testing.T) {
+	ctx := context.Background()
+	users, repo := newUserService(t, utils.NewBcryptHasher(bcrypt.MinCost))
+
+	sum := sha256.Sum256([]byte("password1"))
+	legacy := &models.User{Username: "john", Email: "john@example.com", Password: hex.EncodeToString(sum[:])}
+	if err := repo.Create(ctx, legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := users.Authenticate(ctx, "john", "wrong password"); !errors.Is(err, services.ErrInvalidCredentials) {
+		t.Fatalf("wrong password error = %v, want ErrInvalidCredentials", err)
+	}
+	stored, _ := repo.FindByID(ctx, legacy.ID)
+	if stored.Password != legacy.Password {
+		t.Fatal("a failed login replaced the hash")
+	}
+
+	user, err := users.Authenticate(ctx, "john", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, _ = repo.FindByID(ctx, legacy.ID)
+	if !strings.HasPrefix(stored.Password, "$2a$04$") || user.Password != stored.Password {
+		t.Errorf("stored hash = %q, returned %q; want both upgraded to bcrypt", stored.Password, user.Password)
+	}
+
+	if _, err := users.Authenticate(ctx, "john", "password1"); err != nil {
+		t.Errorf("login with the upgraded hash: %v", err)
+	}
+	if _, err := users.Authenticate(ctx, "nobody", "password1"); !errors.Is(err, services.ErrInvalidCredentials) {
+		t.Errorf("unknown user error = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestAuthenticateRehashesOnCostChange(t *testing.T) {
+	ctx := context.Background()
+	old := utils.NewBcryptHasher(bcrypt.MinCost)
+	users, repo := newUserService(t, utils.NewArgon2idHasher(utils.Argon2idParams{Time: 1, Memory: 64, Threads: 1, SaltLen: 16, KeyLen: 32}))
+
+	hash, _ := old.Hash("password1")
+	user := &models.User{Username: "jane", Email: "jane@example.com", Password: hash}
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.Authenticate(ctx, "jane", "password1"); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := repo.FindByID(ctx, user.ID)
+	if !strings.HasPrefix(stored.Password, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("stored hash = %q, want argon2id with the configured parameters", stored.Password)
+	}
+}
+
+func TestUserConflicts(t *testing.T) {
+	create := func(users *services.UserService, username, email string) error {
+		_, err := users.CreateUser(context.Background(), models.CreateUserRequest{Username: username, Email: email, Password: "password1"})
+		return err
+	}
+	update := func(users *services.UserService, username, email string) error {
+		_, err := users.UpdateUser(context.Background(), 2, models.UpdateUserRequest{Username: username, Email: email}, nil)
+		return err
+	}
+	tests := []struct {
+		name            string
+		write           func(users *services.UserService, username, email string) error
+		username, email string
+		field           string
+	}{
+		{"create with taken username", create, "John", "other@example.com", "username"},
+		{"create with taken email", create, "other", "John@Example.com", "email"},
+		{"update to taken username", update, "JOHN", "jane@example.com", "username"},
+		{"update to taken email", update, "jane", "JOHN@example.com", "email"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users, _ := newUserService(t, utils.NewBcryptHasher(bcrypt.MinCost))
+			for _, name := range []string{"john", "jane"} {
+				if err := create(users, name, name+"@example.com"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := tt.write(users, tt.username, tt.email)
+			var conflict *services.ConflictError
+			if !errors.As(err, &conflict) || conflict.Field != tt.field {
+				t.Fatalf("error = %v, want a ConflictError on %s", err, tt.field)
+			}
+			if !errors.Is(err, services.ErrConflict) || !errors.Is(err, repositories.ErrConflict) {
+				t.Errorf("error = %v, want it to match ErrConflict and repositories.ErrConflict", err)
+			}
+			if errors.Is(err, services.ErrNotFound) {
+				t.Errorf("error = %v matches ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestUpdateMissingUser(t *testing.T) {
+	users, _ := newUserService(t, utils.NewBcryptHasher(bcrypt.MinCost))
+	_, err := users.UpdateUser(context.Background(), 42, models.UpdateUserRequest{Username: "john", Email: "john@example.com"}, nil)
+	if !errors.Is(err, services.ErrNotFound) {
+		t.Errorf("error = %v, want ErrNotFound", err)
+	}
+	var conflict *services.ConflictError
+	if errors.As(err, &conflict) {
+		t.Errorf("error = %v is a ConflictError", err)
+	}
+}
+
+// racingUpdates lets another writer change the user just before each of the
+// first races calls to Update, so that they fail with ErrStaleVersion
+type racingUpdates struct {
+	repositories.UserRepository
+	races   int
+	updates int
+}
+
+func (r *racingUpdates) Update(ctx context.Context, user *models.User) error {
+	r.updates++
+	if r.races > 0 {
+		r.races--
+		other, err := r.UserRepository.FindByID(context.Background(), user.ID)
+		if err != nil {
+			return err
+		}
+		other.LastName = "Concurrent"
+		if err := r.UserRepository.Update(context.Background(), other); err != nil {
+			return err
+		}
+	}
+	return r.UserRepository.Update(ctx, user)
+}
+
+func TestUpdateUserRetriesLostRaces(t *testing.T) {
+	tests := []struct {
+		name     string
+		races    int
+		versions []uint64
+		updates  int
+		want     error
+	}{
+		{"no race", 0, nil, 1, nil},
+		{"wins on retry", 2, nil, 3, nil},
+		{"gives up", 3, nil, 3, services.ErrVersionMismatch},
+		{"no retry with If-Match", 1, []uint64{1}, 1, services.ErrVersionMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := &racingUpdates{UserRepository: repositories.NewInMemoryUserRepository()}
+			users := newUserServiceOn(t, repo, repositories.NewInMemoryAuditRepository(), utils.NewBcryptHasher(bcrypt.MinCost))
+			john, err := users.CreateUser(ctx, models.CreateUserRequest{Username: "john", Email: "john@example.com", Password: "password1", LastName: "Last"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			repo.races = tt.races
+			res, err := users.UpdateUser(ctx, john.ID, models.UpdateUserRequest{Username: "john", Email: "john@example.com", FirstName: "Changed", LastName: "Last"}, tt.versions)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+			if repo.updates != tt.updates {
+				t.Errorf("Update called %d times, want %d", repo.updates, tt.updates)
+			}
+			if tt.want != nil {
+				return
+			}
+			// Each retry starts over from the concurrent write it lost to
+			if want := uint64(tt.races + 2); res.Version != want || res.FirstName != "Changed" {
+				t.Errorf("updated user = %+v, want version %d", res, want)
+			}
+		})
+	}
+}
+
+// conflictingRestores fails every Restore as a store whose uniqueness rules
+// ignore soft-deleted users would once the username is taken again
+type conflictingRestores struct {
+	repositories.UserRepository
+}
+
+func (r conflictingRestores) Restore(ctx context.Context, id uint) error {
+	return &repositories.ConflictError{Field: "username"}
+}
+
+func TestRestoreUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		conflict bool
+		target   string
+		want     error
+	}{
+		{"deleted user", false, "old", nil},
+		{"active user", false, "john", services.ErrNotFound},
+		{"missing user", false, "", services.ErrNotFound},
+		{"conflict", true, "old", services.ErrConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			var repo repositories.UserRepository = repositories.NewInMemoryUserRepository()
+			if tt.conflict {
+				repo = conflictingRestores{repo}
+			}
+			audit := repositories.NewInMemoryAuditRepository()
+			users := newUserServiceOn(t, repo, audit, utils.NewBcryptHasher(bcrypt.MinCost))
+			ids := map[string]uint{"": 999}
+			for _, name := range []string{"john", "old"} {
+				user, err := users.CreateUser(ctx, models.CreateUserRequest{Username: name, Email: name + "@example.com", Password: "password1"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids[name] = user.ID
+			}
+			if err := users.DeleteUser(ctx, ids["old"]); err != nil {
+				t.Fatal(err)
+			}
+
+			restored, err := users.RestoreUser(ctx, ids[tt.target])
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+			entries, _ := audit.Query(ctx, repositories.AuditQuery{Action: models.AuditRestore})
+			if tt.want != nil {
+				if len(entries) != 0 {
+					t.Errorf("failed restore left %d audit entries", len(entries))
+				}
+				if tt.target == "old" {
+					if _, err := repo.FindDeletedByID(ctx, ids["old"]); err != nil {
+						t.Errorf("user after failed restore: %v, want it still deleted", err)
+					}
+				}
+				return
+			}
+
+			if restored.Version != 3 || restored.DeletedAt != nil {
+				t.Errorf("restored user = %+v, want version 3 and not deleted", restored)
+			}
+			if _, err := users.GetUserByID(ctx, ids["old"]); err != nil {
+				t.Errorf("GetUserByID after restore: %v", err)
+			}
+			if len(entries) != 1 || len(entries[0].Changes) != 1 || entries[0].Changes[0].Field != "deleted_at" || entries[0].Changes[0].New != nil {
+				t.Errorf("restore entries = %s, want deleted_at cleared", jsonString(entries))
+			}
+		})
+	}
+}
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewInMemoryUserRepository()
+	audit := repositories.NewInMemoryAuditRepository()
+	users := newUserServiceOn(t, repo, audit, utils.NewBcryptHasher(bcrypt.MinCost))
+
+	// Two users deleted long enough ago, one recently and one active
+	now := time.Now()
+	deletedAt := map[string]time.Time{"old": now.Add(-48 * time.Hour), "older": now.Add(-72 * time.Hour), "recent": now.Add(-time.Hour)}
+	ids := map[string]uint{}
+	for _, name := range []string{"john", "old", "older", "recent"} {
+		user, err := users.CreateUser(ctx, models.CreateUserRequest{Username: name, Email: name + "@example.com", Password: "password1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[name] = user.ID
+		if at, ok := deletedAt[name]; ok {
+			if err := repo.Delete(ctx, user.ID, at); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	n, err := users.PurgeDeletedUsers(services.WithAuditInfo(ctx, services.AuditInfo{Actor: services.ActorSystem}), 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("purged %d users, want 2", n)
+	}
+	for _, name := range []string{"old", "older"} {
+		if _, err := repo.FindDeletedByID(ctx, ids[name]); !errors.Is(err, repositories.ErrNotFound) {
+			t.Errorf("%s after purge: %v, want ErrNotFound", name, err)
+		}
+	}
+	if _, err := repo.FindDeletedByID(ctx, ids["recent"]); err != nil {
+		t.Errorf("recently deleted user after purge: %v", err)
+	}
+	if _, err := repo.FindByID(ctx, ids["john"]); err != nil {
+		t.Errorf("active user after purge: %v", err)
+	}
+
+	entries, _ := audit.Query(ctx, repositories.AuditQuery{Action: models.AuditPurge})
+	if len(entries) != 2 || entries[0].UserID != ids["old"] || entries[1].UserID != ids["older"] || entries[0].Actor != services.ActorSystem {
+		t.Errorf("purge entries = %s, want one for old and older by the system", jsonString(entries))
+	}
+
+	// The purged usernames are free again
+	if _, err := users.CreateUser(ctx, models.CreateUserRequest{Username: "old", Email: "old@example.com", Password: "password1"}); err != nil {
+		t.Errorf("CreateUser with a purged username: %v", err)
+	}
+	if n, err := users.PurgeDeletedUsers(ctx, 24*time.Hour); err != nil || n != 0 {
+		t.Errorf("second purge = %d, %v; want nothing purged", n, err)
+	}
+}
+
+func TestRunPurgeJob(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := repositories.NewInMemoryUserRepository()
+	audit := repositories.NewInMemoryAuditRepository()
+	users := newUserServiceOn(t, repo, audit, utils.NewBcryptHasher(bcrypt.MinCost))
+
+	deleteOld := func(name string) uint {
+		t.Helper()
+		user := &models.User{Username: name, Email: name + "@example.com"}
+		if err := repo.Create(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.Delete(ctx, user.ID, time.Now().Add(-2*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		return user.ID
+	}
+	waitPurged := func(id uint) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			if _, err := repo.FindDeletedByID(ctx, id); errors.Is(err, repositories.ErrNotFound) {
+				return
+			}
+		}
+		t.Fatalf("user %d was not purged", id)
+	}
+
+	// The first run happens right away, later ones on every tick
+	first := deleteOld("old")
+	done := make(chan struct{})
+	go func() {
+		users.RunPurgeJob(ctx, time.Hour, 10*time.Millisecond)
+		close(done)
+	}()
+	waitPurged(first)
+	waitPurged(deleteOld("later"))
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunPurgeJob did not return after its context was canceled")
+	}
+
+	entries, _ := audit.Query(context.Background(), repositories.AuditQuery{Action: models.AuditPurge})
+	if len(entries) != 2 {
+		t.Fatalf("got %d purge entries, want 2", len(entries))
+	}
+	for _, e := range entries {
+		if e.Actor != services.ActorSystem || e.ActorID != 0 {
+			t.Errorf("purge entry = %+v, want it attributed to the system", e)
+		}
+	}
+}
+
+func TestFindUser(t *testing.T) {
+	ctx := context.Background()
+	users, repo := newUserService(t, utils.NewBcryptHasher(bcrypt.MinCost))
+	admin := &models.User{Username: "admin", Email: "admin@example.com", Role: models.RoleAdmin, Permissions: []models.Permission{models.PermAuditRead}}
+	if err := repo.Create(ctx, admin); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := users.FindUser(ctx, admin.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Username != "admin" || got.Role != models.RoleAdmin || len(got.Permissions) != 1 {
+		t.Errorf("FindUser() = %+v, want the stored admin", got)
+	}
+
+	if err := users.DeleteUser(ctx, admin.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []uint{admin.ID, 999} {
+		if _, err := users.FindUser(ctx, id); !errors.Is(err, services.ErrNotFound) {
+			t.Errorf("FindUser(%d) error = %v, want ErrNotFound", id, err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"slices"
+	"sync"
+)
+
+// WriterExporter writes every span as a line of JSON, e.g. to stdout
+type WriterExporter struct {
+	mutex sync.Mutex
+	enc   *json.Encoder
+}
+
+// Create new WriterExporter writing to w
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{enc: json.NewEncoder(w)}
+}
+
+func (e *WriterExporter) ExportSpan(span SpanData) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.enc.Encode(span)
+}
+
+// InMemoryExporter keeps every span in memory, for tests and debugging
+type InMemoryExporter struct {
+	mutex sync.Mutex
+	spans []SpanData
+}
+
+// Create new empty InMemoryExporter
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) ExportSpan(span SpanData) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans returns the exported spans in the order they ended
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return slices.Clone(e.spans)
+}
+
+// Reset drops every exported span
+func (e *InMemoryExporter) Reset() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = nil
+}
@@ -0,0 +1,278 @@
+// Package tracing records spans of work within a trace, in the spirit of
+// OpenTelemetry. Spans travel in contexts: Start makes a child of the span in
+// ctx, or does nothing if there is none, so code can be traced without
+// knowing whether tracing is enabled. Traces are continued from and identified
+// by W3C traceparent headers.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// IsValid reports whether id is not all zeros
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// IsValid reports whether id is not all zeros
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+// SpanContext is the part of a span that crosses process boundaries
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// Sampled spans are exported; the decision is made once per trace
+	Sampled bool
+}
+
+// IsValid reports whether sc identifies a span
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// Traceparent formats sc as a W3C traceparent header value
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses a W3C traceparent header value. Versions after 00
+// are accepted as long as they start with the version 00 fields.
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(s, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[3]) != 2 {
+		return sc, fmt.Errorf("malformed traceparent %q", s)
+	}
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || version[0] == 0xff || (version[0] == 0 && len(parts) != 4) {
+		return sc, fmt.Errorf("unsupported traceparent version in %q", s)
+	}
+	if !decodeHex(sc.TraceID[:], parts[1]) || !decodeHex(sc.SpanID[:], parts[2]) || !sc.IsValid() {
+		return sc, fmt.Errorf("invalid trace or span ID in %q", s)
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, fmt.Errorf("invalid trace flags in %q", s)
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// decodeHex decodes lowercase hex s, which must fill dst exactly
+func decodeHex(dst []byte, s string) bool {
+	if len(s) != 2*len(dst) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// Attr is a key-value pair describing a span
+type Attr struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+// SpanData is a finished span as handed to an Exporter
+type SpanData struct {
+	Name         string        `json:"name"`
+	TraceID      string        `json:"trace_id"`
+	SpanID       string        `json:"span_id"`
+	ParentSpanID string        `json:"parent_span_id,omitempty"`
+	Start        time.Time     `json:"start"`
+	End          time.Time     `json:"end"`
+	Duration     time.Duration `json:"duration_ns"`
+	Attributes   []Attr        `json:"attributes,omitempty"`
+	// Error is the message of the error that failed the span, if any
+	Error string `json:"error,omitempty"`
+}
+
+// Exporter receives every sampled span when it ends. ExportSpan is called
+// concurrently and must not block for long.
+type Exporter interface {
+	ExportSpan(span SpanData)
+}
+
+// Tracer starts traces and hands their spans to an exporter
+type Tracer struct {
+	exporter Exporter
+}
+
+// Create new Tracer. With a nil exporter traces still get IDs for logs and
+// error responses, but nothing is exported.
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// Start begins a span named name. It continues the span in ctx or, failing
+// that, the remote parent set with WithRemoteParent; otherwise it starts a
+// new trace.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	if parent := SpanFromContext(ctx); parent != nil {
+		return parent.tracer.start(ctx, name, parent.sc, true)
+	}
+	if remote, ok := ctx.Value(remoteParentKey{}).(SpanContext); ok {
+		return t.start(ctx, name, remote, true)
+	}
+	return t.start(ctx, name, SpanContext{Sampled: true}, false)
+}
+
+func (t *Tracer) start(ctx context.Context, name string, parent SpanContext, hasParent bool) (context.Context, *Span) {
+	span := &Span{tracer: t, name: name, start: time.Now()}
+	if hasParent {
+		span.sc.TraceID = parent.TraceID
+		span.parent = parent.SpanID
+	} else {
+		rand.Read(span.sc.TraceID[:])
+	}
+	rand.Read(span.sc.SpanID[:])
+	span.sc.Sampled = parent.Sampled
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+type spanKey struct{}
+type remoteParentKey struct{}
+
+// WithRemoteParent returns a context in which the next Tracer.Start continues
+// the trace of sc, typically parsed from an incoming traceparent header
+func WithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteParentKey{}, sc)
+}
+
+// SpanFromContext returns the current span of ctx, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// SpanContextFromContext returns the SpanContext of the current span of ctx,
+// or the zero SpanContext
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.sc
+	}
+	return SpanContext{}
+}
+
+// Start begins a child of the current span of ctx. Without one it returns
+// ctx and a nil span, whose methods do nothing.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name)
+}
+
+// Span is one timed operation of a trace. Its methods are safe for concurrent
+// use and do nothing on a nil span.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	parent SpanID
+	start  time.Time
+
+	mutex sync.Mutex
+	name  string
+	attrs []Attr
+	err   error
+	ended bool
+}
+
+// SpanContext returns the IDs of the span
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetName replaces the name the span was started with
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.name = name
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// RecordError marks the span as failed by err; a nil err is ignored
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.err = err
+}
+
+// End finishes the span and exports it if it is sampled. Only the first call
+// has an effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	end := time.Now()
+
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	data := SpanData{
+		Name:       s.name,
+		TraceID:    s.sc.TraceID.String(),
+		SpanID:     s.sc.SpanID.String(),
+		Start:      s.start,
+		End:        end,
+		Duration:   end.Sub(s.start),
+		Attributes: slices.Clone(s.attrs),
+	}
+	if s.parent.IsValid() {
+		data.ParentSpanID = s.parent.String()
+	}
+	if s.err != nil {
+		data.Error = s.err.Error()
+	}
+	s.mutex.Unlock()
+
+	if s.sc.Sampled && s.tracer.exporter != nil {
+		s.tracer.exporter.ExportSpan(data)
+	}
+}
+
+// EndWithError records *err, if any, and ends the span. Defer it with a
+// pointer to a named error result.
+func (s *Span) EndWithError(err *error) {
+	s.RecordError(*err)
+	s.End()
+}
@@ -0,0 +1,148 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/rizqishq/Go-REST/tracing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		header  string
+		ok      bool
+		sampled bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-zz", false, false},
+		{"", false, false},
+	}
+	for _, tt := range tests {
+		sc, err := tracing.ParseTraceparent(tt.header)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseTraceparent(%q) error = %v, want ok = %v", tt.header, err, tt.ok)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		if sc.Sampled != tt.sampled {
+			t.Errorf("ParseTraceparent(%q).Sampled = %v, want %v", tt.header, sc.Sampled, tt.sampled)
+		}
+		if tt.header[:2] == "00" && sc.Traceparent() != tt.header {
+			t.Errorf("Traceparent() = %q, want %q", sc.Traceparent(), tt.header)
+		}
+	}
+}
+
+func TestSpansFormATree(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	tracer := tracing.NewTracer(exporter)
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	childCtx, child := tracing.Start(ctx, "child")
+	_, grandchild := tracing.Start(childCtx, "grandchild")
+	grandchild.SetAttributes(tracing.Attr{Key: "n", Value: 1})
+	grandchild.RecordError(errors.New("boom"))
+	grandchild.End()
+	child.End()
+	root.SetName("renamed")
+	root.End()
+	root.End()
+
+	spans := exporter.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("exported %d spans, want 3", len(spans))
+	}
+	g, c, r := spans[0], spans[1], spans[2]
+	if r.Name != "renamed" || r.ParentSpanID != "" {
+		t.Errorf("root = %+v, want a renamed span without parent", r)
+	}
+	if c.ParentSpanID != r.SpanID || g.ParentSpanID != c.SpanID {
+		t.Errorf("parents = %q, %q; want %q, %q", c.ParentSpanID, g.ParentSpanID, r.SpanID, c.SpanID)
+	}
+	for _, s := range spans {
+		if s.TraceID != r.TraceID {
+			t.Errorf("span %s has trace %s, want %s", s.Name, s.TraceID, r.TraceID)
+		}
+	}
+	if g.Error != "boom" || len(g.Attributes) != 1 || g.Attributes[0].Key != "n" {
+		t.Errorf("grandchild = %+v, want error and attribute", g)
+	}
+	if sc := tracing.SpanContextFromContext(childCtx); sc.SpanID.String() != c.SpanID {
+		t.Errorf("SpanContextFromContext = %s, want the child span", sc.SpanID)
+	}
+}
+
+func TestRemoteParent(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	tracer := tracing.NewTracer(exporter)
+
+	for _, header := range []string{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+	} {
+		parent, err := tracing.ParseTraceparent(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, span := tracer.Start(tracing.WithRemoteParent(context.Background(), parent), "server")
+		_, child := tracing.Start(ctx, "child")
+		child.End()
+		span.End()
+
+		sc := span.SpanContext()
+		if sc.TraceID != parent.TraceID || sc.Sampled != parent.Sampled {
+			t.Errorf("span of %s has context %+v, want the parent's trace and sampling", header, sc)
+		}
+	}
+
+	// Only the sampled trace is exported
+	spans := exporter.Spans()
+	if len(spans) != 2 || spans[1].ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("exported %+v, want the child and server span of the sampled trace", spans)
+	}
+}
+
+func TestWithoutSpan(t *testing.T) {
+	ctx := context.Background()
+	got, span := tracing.Start(ctx, "orphan")
+	if got != ctx || span != nil {
+		t.Fatalf("Start without a span returned %v, %v; want ctx and nil", got, span)
+	}
+	// A nil span accepts every call
+	span.SetName("x")
+	span.SetAttributes(tracing.Attr{Key: "k", Value: "v"})
+	span.RecordError(errors.New("boom"))
+	err := errors.New("boom")
+	span.EndWithError(&err)
+	if span.SpanContext().IsValid() {
+		t.Error("nil span has a valid SpanContext")
+	}
+}
+
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := tracing.NewTracer(tracing.NewWriterExporter(&buf))
+	_, span := tracer.Start(context.Background(), "op")
+	span.End()
+
+	var data tracing.SpanData
+	if err := json.Unmarshal(buf.Bytes(), &data); err != nil {
+		t.Fatalf("exported line is not JSON: %v\n%s", err, buf.String())
+	}
+	if data.Name != "op" || data.TraceID != span.SpanContext().TraceID.String() {
+		t.Errorf("exported %+v, want span op", data)
+	}
+}
@@ -0,0 +1,123 @@
+package utils_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/rizqishq/Go-REST/utils"
+)
+
+const patchDoc = `{"username": "john", "last_name": "Doe", "tags": ["a", "b"], "address": {"city": "Oslo"}}`
+
+// jsonValue decodes s so documents compare regardless of member order
+func jsonValue(t *testing.T, s string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("invalid JSON %s: %v", s, err)
+	}
+	return v
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name, patch, want string
+	}{
+		{"add member", `[{"op": "add", "path": "/first_name", "value": "John"}]`,
+			`{"username": "john", "first_name": "John", "last_name": "Doe", "tags": ["a", "b"], "address": {"city": "Oslo"}}`},
+		{"add null", `[{"op": "add", "path": "/first_name", "value": null}]`,
+			`{"username": "john", "first_name": null, "last_name": "Doe", "tags": ["a", "b"], "address": {"city": "Oslo"}}`},
+		{"add to array", `[{"op": "add", "path": "/tags/1", "value": "x"}, {"op": "add", "path": "/tags/-", "value": "z"}]`,
+			`{"username": "john", "last_name": "Doe", "tags": ["a", "x", "b", "z"], "address": {"city": "Oslo"}}`},
+		{"remove", `[{"op": "remove", "path": "/last_name"}, {"op": "remove", "path": "/tags/0"}]`,
+			`{"username": "john", "tags": ["b"], "address": {"city": "Oslo"}}`},
+		{"replace", `[{"op": "replace", "path": "/address/city", "value": "Bergen"}]`,
+			`{"username": "john", "last_name": "Doe", "tags": ["a", "b"], "address": {"city": "Bergen"}}`},
+		{"replace with null", `[{"op": "replace", "path": "/last_name", "value": null}]`,
+			`{"username": "john", "last_name": null, "tags": ["a", "b"], "address": {"city": "Oslo"}}`},
+		{"move", `[{"op": "move", "from": "/last_name", "path": "/address/name"}]`,
+			`{"username": "john", "tags": ["a", "b"], "address": {"city": "Oslo", "name": "Doe"}}`},
+		{"copy", `[{"op": "copy", "from": "/tags", "path": "/labels"}, {"op": "add", "path": "/labels/-", "value": "c"}]`,
+			`{"username": "john", "last_name": "Doe", "tags": ["a", "b"], "labels": ["a", "b", "c"], "address": {"city": "Oslo"}}`},
+		{"test then replace", `[{"op": "test", "path": "/username", "value": "john"}, {"op": "replace", "path": "/username", "value": "johnny"}]`,
+			`{"username": "johnny", "last_name": "Doe", "tags": ["a", "b"], "address": {"city": "Oslo"}}`},
+		{"test null", `[{"op": "replace", "path": "/last_name", "value": null}, {"op": "test", "path": "/last_name", "value": null}]`,
+			`{"username": "john", "last_name": null, "tags": ["a", "b"], "address": {"city": "Oslo"}}`},
+		{"escaped pointer", `[{"op": "add", "path": "/a~1b~0c", "value": 1}]`,
+			`{"username": "john", "last_name": "Doe", "tags": ["a", "b"], "address": {"city": "Oslo"}, "a/b~c": 1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := utils.ApplyJSONPatch([]byte(patchDoc), []byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(jsonValue(t, string(got)), jsonValue(t, tt.want)) {
+				t.Errorf("patched = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyJSONPatchErrors(t *testing.T) {
+	tests := []struct {
+		name, patch string
+		want        error
+	}{
+		{"not an array", `{"op": "remove", "path": "/username"}`, utils.ErrInvalidPatch},
+		{"unknown op", `[{"op": "rename", "path": "/username"}]`, utils.ErrInvalidPatch},
+		{"missing path", `[{"op": "remove"}]`, utils.ErrInvalidPatch},
+		{"missing value", `[{"op": "replace", "path": "/username"}]`, utils.ErrInvalidPatch},
+		{"missing from", `[{"op": "move", "path": "/username"}]`, utils.ErrInvalidPatch},
+		{"pointer without slash", `[{"op": "remove", "path": "username"}]`, utils.ErrInvalidPatch},
+		{"missing member", `[{"op": "remove", "path": "/first_name"}]`, utils.ErrInvalidPatch},
+		{"missing parent", `[{"op": "add", "path": "/nothing/here", "value": 1}]`, utils.ErrInvalidPatch},
+		{"index out of range", `[{"op": "replace", "path": "/tags/2", "value": "c"}]`, utils.ErrInvalidPatch},
+		{"index with leading zero", `[{"op": "remove", "path": "/tags/01"}]`, utils.ErrInvalidPatch},
+		{"move into itself", `[{"op": "move", "from": "/address", "path": "/address/home"}]`, utils.ErrInvalidPatch},
+		{"test fails", `[{"op": "test", "path": "/username", "value": "jane"}]`, utils.ErrPatchTestFailed},
+		{"test null fails", `[{"op": "test", "path": "/last_name", "value": null}]`, utils.ErrPatchTestFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := utils.ApplyJSONPatch([]byte(patchDoc), []byte(tt.patch))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name, patch, want string
+	}{
+		{"set members", `{"username": "johnny", "first_name": "John"}`,
+			`{"username": "johnny", "first_name": "John", "last_name": "Doe", "tags": ["a", "b"], "address": {"city": "Oslo"}}`},
+		{"null removes", `{"last_name": null}`,
+			`{"username": "john", "tags": ["a", "b"], "address": {"city": "Oslo"}}`},
+		{"nested objects merge", `{"address": {"zip": "0150", "city": null}}`,
+			`{"username": "john", "last_name": "Doe", "tags": ["a", "b"], "address": {"zip": "0150"}}`},
+		{"arrays are replaced", `{"tags": ["c"]}`,
+			`{"username": "john", "last_name": "Doe", "tags": ["c"], "address": {"city": "Oslo"}}`},
+		{"empty patch", `{}`, patchDoc},
+		{"non-object replaces", `"x"`, `"x"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := utils.MergePatch([]byte(patchDoc), []byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(jsonValue(t, string(got)), jsonValue(t, tt.want)) {
+				t.Errorf("patched = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := utils.MergePatch([]byte(patchDoc), []byte(`{"username": `)); !errors.Is(err, utils.ErrInvalidPatch) {
+		t.Errorf("malformed patch error = %v, want ErrInvalidPatch", err)
+	}
+}
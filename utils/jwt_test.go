@@ -0,0 +1,89 @@
+package utils_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rizqishq/Go-REST/utils"
+)
+
+var (
+	jwtSecret = []byte("0123456789abcdef0123456789abcdef")
+	jwtNow    = time.Unix(1700000000, 0)
+)
+
+func signedClaims(t *testing.T) string {
+	t.Helper()
+	token, err := utils.SignJWT(utils.TokenClaims{
+		Subject:   "42",
+		Issuer:    "go-rest",
+		IssuedAt:  jwtNow.Unix(),
+		ExpiresAt: jwtNow.Add(time.Minute).Unix(),
+	}, jwtSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func segment(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// resign replaces the header and payload of a token and signs it with secret,
+// as an attacker who knows the secret, or who hopes it is not checked, would
+func resign(header, payload string, secret []byte) string {
+	input := segment(header) + "." + segment(payload)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestParseJWT(t *testing.T) {
+	claims, err := utils.ParseJWT(signedClaims(t), jwtSecret, jwtNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "42" || claims.Issuer != "go-rest" || claims.ExpiresAt != jwtNow.Add(time.Minute).Unix() {
+		t.Errorf("claims = %+v", claims)
+	}
+}
+
+func TestParseJWTErrors(t *testing.T) {
+	token := signedClaims(t)
+	parts := strings.Split(token, ".")
+	payload := `{"sub":"42","iss":"go-rest","iat":1700000000,"exp":1700000060}`
+
+	tests := []struct {
+		name, token string
+		now         time.Time
+		want        error
+	}{
+		{"wrong secret", resign(`{"alg":"HS256","typ":"JWT"}`, payload, []byte("another secret")), jwtNow, utils.ErrTokenSignature},
+		{"tampered payload", parts[0] + "." + segment(strings.Replace(payload, `"42"`, `"1"`, 1)) + "." + parts[2], jwtNow, utils.ErrTokenSignature},
+		{"tampered signature", parts[0] + "." + parts[1] + "." + strings.Repeat("A", len(parts[2])), jwtNow, utils.ErrTokenSignature},
+		{"alg none", segment(`{"alg":"none","typ":"JWT"}`) + "." + segment(payload) + ".", jwtNow, utils.ErrMalformedToken},
+		{"alg HS512", resign(`{"alg":"HS512","typ":"JWT"}`, payload, jwtSecret), jwtNow, utils.ErrMalformedToken},
+		{"other typ", resign(`{"alg":"HS256","typ":"at+jwt"}`, payload, jwtSecret), jwtNow, utils.ErrMalformedToken},
+		{"header members reordered", resign(`{"typ":"JWT","alg":"HS256"}`, payload, jwtSecret), jwtNow, utils.ErrMalformedToken},
+		{"payload not JSON", resign(`{"alg":"HS256","typ":"JWT"}`, "not json", jwtSecret), jwtNow, utils.ErrMalformedToken},
+		{"two segments", parts[0] + "." + parts[1], jwtNow, utils.ErrMalformedToken},
+		{"four segments", token + ".", jwtNow, utils.ErrMalformedToken},
+		{"empty", "", jwtNow, utils.ErrMalformedToken},
+		{"expired", token, jwtNow.Add(2 * time.Minute), utils.ErrTokenExpired},
+		{"expires now", token, jwtNow.Add(time.Minute), utils.ErrTokenExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := utils.ParseJWT(tt.token, jwtSecret, tt.now)
+			if !errors.Is(err, tt.want) || claims != nil {
+				t.Errorf("ParseJWT() = %+v, %v; want %v", claims, err, tt.want)
+			}
+		})
+	}
+}
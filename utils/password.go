@@ -1,17 +1,178 @@
 package utils
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
 )
 
-// Simple password hashing utility using SHA-256. For learn purpose
-func HashPassword(password string) string {
-	hash := sha256.Sum256([]byte(password))
-	return hex.EncodeToString(hash[:])
+// PasswordHasher hashes passwords into PHC-style strings and verifies them.
+// Verify accepts hashes from every supported scheme (argon2id, bcrypt and the
+// legacy unsalted SHA-256 hex digests), so stored hashes keep working after
+// the preferred algorithm or its cost changes.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded, and whether encoded
+	// should be replaced by a fresh Hash because it uses another scheme or
+	// weaker parameters than this hasher.
+	Verify(encoded, password string) (ok bool, needsRehash bool)
+}
+
+// Argon2idParams are the cost parameters of an argon2id hash
+type Argon2idParams struct {
+	Time    uint32
+	Memory  uint32 // KiB
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// DefaultArgon2idParams follow the OWASP recommendation for argon2id
+var DefaultArgon2idParams = Argon2idParams{
+	Time:    3,
+	Memory:  64 * 1024,
+	Threads: 2,
+	SaltLen: 16,
+	KeyLen:  32,
+}
+
+// Argon2idHasher hashes passwords with argon2id
+type Argon2idHasher struct {
+	params Argon2idParams
+}
+
+// Create new argon2id hasher
+func NewArgon2idHasher(params Argon2idParams) *Argon2idHasher {
+	return &Argon2idHasher{params: params}
+}
+
+// Hash returns $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.params.Time, h.params.Memory, h.params.Threads, h.params.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.params.Memory, h.params.Time, h.params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Verify(encoded, password string) (bool, bool) {
+	if !verifyAny(encoded, password) {
+		return false, false
+	}
+	params, _, _, err := decodeArgon2id(encoded)
+	return true, err != nil || params != h.params
+}
+
+// BcryptMaxPasswordBytes is the longest password bcrypt hashes; Hash fails
+// for longer ones
+const BcryptMaxPasswordBytes = 72
+
+// BcryptHasher hashes passwords with bcrypt
+type BcryptHasher struct {
+	cost int
+}
+
+// Create new bcrypt hasher
+func NewBcryptHasher(cost int) *BcryptHasher {
+	return &BcryptHasher{cost: cost}
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h *BcryptHasher) Verify(encoded, password string) (bool, bool) {
+	if !verifyAny(encoded, password) {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return true, err != nil || cost != h.cost
 }
 
-// Compare a hashed password with a plain text password
-func VerifyPassword(hashedPassword, password string) bool {
-	return HashPassword(password) == hashedPassword
+// defaultHasher backs HashPassword and VerifyPassword
+var defaultHasher PasswordHasher = NewArgon2idHasher(DefaultArgon2idParams)
+
+// HashPassword hashes password with argon2id and the default parameters
+func HashPassword(password string) (string, error) {
+	return defaultHasher.Hash(password)
+}
+
+// VerifyPassword compares a stored hash with a plain text password in
+// constant time. needsRehash is set for legacy or outdated hashes.
+func VerifyPassword(hashedPassword, password string) (ok bool, needsRehash bool) {
+	return defaultHasher.Verify(hashedPassword, password)
+}
+
+// verifyAny checks password against a hash of any supported scheme
+func verifyAny(encoded, password string) bool {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false
+		}
+		other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLen)
+		return subtle.ConstantTimeCompare(key, other) == 1
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+	case isLegacySHA256(encoded):
+		sum := sha256.Sum256([]byte(password))
+		return subtle.ConstantTimeCompare([]byte(encoded), []byte(hex.EncodeToString(sum[:]))) == 1
+	}
+	return false
+}
+
+// isLegacySHA256 matches the unsalted hex digests written by earlier versions
+func isLegacySHA256(encoded string) bool {
+	if len(encoded) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(encoded)
+	return err == nil
+}
+
+var errInvalidArgon2idHash = errors.New("invalid argon2id hash")
+
+func decodeArgon2id(encoded string) (Argon2idParams, []byte, []byte, error) {
+	var params Argon2idParams
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errInvalidArgon2idHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errInvalidArgon2idHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return params, nil, nil, errInvalidArgon2idHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, errInvalidArgon2idHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, errInvalidArgon2idHash
+	}
+	params.SaltLen = uint32(len(salt))
+	params.KeyLen = uint32(len(key))
+	return params, salt, key, nil
 }
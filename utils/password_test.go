@@ -0,0 +1,137 @@
+package utils_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/rizqishq/Go-REST/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fastArgon2id keeps tests quick; only the format matters here
+var fastArgon2id = utils.Argon2idParams{Time: 1, Memory: 64, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+func legacyHash(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestHashAndVerify(t *testing.T) {
+	hashers := []struct {
+		name   string
+		hasher utils.PasswordHasher
+		prefix string
+	}{
+		{"argon2id", utils.NewArgon2idHasher(fastArgon2id), "$argon2id$v=19$m=64,t=1,p=1$"},
+		{"bcrypt", utils.NewBcryptHasher(bcrypt.MinCost), "$2a$04$"},
+	}
+	for _, tt := range hashers {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := tt.hasher.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(hash, tt.prefix) {
+				t.Errorf("hash %q does not start with %q", hash, tt.prefix)
+			}
+			if again, _ := tt.hasher.Hash("correct horse"); again == hash {
+				t.Error("hashing twice gave the same hash; the salt is not random")
+			}
+
+			if ok, needsRehash := tt.hasher.Verify(hash, "correct horse"); !ok || needsRehash {
+				t.Errorf("Verify(right password) = %v, %v; want true, false", ok, needsRehash)
+			}
+			if ok, _ := tt.hasher.Verify(hash, "correct horse!"); ok {
+				t.Error("Verify accepted a wrong password")
+			}
+		})
+	}
+}
+
+func TestVerifyNeedsRehash(t *testing.T) {
+	argon := utils.NewArgon2idHasher(fastArgon2id)
+	stronger := fastArgon2id
+	stronger.Time = 2
+	strongerArgon := utils.NewArgon2idHasher(stronger)
+	bcrypt4 := utils.NewBcryptHasher(bcrypt.MinCost)
+	bcrypt5 := utils.NewBcryptHasher(bcrypt.MinCost + 1)
+
+	argonHash, _ := argon.Hash("secret")
+	bcryptHash, _ := bcrypt4.Hash("secret")
+
+	tests := []struct {
+		name   string
+		hasher utils.PasswordHasher
+		hash   string
+		rehash bool
+	}{
+		{"same argon2id parameters", argon, argonHash, false},
+		{"weaker argon2id parameters", strongerArgon, argonHash, true},
+		{"bcrypt hash with argon2id configured", argon, bcryptHash, true},
+		{"same bcrypt cost", bcrypt4, bcryptHash, false},
+		{"other bcrypt cost", bcrypt5, bcryptHash, true},
+		{"argon2id hash with bcrypt configured", bcrypt4, argonHash, true},
+		{"legacy SHA-256 with argon2id configured", argon, legacyHash("secret"), true},
+		{"legacy SHA-256 with bcrypt configured", bcrypt4, legacyHash("secret"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash := tt.hasher.Verify(tt.hash, "secret")
+			if !ok || needsRehash != tt.rehash {
+				t.Errorf("Verify = %v, %v; want true, %v", ok, needsRehash, tt.rehash)
+			}
+			if ok, needsRehash := tt.hasher.Verify(tt.hash, "Secret"); ok || needsRehash {
+				t.Errorf("Verify(wrong password) = %v, %v; want false, false", ok, needsRehash)
+			}
+		})
+	}
+}
+
+func TestVerifyMalformedHashes(t *testing.T) {
+	hasher := utils.NewArgon2idHasher(fastArgon2id)
+	valid, _ := hasher.Hash("secret")
+	parts := strings.Split(valid, "$")
+	salt, key := parts[4], parts[5]
+
+	hashes := map[string]string{
+		"empty":                  "",
+		"plain text":             "secret",
+		"unknown scheme":         "$scrypt$ln=15,r=8,p=1$" + salt + "$" + key,
+		"missing key":            "$argon2id$v=19$m=64,t=1,p=1$" + salt,
+		"other argon2 version":   "$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key,
+		"garbled parameters":     "$argon2id$v=19$m=x,t=1,p=1$" + salt + "$" + key,
+		"salt not base64":        "$argon2id$v=19$m=64,t=1,p=1$!!!$" + key,
+		"key not base64":         "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$!!!",
+		"argon2i":                "$argon2i$v=19$m=64,t=1,p=1$" + salt + "$" + key,
+		"truncated bcrypt":       "$2a$04$abc",
+		"legacy digest too long": legacyHash("secret") + "00",
+		"legacy digest not hex":  strings.Repeat("g", 64),
+	}
+	for name, hash := range hashes {
+		if ok, _ := hasher.Verify(hash, "secret"); ok {
+			t.Errorf("%s: Verify(%q) accepted the password", name, hash)
+		}
+	}
+}
+
+func TestBcryptPasswordLimit(t *testing.T) {
+	hasher := utils.NewBcryptHasher(bcrypt.MinCost)
+	if _, err := hasher.Hash(strings.Repeat("a", utils.BcryptMaxPasswordBytes)); err != nil {
+		t.Errorf("hashing %d bytes: %v", utils.BcryptMaxPasswordBytes, err)
+	}
+	if _, err := hasher.Hash(strings.Repeat("a", utils.BcryptMaxPasswordBytes+1)); err == nil {
+		t.Errorf("hashing %d bytes succeeded; BcryptMaxPasswordBytes is wrong", utils.BcryptMaxPasswordBytes+1)
+	}
+
+	// The policy main builds for bcrypt rejects such passwords up front
+	validator := utils.NewValidator(utils.PasswordPolicy{MinLength: 8, MaxLength: 128, MaxBytes: utils.BcryptMaxPasswordBytes})
+	var req struct {
+		Password string `json:"password" validate:"password"`
+	}
+	req.Password = strings.Repeat("é", 40) // 40 characters, 80 bytes
+	if got, err := validator.Validate(&req); err != nil || len(got) != 1 || got[0].Message != "must be at most 72 bytes" {
+		t.Errorf("violations = %+v, %v; want the byte limit", got, err)
+	}
+}
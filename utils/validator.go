@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FieldViolation describes one rule a field failed
+type FieldViolation struct {
+	Field   string
+	Message string
+}
+
+// PasswordPolicy is enforced by the "password" rule
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// MaxBytes limits the UTF-8 length for hashes that only take so many
+	// bytes, such as bcrypt; 0 means no limit
+	MaxBytes      int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+}
+
+// Validator checks string fields against the rules in their `validate` tag,
+// e.g. `validate:"required,min=3,max=32,username"`. Rules are:
+//
+//	required   the value must not be blank
+//	min=N      at least N characters
+//	max=N      at most N characters
+//	email      a bare address such as user@example.com
+//	username   letters, digits, '.', '_' and '-', starting with a letter or digit
+//	password   satisfies the configured PasswordPolicy
+//
+// Apart from required, rules skip empty values, so optional fields are only
+// checked when present. Fields are reported by their JSON name. The tags of
+// a type are parsed once; an unknown rule or a bad parameter is an error.
+type Validator struct {
+	policy atomic.Pointer[PasswordPolicy]
+	// rules caches the []fieldRules of each struct type
+	rules sync.Map
+}
+
+// rule is one parsed rule of a validate tag
+type rule struct {
+	name string
+	n    int
+}
+
+// fieldRules are the rules of the string field at index
+type fieldRules struct {
+	index int
+	name  string
+	rules []rule
+}
+
+// Create new Validator enforcing the given password policy
+func NewValidator(policy PasswordPolicy) *Validator {
+	v := &Validator{}
+	v.SetPolicy(policy)
+	return v
+}
+
+// SetPolicy replaces the password policy. It is safe to call while other
+// goroutines validate.
+func (v *Validator) SetPolicy(policy PasswordPolicy) {
+	v.policy.Store(&policy)
+}
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Register parses the tags of the structs, or pointers to structs, in types,
+// so that a malformed tag is reported at startup rather than on a request
+func (v *Validator) Register(types ...any) error {
+	for _, t := range types {
+		typ := reflect.TypeOf(t)
+		if typ != nil && typ.Kind() == reflect.Pointer {
+			typ = typ.Elem()
+		}
+		if _, err := v.rulesFor(typ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate returns every violation found in the struct s points to. The error
+// is only set if the tags of s are malformed.
+func (v *Validator) Validate(s any) ([]FieldViolation, error) {
+	val := reflect.Indirect(reflect.ValueOf(s))
+	fields, err := v.rulesFor(val.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []FieldViolation
+	for _, field := range fields {
+		value := val.Field(field.index).String()
+		for _, rule := range field.rules {
+			if msg := v.check(rule, value); msg != "" {
+				violations = append(violations, FieldViolation{Field: field.name, Message: msg})
+			}
+		}
+	}
+	return violations, nil
+}
+
+// rulesFor returns the parsed rules of typ, parsing them on first use
+func (v *Validator) rulesFor(typ reflect.Type) ([]fieldRules, error) {
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("validator: %v is not a struct", typ)
+	}
+	if fields, ok := v.rules.Load(typ); ok {
+		return fields.([]fieldRules), nil
+	}
+
+	var fields []fieldRules
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		if field.Type.Kind() != reflect.String {
+			return nil, fmt.Errorf("validator: %s.%s: rules only apply to strings", typ.Name(), field.Name)
+		}
+
+		f := fieldRules{index: i, name: jsonName(field)}
+		for _, text := range strings.Split(tag, ",") {
+			r, err := parseRule(text)
+			if err != nil {
+				return nil, fmt.Errorf("validator: %s.%s: %w", typ.Name(), field.Name, err)
+			}
+			f.rules = append(f.rules, r)
+		}
+		fields = append(fields, f)
+	}
+	v.rules.Store(typ, fields)
+	return fields, nil
+}
+
+// parseRule parses one comma-separated part of a validate tag
+func parseRule(text string) (rule, error) {
+	name, param, hasParam := strings.Cut(text, "=")
+	switch name {
+	case "min", "max":
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 0 {
+			return rule{}, fmt.Errorf("rule %q needs a character count", text)
+		}
+		return rule{name: name, n: n}, nil
+	case "required", "email", "username", "password":
+		if hasParam {
+			return rule{}, fmt.Errorf("rule %q takes no parameter", text)
+		}
+		return rule{name: name}, nil
+	default:
+		return rule{}, fmt.Errorf("unknown rule %q", name)
+	}
+}
+
+// check applies one rule and returns the violation message, if any
+func (v *Validator) check(r rule, value string) string {
+	if r.name == "required" {
+		if strings.TrimSpace(value) == "" {
+			return "is required"
+		}
+		return ""
+	}
+	if value == "" {
+		return ""
+	}
+
+	switch r.name {
+	case "min":
+		if utf8.RuneCountInString(value) < r.n {
+			return fmt.Sprintf("must be at least %d characters", r.n)
+		}
+	case "max":
+		if utf8.RuneCountInString(value) > r.n {
+			return fmt.Sprintf("must be at most %d characters", r.n)
+		}
+	case "email":
+		addr, err := mail.ParseAddress(value)
+		if err != nil || addr.Address != value {
+			return "must be a valid email address"
+		}
+	case "username":
+		if !usernamePattern.MatchString(value) {
+			return "may only contain letters, digits, '.', '_' and '-', and must start with a letter or digit"
+		}
+	case "password":
+		return v.checkPassword(value)
+	}
+	return ""
+}
+
+func (v *Validator) checkPassword(value string) string {
+	p := v.policy.Load()
+	length := utf8.RuneCountInString(value)
+	if length < p.MinLength {
+		return fmt.Sprintf("must be at least %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return fmt.Sprintf("must be at most %d characters", p.MaxLength)
+	}
+	if p.MaxBytes > 0 && len(value) > p.MaxBytes {
+		return fmt.Sprintf("must be at most %d bytes", p.MaxBytes)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range value {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+
+	var missing []string
+	if p.RequireUpper && !upper {
+		missing = append(missing, "an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		missing = append(missing, "a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		missing = append(missing, "a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		missing = append(missing, "a symbol")
+	}
+	if len(missing) > 0 {
+		return "must contain " + strings.Join(missing, ", ")
+	}
+	return ""
+}
+
+// jsonName returns the name a field has in request bodies
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
@@ -0,0 +1,177 @@
+package utils_test
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rizqishq/Go-REST/utils"
+)
+
+type ruleRequest struct {
+	Username string `json:"username" validate:"required,min=3,max=8,username"`
+	Email    string `json:"email" validate:"email"`
+	Password string `json:"password,omitempty" validate:"password"`
+	Nickname string `validate:"max=4"`
+	Ignored  string `json:"ignored"`
+}
+
+func TestValidatorRules(t *testing.T) {
+	valid := ruleRequest{Username: "john", Email: "john@example.com", Password: "password1", Nickname: "jo"}
+	tests := []struct {
+		name   string
+		change func(*ruleRequest)
+		want   []utils.FieldViolation
+	}{
+		{"valid", func(r *ruleRequest) {}, nil},
+		{"optional fields empty", func(r *ruleRequest) { r.Email, r.Password, r.Nickname = "", "", "" }, nil},
+		{"required", func(r *ruleRequest) { r.Username = "" }, []utils.FieldViolation{{"username", "is required"}}},
+		{"required blank", func(r *ruleRequest) { r.Username = "   " }, []utils.FieldViolation{
+			{"username", "is required"},
+			{"username", "may only contain letters, digits, '.', '_' and '-', and must start with a letter or digit"},
+		}},
+		{"min", func(r *ruleRequest) { r.Username = "jo" }, []utils.FieldViolation{{"username", "must be at least 3 characters"}}},
+		{"max", func(r *ruleRequest) { r.Username = "johnjohnj" }, []utils.FieldViolation{{"username", "must be at most 8 characters"}}},
+		{"min and max count characters", func(r *ruleRequest) { r.Nickname = "ééé" }, nil},
+		{"max without JSON name", func(r *ruleRequest) { r.Nickname = "johnny" }, []utils.FieldViolation{{"Nickname", "must be at most 4 characters"}}},
+		{"username characters", func(r *ruleRequest) { r.Username = "j.o_h-n1" }, nil},
+		{"username start", func(r *ruleRequest) { r.Username = "_john" }, []utils.FieldViolation{
+			{"username", "may only contain letters, digits, '.', '_' and '-', and must start with a letter or digit"},
+		}},
+		{"email", func(r *ruleRequest) { r.Email = "john" }, []utils.FieldViolation{{"email", "must be a valid email address"}}},
+		{"email with name", func(r *ruleRequest) { r.Email = "John <john@example.com>" }, []utils.FieldViolation{{"email", "must be a valid email address"}}},
+		{"password", func(r *ruleRequest) { r.Password = "short" }, []utils.FieldViolation{{"password", "must be at least 8 characters"}}},
+		{"every violation", func(r *ruleRequest) { r.Username, r.Email = "", "x" }, []utils.FieldViolation{
+			{"username", "is required"},
+			{"email", "must be a valid email address"},
+		}},
+	}
+	validator := utils.NewValidator(utils.PasswordPolicy{MinLength: 8, MaxLength: 64})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid
+			tt.change(&req)
+			got, err := validator.Validate(&req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("violations = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatorPasswordPolicy(t *testing.T) {
+	strict := utils.PasswordPolicy{MinLength: 4, MaxLength: 10, MaxBytes: 12, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true}
+	tests := []struct {
+		name, password, want string
+	}{
+		{"satisfies policy", "Abc1!", ""},
+		{"too short", "A1!", "must be at least 4 characters"},
+		{"too long", "Abcdefgh1!x", "must be at most 10 characters"},
+		{"too many bytes", "Abc1!éééé", "must be at most 12 bytes"},
+		{"missing upper", "abc1!", "must contain an uppercase letter"},
+		{"missing lower", "ABC1!", "must contain a lowercase letter"},
+		{"missing digit", "Abcd!", "must contain a digit"},
+		{"missing symbol", "Abcd1", "must contain a symbol"},
+		{"missing several", "abcd", "must contain an uppercase letter, a digit, a symbol"},
+	}
+	validator := utils.NewValidator(strict)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := struct {
+				Password string `json:"password" validate:"password"`
+			}{tt.password}
+			got, err := validator.Validate(&req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var msg string
+			if len(got) > 0 {
+				msg = got[0].Message
+			}
+			if len(got) > 1 || msg != tt.want {
+				t.Errorf("violations = %+v, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatorSetPolicy(t *testing.T) {
+	validator := utils.NewValidator(utils.PasswordPolicy{MinLength: 8})
+	req := struct {
+		Password string `json:"password" validate:"password"`
+	}{"abcdefghij"}
+
+	if got, _ := validator.Validate(&req); len(got) != 0 {
+		t.Fatalf("violations under the first policy = %+v", got)
+	}
+	validator.SetPolicy(utils.PasswordPolicy{MinLength: 12, RequireDigit: true})
+	if got, _ := validator.Validate(&req); len(got) != 1 || got[0].Message != "must be at least 12 characters" {
+		t.Fatalf("violations under the new policy = %+v", got)
+	}
+
+	// Swapping the policy while requests are validated is safe; run with
+	// -race to check
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				if i == 0 {
+					validator.SetPolicy(utils.PasswordPolicy{MinLength: 8 + j%2})
+				} else {
+					validator.Validate(&req)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestValidatorMalformedTags(t *testing.T) {
+	tests := []struct {
+		name string
+		req  any
+		want string
+	}{
+		{"unknown rule", &struct {
+			Name string `validate:"required,uuid"`
+		}{}, `unknown rule "uuid"`},
+		{"min without count", &struct {
+			Name string `validate:"min"`
+		}{}, `rule "min" needs a character count`},
+		{"max with bad count", &struct {
+			Name string `validate:"max=ten"`
+		}{}, `rule "max=ten" needs a character count`},
+		{"negative count", &struct {
+			Name string `validate:"min=-1"`
+		}{}, `rule "min=-1" needs a character count`},
+		{"parameter on email", &struct {
+			Name string `validate:"email=strict"`
+		}{}, `rule "email=strict" takes no parameter`},
+		{"rule on non-string", &struct {
+			Age int `validate:"min=1"`
+		}{}, "Age: rules only apply to strings"},
+		{"not a struct", new(string), "is not a struct"},
+	}
+	validator := utils.NewValidator(utils.PasswordPolicy{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validator.Register(tt.req); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Register() = %v, want an error containing %q", err, tt.want)
+			}
+			violations, err := validator.Validate(tt.req)
+			if err == nil || !strings.Contains(err.Error(), tt.want) || violations != nil {
+				t.Errorf("Validate() = %+v, %v; want an error containing %q", violations, err, tt.want)
+			}
+		})
+	}
+
+	if err := validator.Register(ruleRequest{}, &ruleRequest{}); err != nil {
+		t.Errorf("Register() of valid tags = %v", err)
+	}
+}